@@ -3,7 +3,6 @@ module github.com/MZDevinc/go-lti
 go 1.13
 
 require (
-	github.com/auth0/go-jwt-middleware v0.0.0-20200507191422-d30d7b9ece63
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/gin-gonic/gin v1.6.3
 	github.com/gorilla/sessions v1.1.1
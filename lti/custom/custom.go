@@ -0,0 +1,230 @@
+// Package custom provides typed access to the custom parameters of an LTI 1.3 launch
+//
+// Custom parameters are configured on the platform, or set on deep linking items, and may contain substitution
+// variables such as "$User.id" or "$Context.id". A platform that does not support a variable sends the reference back
+// unchanged. The accessors in this package detect such values and, where the variable has a native claim, fall back
+// to that claim instead.
+package custom
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MZDevinc/go-lti/lti"
+	"github.com/pkg/errors"
+)
+
+// ErrMissing is returned when the launch has no custom parameter with the requested key
+var ErrMissing = errors.New("custom parameter is missing")
+
+// UnsubstitutedError is returned when a custom parameter still holds a variable reference and the variable has no
+// native claim in the launch to fall back to
+type UnsubstitutedError struct {
+	Key      string
+	Variable string
+}
+
+func (e *UnsubstitutedError) Error() string {
+	return fmt.Sprintf("custom parameter %q was not substituted by the platform: $%s", e.Key, e.Variable)
+}
+
+// Params the custom parameters of a launch message
+type Params struct {
+	msg    lti.LaunchMessage
+	values map[string]interface{}
+}
+
+// FromLaunch returns the custom parameters of the launch message
+func FromLaunch(msg lti.LaunchMessage) Params {
+	p := Params{msg: msg, values: map[string]interface{}{}}
+	if msg.Custom != nil {
+		p.values = *msg.Custom
+	}
+	return p
+}
+
+// Keys returns the keys of every custom parameter, sorted
+func (p Params) Keys() []string {
+	keys := make([]string, 0, len(p.values))
+	for key := range p.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Has reports whether the launch includes a custom parameter with the given key
+func (p Params) Has(key string) bool {
+	_, ok := p.values[key]
+	return ok
+}
+
+// Raw returns the custom parameter exactly as sent by the platform
+func (p Params) Raw(key string) (interface{}, bool) {
+	v, ok := p.values[key]
+	return v, ok
+}
+
+// Unsubstituted returns every custom parameter that still holds a variable reference, mapped to the variable name
+// This includes parameters that the accessors resolve through a native claim; it is meant for diagnostics.
+func (p Params) Unsubstituted() map[string]string {
+	out := map[string]string{}
+	for key, value := range p.values {
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if name, ok := VariableName(s); ok {
+			out[key] = name
+		}
+	}
+	return out
+}
+
+// resolve returns the value of a custom parameter, replacing an unsubstituted variable by its native claim
+func (p Params) resolve(key string) (interface{}, error) {
+	value, ok := p.values[key]
+	if !ok || value == nil {
+		return nil, ErrMissing
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+	name, ok := VariableName(s)
+	if !ok {
+		return value, nil
+	}
+	if v, ok := Lookup(name); ok {
+		if native, ok := v.Native(p.msg); ok {
+			return native, nil
+		}
+	}
+	return nil, &UnsubstitutedError{Key: key, Variable: name}
+}
+
+// String returns a custom parameter as a string
+// Numbers and booleans are formatted; objects and arrays are returned as JSON.
+func (p Params) String(key string) (string, error) {
+	value, err := p.resolve(key)
+	if err != nil {
+		return "", err
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", errors.Wrapf(err, "Failed to format custom parameter %q", key)
+		}
+		return string(b), nil
+	}
+}
+
+// Int returns a custom parameter as an integer
+// Strings are parsed; numbers must not have a fractional part.
+func (p Params) Int(key string) (int64, error) {
+	value, err := p.resolve(key)
+	if err != nil {
+		return 0, err
+	}
+
+	switch v := value.(type) {
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return 0, errors.Wrapf(err, "Custom parameter %q is not an integer", key)
+		}
+		return i, nil
+	case json.Number:
+		i, err := v.Int64()
+		if err != nil {
+			return 0, errors.Wrapf(err, "Custom parameter %q is not an integer", key)
+		}
+		return i, nil
+	case float64:
+		if v != math.Trunc(v) || math.IsInf(v, 0) || v > math.MaxInt64 || v < math.MinInt64 {
+			return 0, fmt.Errorf("Custom parameter %q is not an integer: %v", key, v)
+		}
+		return int64(v), nil
+	default:
+		return 0, fmt.Errorf("Custom parameter %q is not an integer: %T", key, value)
+	}
+}
+
+// Bool returns a custom parameter as a boolean
+// Strings accepted by strconv.ParseBool are parsed, as are "yes" and "no".
+func (p Params) Bool(key string) (bool, error) {
+	value, err := p.resolve(key)
+	if err != nil {
+		return false, err
+	}
+
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		s := strings.ToLower(strings.TrimSpace(v))
+		switch s {
+		case "yes":
+			return true, nil
+		case "no":
+			return false, nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return false, errors.Wrapf(err, "Custom parameter %q is not a boolean", key)
+		}
+		return b, nil
+	default:
+		return false, fmt.Errorf("Custom parameter %q is not a boolean: %T", key, value)
+	}
+}
+
+// Time returns a custom parameter as a time
+// Strings must be ISO 8601 date-times, as used by the date-time substitution variables. Numbers are taken as Unix
+// timestamps in seconds.
+func (p Params) Time(key string) (time.Time, error) {
+	value, err := p.resolve(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	switch v := value.(type) {
+	case string:
+		s := strings.TrimSpace(v)
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05Z0700", "2006-01-02T15:04:05"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("Custom parameter %q is not an ISO 8601 date-time: %q", key, v)
+	case json.Number:
+		i, err := v.Int64()
+		if err != nil {
+			return time.Time{}, errors.Wrapf(err, "Custom parameter %q is not a timestamp", key)
+		}
+		return time.Unix(i, 0), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return time.Time{}, fmt.Errorf("Custom parameter %q is not a timestamp: %v", key, v)
+		}
+		return time.Unix(int64(v), 0), nil
+	default:
+		return time.Time{}, fmt.Errorf("Custom parameter %q is not a date-time: %T", key, value)
+	}
+}
@@ -0,0 +1,145 @@
+package custom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MZDevinc/go-lti/lti"
+	"github.com/stretchr/testify/assert"
+)
+
+func testLaunch(custom map[string]interface{}) lti.LaunchMessage {
+	sub := "user-1"
+	return lti.LaunchMessage{
+		Sub:          &sub,
+		Context:      &lti.Context{ID: "course-1", Label: "BIO101"},
+		ResourceLink: &lti.ResourceLink{ID: "link-1"},
+		Custom:       &custom,
+	}
+}
+
+func TestIsUnsubstituted(t *testing.T) {
+	assert.True(t, IsUnsubstituted("$User.id"))
+	assert.True(t, IsUnsubstituted("$Canvas.course.id"))
+	assert.True(t, IsUnsubstituted(" $ResourceLink.available.startDateTime "))
+	assert.False(t, IsUnsubstituted("$5.00"))
+	assert.False(t, IsUnsubstituted("$User"))
+	assert.False(t, IsUnsubstituted("costs $User.id"))
+	assert.False(t, IsUnsubstituted("user-1"))
+
+	name, ok := VariableName("$Context.id")
+	assert.True(t, ok)
+	assert.Equal(t, "Context.id", name)
+}
+
+func TestCatalog(t *testing.T) {
+	v, ok := Lookup("$User.id")
+	assert.True(t, ok)
+	assert.True(t, v.HasNative())
+	assert.Equal(t, "sub", v.Claim)
+
+	v, ok = Lookup("ResourceLink.available.startDateTime")
+	assert.True(t, ok)
+	assert.False(t, v.HasNative())
+
+	_, ok = Lookup("Canvas.course.id")
+	assert.False(t, ok)
+
+	vars := Catalog()
+	assert.NotEmpty(t, vars)
+	for i := 1; i < len(vars); i++ {
+		assert.True(t, vars[i-1].Name < vars[i].Name)
+	}
+}
+
+func TestParams(t *testing.T) {
+	p := FromLaunch(testLaunch(map[string]interface{}{
+		"name":        "value",
+		"count":       "42",
+		"number":      7.0,
+		"fraction":    1.5,
+		"flag":        "yes",
+		"bool":        true,
+		"due":         "2020-09-01T12:00:00Z",
+		"due_unix":    1598961600.0,
+		"user":        "$User.id",
+		"context":     "$Context.id",
+		"start":       "$ResourceLink.available.startDateTime",
+		"canvas":      "$Canvas.course.id",
+		"not_a_count": "many",
+	}))
+
+	s, err := p.String("name")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", s)
+
+	s, err = p.String("number")
+	assert.NoError(t, err)
+	assert.Equal(t, "7", s)
+
+	i, err := p.Int("count")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), i)
+
+	i, err = p.Int("number")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), i)
+
+	_, err = p.Int("fraction")
+	assert.Error(t, err)
+
+	_, err = p.Int("not_a_count")
+	assert.Error(t, err)
+
+	b, err := p.Bool("flag")
+	assert.NoError(t, err)
+	assert.True(t, b)
+
+	b, err = p.Bool("bool")
+	assert.NoError(t, err)
+	assert.True(t, b)
+
+	due := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	tm, err := p.Time("due")
+	assert.NoError(t, err)
+	assert.True(t, due.Equal(tm))
+
+	tm, err = p.Time("due_unix")
+	assert.NoError(t, err)
+	assert.True(t, due.Equal(tm))
+
+	_, err = p.String("missing")
+	assert.Equal(t, ErrMissing, err)
+
+	// Unsubstituted variables fall back to native claims where there is one
+	s, err = p.String("user")
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", s)
+
+	s, err = p.String("context")
+	assert.NoError(t, err)
+	assert.Equal(t, "course-1", s)
+
+	_, err = p.Time("start")
+	if assert.IsType(t, &UnsubstitutedError{}, err) {
+		assert.Equal(t, "ResourceLink.available.startDateTime", err.(*UnsubstitutedError).Variable)
+	}
+
+	_, err = p.String("canvas")
+	assert.IsType(t, &UnsubstitutedError{}, err)
+
+	assert.Equal(t, map[string]string{
+		"user":    "User.id",
+		"context": "Context.id",
+		"start":   "ResourceLink.available.startDateTime",
+		"canvas":  "Canvas.course.id",
+	}, p.Unsubstituted())
+}
+
+func TestParamsWithoutCustomClaim(t *testing.T) {
+	p := FromLaunch(lti.LaunchMessage{})
+	assert.False(t, p.Has("anything"))
+	assert.Empty(t, p.Keys())
+	_, err := p.String("anything")
+	assert.Equal(t, ErrMissing, err)
+}
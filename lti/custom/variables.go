@@ -0,0 +1,297 @@
+package custom
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/MZDevinc/go-lti/lti"
+)
+
+// Variable a substitution variable defined by the LTI 1.3 Core specification
+// See http://www.imsglobal.org/spec/lti/v1p3/#customproperty
+type Variable struct {
+	// Name of the variable, without the leading "$", e.g. "User.id"
+	Name string
+	// Claim describes the native launch claim carrying the same value, or is empty if there is none
+	Claim string
+
+	native func(msg lti.LaunchMessage) (string, bool)
+}
+
+// Native returns the value of the variable taken from the native claims of the launch message
+// The second value is false if the variable has no native claim, or the claim is not present in the message.
+func (v Variable) Native(msg lti.LaunchMessage) (string, bool) {
+	if v.native == nil {
+		return "", false
+	}
+	return v.native(msg)
+}
+
+// HasNative reports whether the variable can be resolved from a native claim
+func (v Variable) HasNative() bool {
+	return v.native != nil
+}
+
+// variablePattern matches a variable reference as sent back by a platform that did not substitute it, e.g.
+// "$User.id" or "$Canvas.course.id"
+var variablePattern = regexp.MustCompile(`^\$[A-Za-z][A-Za-z0-9_]*(\.[A-Za-z0-9_]+)+$`)
+
+// IsUnsubstituted reports whether the value is a literal variable reference such as "$User.id"
+// Any well-formed reference is recognized, including vendor variables that are not in the catalog.
+func IsUnsubstituted(value string) bool {
+	return variablePattern.MatchString(strings.TrimSpace(value))
+}
+
+// VariableName returns the name of the variable the value refers to, without the leading "$"
+// The second value is false if the value is not a variable reference.
+func VariableName(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if !variablePattern.MatchString(value) {
+		return "", false
+	}
+	return value[1:], true
+}
+
+// Lookup finds a variable of the LTI 1.3 catalog by name, with or without the leading "$"
+func Lookup(name string) (Variable, bool) {
+	v, ok := catalog[strings.TrimPrefix(name, "$")]
+	return v, ok
+}
+
+// Catalog returns every substitution variable defined by the LTI 1.3 Core specification, sorted by name
+func Catalog() []Variable {
+	vars := make([]Variable, 0, len(catalog))
+	for _, v := range catalog {
+		vars = append(vars, v)
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	return vars
+}
+
+// catalog holds the variables of the LTI 1.3 Core specification, appendix C, and the ones the LTI Advantage
+// services add
+var catalog = func() map[string]Variable {
+	vars := map[string]Variable{}
+	add := func(name, claim string, native func(lti.LaunchMessage) (string, bool)) {
+		vars[name] = Variable{Name: name, Claim: claim, native: native}
+	}
+	plain := func(names ...string) {
+		for _, name := range names {
+			add(name, "", nil)
+		}
+	}
+
+	// User
+	add("User.id", "sub", func(m lti.LaunchMessage) (string, bool) { return deref(m.Sub) })
+	add("User.image", "picture", func(m lti.LaunchMessage) (string, bool) { return deref(m.Picture) })
+	add("User.scope.mentor", "https://purl.imsglobal.org/spec/lti/claim/role_scope_mentor", func(m lti.LaunchMessage) (string, bool) {
+		return joined(m.Mentees())
+	})
+	plain("User.username", "User.org", "User.gradeLevels.oneRoster")
+
+	// Person
+	add("Person.sourcedId", "https://purl.imsglobal.org/spec/lti/claim/lis[person_sourcedid]", func(m lti.LaunchMessage) (string, bool) {
+		if m.LIS == nil {
+			return "", false
+		}
+		return nonEmpty(m.LIS.PersonSourcedID)
+	})
+	add("Person.name.full", "name", func(m lti.LaunchMessage) (string, bool) { return deref(m.Name) })
+	add("Person.name.family", "family_name", func(m lti.LaunchMessage) (string, bool) { return deref(m.FamilyName) })
+	add("Person.name.given", "given_name", func(m lti.LaunchMessage) (string, bool) { return deref(m.GivenName) })
+	add("Person.name.middle", "middle_name", func(m lti.LaunchMessage) (string, bool) { return deref(m.MiddleName) })
+	add("Person.email.primary", "email", func(m lti.LaunchMessage) (string, bool) { return deref(m.Email) })
+	plain(
+		"Person.name.prefix", "Person.name.suffix",
+		"Person.address.street1", "Person.address.street2", "Person.address.street3", "Person.address.street4",
+		"Person.address.locality", "Person.address.statepr", "Person.address.country", "Person.address.postcode",
+		"Person.address.timezone",
+		"Person.phone.mobile", "Person.phone.primary", "Person.phone.home", "Person.phone.work",
+		"Person.email.personal", "Person.webaddress", "Person.sms",
+	)
+
+	// Context
+	add("Context.id", "https://purl.imsglobal.org/spec/lti/claim/context[id]", func(m lti.LaunchMessage) (string, bool) {
+		if m.Context == nil {
+			return "", false
+		}
+		return nonEmpty(m.Context.ID)
+	})
+	add("Context.type", "https://purl.imsglobal.org/spec/lti/claim/context[type]", func(m lti.LaunchMessage) (string, bool) {
+		if m.Context == nil {
+			return "", false
+		}
+		return joined(m.Context.Type)
+	})
+	add("Context.label", "https://purl.imsglobal.org/spec/lti/claim/context[label]", func(m lti.LaunchMessage) (string, bool) {
+		if m.Context == nil {
+			return "", false
+		}
+		return nonEmpty(m.Context.Label)
+	})
+	add("Context.title", "https://purl.imsglobal.org/spec/lti/claim/context[title]", func(m lti.LaunchMessage) (string, bool) {
+		if m.Context == nil {
+			return "", false
+		}
+		return nonEmpty(m.Context.Title)
+	})
+	plain("Context.org", "Context.sourcedId", "Context.id.history", "Context.gradeLevels.oneRoster")
+
+	// CourseTemplate, CourseOffering and CourseSection
+	plain(
+		"CourseTemplate.sourcedId", "CourseTemplate.label", "CourseTemplate.title", "CourseTemplate.shortDescription",
+		"CourseTemplate.longDescription", "CourseTemplate.courseNumber", "CourseTemplate.credits",
+	)
+	add("CourseOffering.sourcedId", "https://purl.imsglobal.org/spec/lti/claim/lis[course_offering_sourcedid]", func(m lti.LaunchMessage) (string, bool) {
+		if m.LIS == nil {
+			return "", false
+		}
+		return nonEmpty(m.LIS.CourseOfferingSourcedID)
+	})
+	plain(
+		"CourseOffering.label", "CourseOffering.title", "CourseOffering.shortDescription",
+		"CourseOffering.longDescription", "CourseOffering.courseNumber", "CourseOffering.credits",
+		"CourseOffering.academicSession",
+	)
+	add("CourseSection.sourcedId", "https://purl.imsglobal.org/spec/lti/claim/lis[course_section_sourcedid]", func(m lti.LaunchMessage) (string, bool) {
+		if m.LIS == nil {
+			return "", false
+		}
+		return nonEmpty(m.LIS.CourseSectionSourcedID)
+	})
+	plain(
+		"CourseSection.label", "CourseSection.title", "CourseSection.shortDescription", "CourseSection.longDescription",
+		"CourseSection.courseNumber", "CourseSection.credits", "CourseSection.maxNumberofStudents",
+		"CourseSection.numberofStudents", "CourseSection.dept", "CourseSection.timeFrame.begin",
+		"CourseSection.timeFrame.end", "CourseSection.enrollControl.accept", "CourseSection.enrollControl.allowed",
+		"CourseSection.dataSource", "CourseSection.sourceSectionId",
+	)
+
+	// Group
+	plain(
+		"Group.sourcedId", "Group.scheme", "Group.typevalue", "Group.level", "Group.email", "Group.url",
+		"Group.timeFrame.begin", "Group.timeFrame.end", "Group.enrollControl.accept", "Group.enrollControl.private",
+		"Group.parentId", "Group.dataSource",
+	)
+
+	// Membership
+	add("Membership.role", "https://purl.imsglobal.org/spec/lti/claim/roles", func(m lti.LaunchMessage) (string, bool) {
+		return joined(m.Roles)
+	})
+	add("Membership.role.scope.mentor", "https://purl.imsglobal.org/spec/lti/claim/role_scope_mentor", func(m lti.LaunchMessage) (string, bool) {
+		return joined(m.Mentees())
+	})
+	plain(
+		"Membership.sourcedId", "Membership.collectionSourcedId", "Membership.personSourcedId", "Membership.status",
+		"Membership.createdTimestamp", "Membership.dataSource",
+	)
+
+	// ResourceLink
+	add("ResourceLink.id", "https://purl.imsglobal.org/spec/lti/claim/resource_link[id]", func(m lti.LaunchMessage) (string, bool) {
+		if m.ResourceLink == nil {
+			return "", false
+		}
+		return nonEmpty(m.ResourceLink.ID)
+	})
+	add("ResourceLink.title", "https://purl.imsglobal.org/spec/lti/claim/resource_link[title]", func(m lti.LaunchMessage) (string, bool) {
+		if m.ResourceLink == nil {
+			return "", false
+		}
+		return nonEmpty(m.ResourceLink.Title)
+	})
+	add("ResourceLink.description", "https://purl.imsglobal.org/spec/lti/claim/resource_link[description]", func(m lti.LaunchMessage) (string, bool) {
+		if m.ResourceLink == nil {
+			return "", false
+		}
+		return nonEmpty(m.ResourceLink.Description)
+	})
+	plain(
+		"ResourceLink.id.history",
+		"ResourceLink.available.startDateTime", "ResourceLink.available.endDateTime",
+		"ResourceLink.submission.startDateTime", "ResourceLink.submission.endDateTime",
+		"ResourceLink.available.user.startDateTime", "ResourceLink.available.user.endDateTime",
+		"ResourceLink.submission.user.startDateTime", "ResourceLink.submission.user.endDateTime",
+		"LineItem.resultValue.max", "LineItem.releaseDateTime",
+		"LineItem.user.releaseDateTime",
+	)
+
+	// Message
+	add("Message.documentTarget", "https://purl.imsglobal.org/spec/lti/claim/launch_presentation[document_target]", func(m lti.LaunchMessage) (string, bool) {
+		if m.LaunchPresentation == nil {
+			return "", false
+		}
+		return nonEmpty(m.LaunchPresentation.DocumentTarget)
+	})
+	add("Message.locale", "https://purl.imsglobal.org/spec/lti/claim/launch_presentation[locale]", func(m lti.LaunchMessage) (string, bool) {
+		if m.LaunchPresentation != nil && m.LaunchPresentation.Locale != "" {
+			return m.LaunchPresentation.Locale, true
+		}
+		return deref(m.Locale)
+	})
+
+	// ToolPlatform and ToolPlatformInstance
+	add("ToolPlatform.productFamilyCode", "https://purl.imsglobal.org/spec/lti/claim/tool_platform[product_family_code]", func(m lti.LaunchMessage) (string, bool) {
+		if m.ToolPlatform == nil {
+			return "", false
+		}
+		return nonEmpty(m.ToolPlatform.ProductFamilyCode)
+	})
+	add("ToolPlatform.version", "https://purl.imsglobal.org/spec/lti/claim/tool_platform[version]", func(m lti.LaunchMessage) (string, bool) {
+		if m.ToolPlatform == nil {
+			return "", false
+		}
+		return nonEmpty(m.ToolPlatform.Version)
+	})
+	add("ToolPlatformInstance.guid", "https://purl.imsglobal.org/spec/lti/claim/tool_platform[guid]", func(m lti.LaunchMessage) (string, bool) {
+		if m.ToolPlatform == nil {
+			return "", false
+		}
+		guid, ok := m.ToolPlatform.GUID.(string)
+		if !ok {
+			return "", false
+		}
+		return nonEmpty(guid)
+	})
+	add("ToolPlatformInstance.name", "https://purl.imsglobal.org/spec/lti/claim/tool_platform[name]", func(m lti.LaunchMessage) (string, bool) {
+		if m.ToolPlatform == nil {
+			return "", false
+		}
+		return nonEmpty(m.ToolPlatform.Name)
+	})
+	add("ToolPlatformInstance.description", "https://purl.imsglobal.org/spec/lti/claim/tool_platform[description]", func(m lti.LaunchMessage) (string, bool) {
+		if m.ToolPlatform == nil {
+			return "", false
+		}
+		return nonEmpty(m.ToolPlatform.Description)
+	})
+	add("ToolPlatformInstance.url", "https://purl.imsglobal.org/spec/lti/claim/tool_platform[url]", func(m lti.LaunchMessage) (string, bool) {
+		if m.ToolPlatform == nil {
+			return "", false
+		}
+		return nonEmpty(m.ToolPlatform.URL)
+	})
+	add("ToolPlatformInstance.contactEmail", "https://purl.imsglobal.org/spec/lti/claim/tool_platform[contact_email]", func(m lti.LaunchMessage) (string, bool) {
+		if m.ToolPlatform == nil {
+			return "", false
+		}
+		return nonEmpty(m.ToolPlatform.ContactEmail)
+	})
+
+	return vars
+}()
+
+func deref(s *string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	return nonEmpty(*s)
+}
+
+func nonEmpty(s string) (string, bool) {
+	return s, s != ""
+}
+
+func joined(values []string) (string, bool) {
+	return nonEmpty(strings.Join(values, ","))
+}
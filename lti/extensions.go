@@ -0,0 +1,123 @@
+package lti
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// registeredJWTClaims are standard JWT and OpenID Connect claims that are not modeled on LaunchMessage, but are not
+// vendor extensions either
+var registeredJWTClaims = []string{"azp", "nbf", "jti", "auth_time", "at_hash", "acr", "amr", "sid", "email_verified"}
+
+// knownClaims holds every top-level claim name that is not an extension
+var knownClaims = func() map[string]bool {
+	known := map[string]bool{}
+	t := reflect.TypeOf(LaunchMessage{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			known[name] = true
+		}
+	}
+	for _, name := range registeredJWTClaims {
+		known[name] = true
+	}
+	return known
+}()
+
+var (
+	extensionsMu sync.RWMutex
+	extensions   = map[string]reflect.Type{}
+)
+
+// RegisterExtension registers the type that the extension claim with the given key is decoded into
+// ParseLaunchMessage decodes registered claims automatically; the result is available from
+// LaunchMessage.DecodedExtension as a pointer to a value of the prototype's type. Registering a key again replaces the
+// previous type. RegisterExtension is typically called from the init function of a package defining vendor claims.
+func RegisterExtension(key string, prototype interface{}) {
+	t := reflect.TypeOf(prototype)
+	if t == nil {
+		panic("lti: RegisterExtension prototype is nil")
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	extensionsMu.Lock()
+	defer extensionsMu.Unlock()
+	extensions[key] = t
+}
+
+func registeredExtension(key string) (reflect.Type, bool) {
+	extensionsMu.RLock()
+	defer extensionsMu.RUnlock()
+	t, ok := extensions[key]
+	return t, ok
+}
+
+// collectExtensions returns every top-level claim that LaunchMessage does not model, as raw JSON
+func collectExtensions(claims jwt.MapClaims) (map[string]json.RawMessage, error) {
+	var exts map[string]json.RawMessage
+	for key, value := range claims {
+		if knownClaims[key] {
+			continue
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to serialize extension claim %q", key)
+		}
+		if exts == nil {
+			exts = map[string]json.RawMessage{}
+		}
+		exts[key] = raw
+	}
+	return exts, nil
+}
+
+// decodeExtensions decodes every extension claim with a registered type
+// Claims that do not match their registered type are left undecoded; they remain available as raw JSON.
+func (rlm *LaunchMessage) decodeExtensions() {
+	for key, raw := range rlm.Extensions {
+		t, ok := registeredExtension(key)
+		if !ok {
+			continue
+		}
+		target := reflect.New(t)
+		if err := json.Unmarshal(raw, target.Interface()); err != nil {
+			continue
+		}
+		if rlm.decodedExtensions == nil {
+			rlm.decodedExtensions = map[string]interface{}{}
+		}
+		rlm.decodedExtensions[key] = target.Interface()
+	}
+}
+
+// Extension decodes the extension claim with the given key into target, reporting whether the claim was present
+func (rlm LaunchMessage) Extension(key string, target interface{}) (bool, error) {
+	raw, ok := rlm.Extensions[key]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(raw, target); err != nil {
+		return true, errors.Wrapf(err, "Failed to decode extension claim %q", key)
+	}
+	return true, nil
+}
+
+// DecodedExtension returns the extension claim with the given key as decoded into its registered type
+func (rlm LaunchMessage) DecodedExtension(key string) (interface{}, bool) {
+	value, ok := rlm.decodedExtensions[key]
+	return value, ok
+}
+
+// HasExtension check if the message includes the given extension claim
+func (rlm LaunchMessage) HasExtension(key string) bool {
+	_, ok := rlm.Extensions[key]
+	return ok
+}
@@ -0,0 +1,84 @@
+package lti
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoLTI1p1Claim is returned when a launch has no LTI 1.1 migration claim, or the claim has no signed consumer key
+var ErrNoLTI1p1Claim = errors.New("launch has no signed lti1p1 claim")
+
+// ErrLTI1p1Signature is returned when the oauth_consumer_key_sign of the LTI 1.1 migration claim does not verify
+var ErrLTI1p1Signature = errors.New("lti1p1 oauth_consumer_key_sign does not verify")
+
+// LegacyIDs the LTI 1.1 identifiers of a launch, used to link LTI 1.3 launches to existing LTI 1.1 accounts and links
+type LegacyIDs struct {
+	ConsumerKey    string
+	UserID         string
+	ResourceLinkID string
+}
+
+// LTI1p1Signature computes the oauth_consumer_key_sign a platform sends for the launch, given the LTI 1.1 consumer key
+// and secret
+// The signature is the base64 HMAC-SHA256, keyed with the secret, of the consumer key, deployment ID, issuer, client
+// ID, expiry and nonce joined with "&".
+func (rlm LaunchMessage) LTI1p1Signature(consumerKey, secret string) string {
+	base := strings.Join([]string{
+		consumerKey,
+		rlm.DeploymentID,
+		rlm.Iss,
+		rlm.Aud,
+		strconv.Itoa(rlm.Exp),
+		rlm.Nonce,
+	}, "&")
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(base))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyLTI1p1 checks the oauth_consumer_key_sign of the LTI 1.1 migration claim against the consumer secret
+// The secret is the one stored for LTI1p1.OAuthConsumerKey by the existing LTI 1.1 integration.
+func (rlm LaunchMessage) VerifyLTI1p1(secret string) error {
+	if rlm.LTI1p1 == nil || rlm.LTI1p1.OAuthConsumerKey == "" || rlm.LTI1p1.OAuthConsumerKeySign == "" {
+		return ErrNoLTI1p1Claim
+	}
+
+	got, err := base64.StdEncoding.DecodeString(rlm.LTI1p1.OAuthConsumerKeySign)
+	if err != nil {
+		return ErrLTI1p1Signature
+	}
+	want, _ := base64.StdEncoding.DecodeString(rlm.LTI1p1Signature(rlm.LTI1p1.OAuthConsumerKey, secret))
+	if !hmac.Equal(got, want) {
+		return ErrLTI1p1Signature
+	}
+	return nil
+}
+
+// LegacyIDs returns the LTI 1.1 identifiers of the launch, only if the migration claim verifies against the consumer
+// secret
+// The user and resource link IDs fall back to the LTI 1.3 values when the claim leaves them out, which the platform
+// does when they are unchanged.
+func (rlm LaunchMessage) LegacyIDs(secret string) (*LegacyIDs, error) {
+	if err := rlm.VerifyLTI1p1(secret); err != nil {
+		return nil, err
+	}
+
+	ids := &LegacyIDs{
+		ConsumerKey:    rlm.LTI1p1.OAuthConsumerKey,
+		UserID:         rlm.LTI1p1.UserID,
+		ResourceLinkID: rlm.LTI1p1.ResourceLinkID,
+	}
+	if ids.UserID == "" && rlm.Sub != nil {
+		ids.UserID = *rlm.Sub
+	}
+	if ids.ResourceLinkID == "" && rlm.ResourceLink != nil {
+		ids.ResourceLinkID = rlm.ResourceLink.ID
+	}
+	return ids, nil
+}
@@ -0,0 +1,79 @@
+package lti
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// migrationMessage is the example of the LTI 1.1 migration specification
+func migrationMessage() LaunchMessage {
+	sub := "e9db8b0c-6d2c-4e6f-8d2c-3e1e5f1c2a4b"
+	return LaunchMessage{
+		Iss:          "https://lmsvendor.com",
+		Aud:          "PM48OJSfGDTAzAo",
+		Exp:          1551290856,
+		Nonce:        "172we8671fd8z",
+		DeploymentID: "689302",
+		Sub:          &sub,
+		ResourceLink: &ResourceLink{ID: "200d101f-2c14-434a-a0f3-57c2a42369fd"},
+		LTI1p1: &LTI1p1{
+			UserID:               "34212",
+			OAuthConsumerKey:     "179248902",
+			OAuthConsumerKeySign: "lWd54kFo5qU7xshAna6v8BwoBm6tmUjc6GTax6+12ps=",
+		},
+	}
+}
+
+func TestLTI1p1Claim(t *testing.T) {
+	msg := LaunchMessage{}
+	err := json.Unmarshal([]byte(`{"https://purl.imsglobal.org/spec/lti/claim/lti1p1": {
+		"user_id": "34212",
+		"oauth_consumer_key": "179248902",
+		"oauth_consumer_key_sign": "lWd54kFo5qU7xshAna6v8BwoBm6tmUjc6GTax6+12ps=",
+		"resource_link_id": "link-11"
+	}}`), &msg)
+	assert.NoError(t, err)
+	assert.Equal(t, &LTI1p1{
+		UserID:               "34212",
+		OAuthConsumerKey:     "179248902",
+		OAuthConsumerKeySign: "lWd54kFo5qU7xshAna6v8BwoBm6tmUjc6GTax6+12ps=",
+		ResourceLinkID:       "link-11",
+	}, msg.LTI1p1)
+}
+
+func TestLegacyIDs(t *testing.T) {
+	msg := migrationMessage()
+
+	assert.Equal(t, msg.LTI1p1.OAuthConsumerKeySign, msg.LTI1p1Signature("179248902", "my-lti11-secret"))
+	assert.NoError(t, msg.VerifyLTI1p1("my-lti11-secret"))
+
+	ids, err := msg.LegacyIDs("my-lti11-secret")
+	assert.NoError(t, err)
+	assert.Equal(t, &LegacyIDs{
+		ConsumerKey:    "179248902",
+		UserID:         "34212",
+		ResourceLinkID: "200d101f-2c14-434a-a0f3-57c2a42369fd",
+	}, ids)
+
+	ids, err = msg.LegacyIDs("wrong-secret")
+	assert.Equal(t, ErrLTI1p1Signature, err)
+	assert.Nil(t, ids)
+
+	tampered := migrationMessage()
+	tampered.DeploymentID = "other-deployment"
+	assert.Equal(t, ErrLTI1p1Signature, tampered.VerifyLTI1p1("my-lti11-secret"))
+
+	garbled := migrationMessage()
+	garbled.LTI1p1.OAuthConsumerKeySign = "not base64!"
+	assert.Equal(t, ErrLTI1p1Signature, garbled.VerifyLTI1p1("my-lti11-secret"))
+
+	unsigned := migrationMessage()
+	unsigned.LTI1p1.OAuthConsumerKeySign = ""
+	_, err = unsigned.LegacyIDs("my-lti11-secret")
+	assert.Equal(t, ErrNoLTI1p1Claim, err)
+
+	_, err = LaunchMessage{}.LegacyIDs("my-lti11-secret")
+	assert.Equal(t, ErrNoLTI1p1Claim, err)
+}
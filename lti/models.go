@@ -1,6 +1,9 @@
 package lti
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // This package contains models for objects as defined in the LTI 1.3 specification
 
@@ -48,8 +51,9 @@ type LaunchMessage struct {
 
 	// RoleScopeMentor contains an array of the user ID values which the current, launching user can access as a mentor.
 	// The sender of the message MUST NOT include a list of user ID values in this property unless they also provide
-	// http://purl.imsglobal.orb/vocab/lis/v2/membership#Mentor as one of the values passed in the roles claim.
-	RoleScopeMentor *[]string `json:"https://purlimsglobal.org/spec/lti/claim/role_scope_mentor"`
+	// http://purl.imsglobal.org/vocab/lis/v2/membership#Mentor as one of the values passed in the roles claim.
+	// Use Mentees to read it, which enforces that rule.
+	RoleScopeMentor *[]string `json:"https://purl.imsglobal.org/spec/lti/claim/role_scope_mentor"`
 
 	// LaunchPresentation contains contextual information about how the launch will be displayed in the platform
 	LaunchPresentation *LaunchPresentation `json:"https://purl.imsglobal.org/spec/lti/claim/launch_presentation"`
@@ -67,6 +71,10 @@ type LaunchMessage struct {
 	// NamesRoleService contains information about the Names and Roles Provisioning Service connected to this message/context
 	NamesRoleService *NamesRoleService `json:"https://purl.imsglobal.org/spec/lti-nrps/claim/namesroleservice"`
 
+	// LTI1p1 carries the LTI 1.1 identifiers of the launch, for tools migrating existing LTI 1.1 installs
+	// See https://www.imsglobal.org/spec/lti/v1p3/migr#lti-1-1-migration-claim
+	LTI1p1 *LTI1p1 `json:"https://purl.imsglobal.org/spec/lti/claim/lti1p1"`
+
 	// Additional custom properties
 	// See http://www.imsglobal.org/spec/lti/v1p3/#custom-variables-0
 	Custom *map[string]interface{} `json:"https://purl.imsglobal.org/spec/lti/claim/custom"`
@@ -76,7 +84,11 @@ type LaunchMessage struct {
 	// message's JSON object by adding one or more claims. Vendors MUST use a fully-qualified URL as the claim name for
 	// any of their extension claims.
 	// By best practice, vendors should define custom variables... instead of relying on extension properties."
-	Extensions *map[string]string
+	// Extensions holds every top-level claim that is not modeled above, keyed by claim name, as raw JSON.
+	// Use Extension to decode a claim, or RegisterExtension to have it decoded while parsing.
+	Extensions map[string]json.RawMessage `json:"-"`
+
+	decodedExtensions map[string]interface{}
 }
 
 // ResourceLink composes properties for the resource link from which the launch message occurs
@@ -123,6 +135,16 @@ type LIS struct {
 	ResultSourcedID         string `json:"result_sourcedid"`
 }
 
+// LTI1p1 the LTI 1.1 migration claim
+// UserID and ResourceLinkID are only sent when they differ from the LTI 1.3 values. Use LegacyIDs to read them, which
+// checks the signature and applies that fallback.
+type LTI1p1 struct {
+	UserID               string `json:"user_id"`
+	OAuthConsumerKey     string `json:"oauth_consumer_key"`
+	OAuthConsumerKeySign string `json:"oauth_consumer_key_sign"`
+	ResourceLinkID       string `json:"resource_link_id"`
+}
+
 // DeepLinkingSettings additional information for a Deep Linking request
 type DeepLinkingSettings struct {
 	DeepLinkReturnURL                 string   `json:"deep_link_return_url" required:"true"`
@@ -207,6 +229,7 @@ const (
 )
 
 //HasRole check if the message includes the given role
+//The role must match exactly; use HasImpliedRole to match short names and sub-roles
 func (rlm LaunchMessage) HasRole(role string) bool {
 	for i := range rlm.Roles {
 		if rlm.Roles[i] == role {
@@ -230,6 +253,17 @@ func (rlm LaunchMessage) HasAnyRole(roles []string) bool {
 	return false
 }
 
+//Mentees returns the user IDs the launching user can access as a mentor
+//As the specification requires, the IDs are only returned when the user also holds the Mentor role.
+func (rlm LaunchMessage) Mentees() []string {
+	if rlm.RoleScopeMentor == nil || !rlm.IsMentor() {
+		return nil
+	}
+	mentees := make([]string, len(*rlm.RoleScopeMentor))
+	copy(mentees, *rlm.RoleScopeMentor)
+	return mentees
+}
+
 //IsAnonymous is the launch request anonymous
 func (rlm LaunchMessage) IsAnonymous() bool {
 	return rlm.Sub == nil
@@ -2,16 +2,15 @@ package lti
 
 import (
 	"encoding/json"
-	"fmt"
-	"reflect"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
-// ParseLaunchMessage marshals unstructured json claims into a LaunchMessage struct, and checks for required fields
+// ParseLaunchMessage marshals unstructured json claims into a LaunchMessage struct, and validates it
+// When validation fails, the returned error is the *ValidationReport listing every violation.
 func ParseLaunchMessage(claims jwt.MapClaims) (LaunchMessage, error) {
 	msg := LaunchMessage{}
-	serializedClaims, err := json.Marshal(claims)
+	serializedClaims, err := json.Marshal(normalizeAudience(claims))
 	if err != nil {
 		return msg, err
 	}
@@ -20,6 +19,12 @@ func ParseLaunchMessage(claims jwt.MapClaims) (LaunchMessage, error) {
 		return msg, err
 	}
 
+	msg.Extensions, err = collectExtensions(claims)
+	if err != nil {
+		return msg, err
+	}
+	msg.decodeExtensions()
+
 	err = validateLaunchMessage(msg)
 	if err != nil {
 		return msg, err
@@ -28,46 +33,28 @@ func ParseLaunchMessage(claims jwt.MapClaims) (LaunchMessage, error) {
 	return msg, nil
 }
 
-func validateLaunchMessage(msg LaunchMessage) error {
-	v := reflect.ValueOf(msg)
-	return validateRecursive(v, true, "")
-}
-
-func validateRecursive(v reflect.Value, required bool, fieldName string) error {
-	exists := !(!v.IsValid() || v.IsZero())
-	t := v.Type()
-
-	if required && !exists {
-		// A field must be present if it's required
-		return fmt.Errorf("Field %s was missing", fieldName)
+// normalizeAudience returns claims with a single string audience, so that they fit LaunchMessage.Aud
+// When the token has several audiences, the authorized party (azp) is the client ID the token was issued for.
+func normalizeAudience(claims jwt.MapClaims) jwt.MapClaims {
+	auds, ok := claims["aud"].([]interface{})
+	if !ok {
+		return claims
 	}
 
-	// Deference a pointer to a struct
-	if t.Kind() == reflect.Ptr && exists && t.Elem().Kind() == reflect.Struct {
-		v = v.Elem()
-		t = t.Elem()
+	normalized := jwt.MapClaims{}
+	for k, v := range claims {
+		normalized[k] = v
 	}
-
-	if t.Kind() == reflect.Struct && exists {
-		for i := 0; i < t.NumField(); i++ {
-			sv := v.Field(i)
-			st := t.Field(i)
-
-			required := st.Tag.Get("required") == "true"
-
-			subFieldName := st.Name
-			if fieldName != "" {
-				subFieldName = fieldName + " / " + st.Name
-			}
-
-			err := validateRecursive(sv, required, subFieldName)
-			if err != nil {
-				return err
-			}
-		}
+	if azp, ok := claims["azp"].(string); ok && azp != "" {
+		normalized["aud"] = azp
+	} else if len(auds) > 0 {
+		normalized["aud"] = auds[0]
 	}
+	return normalized
+}
 
-	return nil
+func validateLaunchMessage(msg LaunchMessage) error {
+	return ValidateLaunchMessage(msg).Err()
 }
 
 // ParseLaunchMessage materializes json claims into a ResourceLinkMessage struct
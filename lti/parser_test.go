@@ -2,8 +2,10 @@ package lti
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -13,15 +15,15 @@ func TestParser(t *testing.T) {
 		Description: "present",
 	}
 	msg1 := LaunchMessage{
-		Iss:           "present",
+		Iss:           "https://platform.example.com",
 		Aud:           "present",
 		Iat:           1000,
 		Exp:           1000,
 		Nonce:         "present",
-		MessageType:   "LtiResourceRequest",
-		Version:       "1.3",
+		MessageType:   "LtiResourceLinkRequest",
+		Version:       "1.3.0",
 		DeploymentID:  "present",
-		TargetLinkURI: "present",
+		TargetLinkURI: "https://tool.example.com/launch",
 		ResourceLink:  &r1,
 	}
 	err1 := validateLaunchMessage(msg1)
@@ -32,15 +34,15 @@ func TestParser(t *testing.T) {
 		Description: "present",
 	}
 	msg2 := LaunchMessage{
-		Iss: "present",
+		Iss: "https://platform.example.com",
 		// Aud:        missing,
 		Iat:           1000,
 		Exp:           1000,
 		Nonce:         "present",
-		MessageType:   "LtiResourceRequest",
-		Version:       "1.3",
+		MessageType:   "LtiResourceLinkRequest",
+		Version:       "1.3.0",
 		DeploymentID:  "present",
-		TargetLinkURI: "present",
+		TargetLinkURI: "https://tool.example.com/launch",
 		ResourceLink:  &r2,
 	}
 	err2 := validateLaunchMessage(msg2)
@@ -48,16 +50,19 @@ func TestParser(t *testing.T) {
 	assert.Error(t, err2)
 
 	msg3 := LaunchMessage{
-		Iss:           "present",
+		Iss:           "https://platform.example.com",
 		Aud:           "present",
 		Iat:           1000,
 		Exp:           1000,
 		Nonce:         "present",
-		MessageType:   "LtiResourceRequest",
-		Version:       "1.3",
+		MessageType:   "LtiDeepLinkingRequest",
+		Version:       "1.3.0",
 		DeploymentID:  "present",
-		TargetLinkURI: "present",
+		TargetLinkURI: "https://tool.example.com/launch",
 		// ResourceLink: missing
+		DeepLinkingSettings: &DeepLinkingSettings{
+			DeepLinkReturnURL: "https://platform.example.com/deep_links",
+		},
 	}
 	err3 := validateLaunchMessage(msg3)
 	assert.NoError(t, err3)
@@ -67,18 +72,212 @@ func TestParser(t *testing.T) {
 		Description: "present",
 	}
 	msg4 := LaunchMessage{
-		Iss:           "present",
+		Iss:           "https://platform.example.com",
 		Aud:           "present",
 		Iat:           1000,
 		Exp:           1000,
 		Nonce:         "present",
-		MessageType:   "LtiResourceRequest",
-		Version:       "1.3",
+		MessageType:   "LtiResourceLinkRequest",
+		Version:       "1.3.0",
 		DeploymentID:  "present",
-		TargetLinkURI: "present",
+		TargetLinkURI: "https://tool.example.com/launch",
 		ResourceLink:  &r4,
 	}
 	err4 := validateLaunchMessage(msg4)
 	fmt.Println("err4", err4)
 	assert.Error(t, err4)
 }
+
+func TestValidationReport(t *testing.T) {
+	sub := "user"
+	msg := LaunchMessage{
+		Iss: "platform.example.com",
+		// Aud:        missing,
+		Iat:           1000,
+		Exp:           1000,
+		Nonce:         "present",
+		MessageType:   "LtiResourceLinkRequest",
+		Version:       "1.3",
+		DeploymentID:  "present",
+		TargetLinkURI: "https://tool.example.com/launch",
+		// ResourceLink: missing
+		Sub: &sub,
+		Roles: []string{
+			ContextRoleInstructor,
+			"Learner",
+			"",
+		},
+	}
+
+	report := ValidateLaunchMessage(msg)
+	assert.False(t, report.Valid())
+	assert.Error(t, report.Err())
+
+	paths := []string{}
+	for _, v := range report.Errors() {
+		paths = append(paths, v.Path)
+	}
+	assert.ElementsMatch(t, []string{
+		"aud",
+		"iss",
+		"https://purl.imsglobal.org/spec/lti/claim/version",
+		"https://purl.imsglobal.org/spec/lti/claim/resource_link",
+		"https://purl.imsglobal.org/spec/lti/claim/roles[2]",
+	}, paths)
+
+	warnings := report.Warnings()
+	if assert.Len(t, warnings, 1) {
+		assert.Equal(t, "https://purl.imsglobal.org/spec/lti/claim/roles[1]", warnings[0].Path)
+	}
+
+	msg.Iss = "https://platform.example.com"
+	msg.Aud = "present"
+	msg.Version = "1.3.0"
+	msg.ResourceLink = &ResourceLink{ID: "present"}
+	msg.Roles = []string{ContextRoleInstructor, "Learner"}
+	report = ValidateLaunchMessage(msg)
+	assert.True(t, report.Valid())
+	assert.NoError(t, report.Err())
+
+	msg.MessageType = MessageTypeSubmissionReview
+	report = ValidateLaunchMessage(msg)
+	if assert.Len(t, report.Errors(), 1) {
+		assert.Equal(t, "https://purl.imsglobal.org/spec/lti-ags/claim/endpoint", report.Errors()[0].Path)
+	}
+}
+
+type testPlacement struct {
+	Placement string `json:"placement"`
+}
+
+func TestParseExtensions(t *testing.T) {
+	const placementClaim = "https://www.instructure.com/placement"
+	const vendorClaim = "http://www.example.com/vendor_claim"
+	RegisterExtension(placementClaim, testPlacement{})
+
+	claims := jwt.MapClaims{
+		"iss":   "https://platform.example.com",
+		"aud":   "present",
+		"azp":   "present",
+		"iat":   1000,
+		"exp":   1000,
+		"nonce": "present",
+		"https://purl.imsglobal.org/spec/lti/claim/message_type":    "LtiResourceLinkRequest",
+		"https://purl.imsglobal.org/spec/lti/claim/version":         "1.3.0",
+		"https://purl.imsglobal.org/spec/lti/claim/deployment_id":   "present",
+		"https://purl.imsglobal.org/spec/lti/claim/target_link_uri": "https://tool.example.com/launch",
+		"https://purl.imsglobal.org/spec/lti/claim/resource_link":   map[string]interface{}{"id": "present"},
+		placementClaim: map[string]interface{}{"placement": "assignment_selection"},
+		vendorClaim:    []interface{}{"a", "b"},
+	}
+
+	msg, err := ParseLaunchMessage(claims)
+	assert.NoError(t, err)
+	assert.Len(t, msg.Extensions, 2)
+	assert.False(t, msg.HasExtension("azp"))
+
+	var vendor []string
+	found, err := msg.Extension(vendorClaim, &vendor)
+	assert.True(t, found)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, vendor)
+
+	found, err = msg.Extension("http://www.example.com/missing", &vendor)
+	assert.False(t, found)
+	assert.NoError(t, err)
+
+	decoded, ok := msg.DecodedExtension(placementClaim)
+	if assert.True(t, ok) {
+		assert.Equal(t, &testPlacement{Placement: "assignment_selection"}, decoded)
+	}
+}
+
+// TestParserRejectsPreviouslyAcceptedValues covers the values the original TestParser used, which were accepted
+// before launch messages were checked against the LTI 1.3 value constraints
+func TestParserRejectsPreviouslyAcceptedValues(t *testing.T) {
+	msg := LaunchMessage{
+		Iss:           "present",
+		Aud:           "present",
+		Iat:           1000,
+		Exp:           1000,
+		Nonce:         "present",
+		MessageType:   "LtiResourceRequest",
+		Version:       "1.3",
+		DeploymentID:  "present",
+		TargetLinkURI: "present",
+		ResourceLink:  &ResourceLink{ID: "present", Description: "present"},
+	}
+
+	paths := []string{}
+	for _, v := range ValidateLaunchMessage(msg).Errors() {
+		paths = append(paths, v.Path)
+	}
+	assert.ElementsMatch(t, []string{
+		"iss",
+		"https://purl.imsglobal.org/spec/lti/claim/version",
+		"https://purl.imsglobal.org/spec/lti/claim/target_link_uri",
+	}, paths)
+}
+
+func TestValidateLaunchMessageRules(t *testing.T) {
+	valid := func() LaunchMessage {
+		return LaunchMessage{
+			Iss:           "https://platform.example.com",
+			Aud:           "present",
+			Iat:           1000,
+			Exp:           1000,
+			Nonce:         "present",
+			MessageType:   MessageTypeResourceLink,
+			Version:       "1.3.0",
+			DeploymentID:  "present",
+			TargetLinkURI: "https://tool.example.com/launch",
+			ResourceLink:  &ResourceLink{ID: "present"},
+		}
+	}
+	longSub := strings.Repeat("u", 256)
+	picture := "/avatars/1.png"
+
+	tests := []struct {
+		name   string
+		modify func(*LaunchMessage)
+		path   string // the path of the only error, "" for a valid message
+	}{
+		{"valid", func(*LaunchMessage) {}, ""},
+		{"http issuer", func(m *LaunchMessage) { m.Iss = "http://platform.example.com" }, ""},
+		{"issuer without scheme", func(m *LaunchMessage) { m.Iss = "platform.example.com" }, "iss"},
+		{"issuer with other scheme", func(m *LaunchMessage) { m.Iss = "urn:platform:example" }, "iss"},
+		{"version 1.3", func(m *LaunchMessage) { m.Version = "1.3" }, claimVersion},
+		{"relative target link", func(m *LaunchMessage) { m.TargetLinkURI = "/launch" }, claimTargetLinkURI},
+		{"resource link launch without resource link", func(m *LaunchMessage) { m.ResourceLink = nil }, claimResourceLink},
+		{"deep linking without settings", func(m *LaunchMessage) {
+			m.MessageType = MessageTypeDeepLinking
+			m.ResourceLink = nil
+		}, claimDeepLinkingSettings},
+		{"submission review without endpoint", func(m *LaunchMessage) { m.MessageType = MessageTypeSubmissionReview }, claimEndpoint},
+		{"unknown message type", func(m *LaunchMessage) {
+			m.MessageType = "LtiResourceRequest"
+			m.ResourceLink = nil
+		}, ""},
+		{"long subject", func(m *LaunchMessage) { m.Sub = &longSub }, "sub"},
+		{"relative picture", func(m *LaunchMessage) { m.Picture = &picture }, "picture"},
+		{"relative line items", func(m *LaunchMessage) {
+			m.Endpoint = &AGSEndpoint{LineItems: "lineitems"}
+		}, claimPath(claimEndpoint, "lineitems")},
+		{"empty role", func(m *LaunchMessage) { m.Roles = []string{ContextRoleLearner, ""} }, claimRoles + "[1]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg := valid()
+			test.modify(&msg)
+			errs := ValidateLaunchMessage(msg).Errors()
+			if test.path == "" {
+				assert.Empty(t, errs)
+				return
+			}
+			if assert.Len(t, errs, 1, "%v", errs) {
+				assert.Equal(t, test.path, errs[0].Path)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package lti
+
+import (
+	"strings"
+)
+
+// RoleKind the vocabulary a role belongs to
+type RoleKind string
+
+// Role kinds, as defined in http://www.imsglobal.org/spec/lti/v1p3/#role-vocabularies
+const (
+	// RoleKindUnknown a role from a vocabulary outside of the LTI specification, e.g. a vendor's own role URI
+	RoleKindUnknown     RoleKind = ""
+	RoleKindSystem      RoleKind = "system"
+	RoleKindInstitution RoleKind = "institution"
+	RoleKindContext     RoleKind = "context"
+)
+
+// Role vocabulary prefixes
+const (
+	systemRolePrefix      = "http://purl.imsglobal.org/vocab/lis/v2/system/person#"
+	institutionRolePrefix = "http://purl.imsglobal.org/vocab/lis/v2/institution/person#"
+	contextRolePrefix     = "http://purl.imsglobal.org/vocab/lis/v2/membership"
+	ltiSystemRolePrefix   = "http://purl.imsglobal.org/vocab/lti/system/person#"
+
+	// LTI 1.1 role URNs, still sent by some platforms
+	legacySystemRolePrefix      = "urn:lti:sysrole:ims/lis/"
+	legacyInstitutionRolePrefix = "urn:lti:instrole:ims/lis/"
+	legacyContextRolePrefix     = "urn:lti:role:ims/lis/"
+)
+
+const (
+	// System roles
+
+	// SystemRoleAdministrator http://purl.imsglobal.org/vocab/lis/v2/system/person#Administrator
+	SystemRoleAdministrator = "http://purl.imsglobal.org/vocab/lis/v2/system/person#Administrator"
+	// SystemRoleNone http://purl.imsglobal.org/vocab/lis/v2/system/person#None
+	SystemRoleNone = "http://purl.imsglobal.org/vocab/lis/v2/system/person#None"
+	// SystemRoleAccountAdmin http://purl.imsglobal.org/vocab/lis/v2/system/person#AccountAdmin
+	SystemRoleAccountAdmin = "http://purl.imsglobal.org/vocab/lis/v2/system/person#AccountAdmin"
+	// SystemRoleCreator http://purl.imsglobal.org/vocab/lis/v2/system/person#Creator
+	SystemRoleCreator = "http://purl.imsglobal.org/vocab/lis/v2/system/person#Creator"
+	// SystemRoleSysAdmin http://purl.imsglobal.org/vocab/lis/v2/system/person#SysAdmin
+	SystemRoleSysAdmin = "http://purl.imsglobal.org/vocab/lis/v2/system/person#SysAdmin"
+	// SystemRoleSysSupport http://purl.imsglobal.org/vocab/lis/v2/system/person#SysSupport
+	SystemRoleSysSupport = "http://purl.imsglobal.org/vocab/lis/v2/system/person#SysSupport"
+	// SystemRoleUser http://purl.imsglobal.org/vocab/lis/v2/system/person#User
+	SystemRoleUser = "http://purl.imsglobal.org/vocab/lis/v2/system/person#User"
+	// SystemRoleTestUser http://purl.imsglobal.org/vocab/lti/system/person#TestUser
+	SystemRoleTestUser = "http://purl.imsglobal.org/vocab/lti/system/person#TestUser"
+
+	// Context sub-roles
+
+	// ContextSubRoleTeachingAssistant http://purl.imsglobal.org/vocab/lis/v2/membership/Instructor#TeachingAssistant
+	ContextSubRoleTeachingAssistant = "http://purl.imsglobal.org/vocab/lis/v2/membership/Instructor#TeachingAssistant"
+	// ContextSubRoleGrader http://purl.imsglobal.org/vocab/lis/v2/membership/Instructor#Grader
+	ContextSubRoleGrader = "http://purl.imsglobal.org/vocab/lis/v2/membership/Instructor#Grader"
+	// ContextSubRolePrimaryInstructor http://purl.imsglobal.org/vocab/lis/v2/membership/Instructor#PrimaryInstructor
+	ContextSubRolePrimaryInstructor = "http://purl.imsglobal.org/vocab/lis/v2/membership/Instructor#PrimaryInstructor"
+	// ContextSubRoleSecondaryInstructor http://purl.imsglobal.org/vocab/lis/v2/membership/Instructor#SecondaryInstructor
+	ContextSubRoleSecondaryInstructor = "http://purl.imsglobal.org/vocab/lis/v2/membership/Instructor#SecondaryInstructor"
+	// ContextSubRoleGuestInstructor http://purl.imsglobal.org/vocab/lis/v2/membership/Instructor#GuestInstructor
+	ContextSubRoleGuestInstructor = "http://purl.imsglobal.org/vocab/lis/v2/membership/Instructor#GuestInstructor"
+	// ContextSubRoleExternalInstructor http://purl.imsglobal.org/vocab/lis/v2/membership/Instructor#ExternalInstructor
+	ContextSubRoleExternalInstructor = "http://purl.imsglobal.org/vocab/lis/v2/membership/Instructor#ExternalInstructor"
+	// ContextSubRoleGuestLearner http://purl.imsglobal.org/vocab/lis/v2/membership/Learner#GuestLearner
+	ContextSubRoleGuestLearner = "http://purl.imsglobal.org/vocab/lis/v2/membership/Learner#GuestLearner"
+	// ContextSubRoleNonCreditLearner http://purl.imsglobal.org/vocab/lis/v2/membership/Learner#NonCreditLearner
+	ContextSubRoleNonCreditLearner = "http://purl.imsglobal.org/vocab/lis/v2/membership/Learner#NonCreditLearner"
+	// ContextSubRoleAdvisor http://purl.imsglobal.org/vocab/lis/v2/membership/Mentor#Advisor
+	ContextSubRoleAdvisor = "http://purl.imsglobal.org/vocab/lis/v2/membership/Mentor#Advisor"
+	// ContextSubRoleAuditor http://purl.imsglobal.org/vocab/lis/v2/membership/Mentor#Auditor
+	ContextSubRoleAuditor = "http://purl.imsglobal.org/vocab/lis/v2/membership/Mentor#Auditor"
+	// ContextSubRoleTutor http://purl.imsglobal.org/vocab/lis/v2/membership/Mentor#Tutor
+	ContextSubRoleTutor = "http://purl.imsglobal.org/vocab/lis/v2/membership/Mentor#Tutor"
+	// ContextSubRoleObserver http://purl.imsglobal.org/vocab/lis/v2/membership/Manager#Observer
+	ContextSubRoleObserver = "http://purl.imsglobal.org/vocab/lis/v2/membership/Manager#Observer"
+	// ContextSubRoleSystemAdministrator http://purl.imsglobal.org/vocab/lis/v2/membership/Administrator#SystemAdministrator
+	ContextSubRoleSystemAdministrator = "http://purl.imsglobal.org/vocab/lis/v2/membership/Administrator#SystemAdministrator"
+)
+
+// Role an LTI role, parsed into the vocabulary it belongs to, its principal role and its optional sub-role
+// For example, http://purl.imsglobal.org/vocab/lis/v2/membership/Instructor#TeachingAssistant parses into
+// (RoleKindContext, "Instructor", "TeachingAssistant").
+type Role struct {
+	Kind      RoleKind
+	Principal string
+	SubRole   string
+	// URI the role as it was sent by the platform
+	URI string
+}
+
+// ParseRole parses any form of LTI role: full LTI 1.3 URIs (including sub-roles), deprecated simple names for
+// context roles (e.g. "Instructor"), and LTI 1.1 role URNs. Roles outside of the LTI vocabularies are returned with
+// RoleKindUnknown and the whole value as principal.
+func ParseRole(role string) Role {
+	r := Role{URI: role}
+	s := strings.TrimSpace(role)
+	if strings.HasPrefix(s, "https://purl.imsglobal.org/") {
+		s = "http://" + strings.TrimPrefix(s, "https://")
+	}
+
+	switch {
+	case strings.HasPrefix(s, systemRolePrefix):
+		r.Kind, r.Principal = RoleKindSystem, strings.TrimPrefix(s, systemRolePrefix)
+	case strings.HasPrefix(s, ltiSystemRolePrefix):
+		r.Kind, r.Principal = RoleKindSystem, strings.TrimPrefix(s, ltiSystemRolePrefix)
+	case strings.HasPrefix(s, institutionRolePrefix):
+		r.Kind, r.Principal = RoleKindInstitution, strings.TrimPrefix(s, institutionRolePrefix)
+	case strings.HasPrefix(s, contextRolePrefix+"#"):
+		r.Kind, r.Principal = RoleKindContext, strings.TrimPrefix(s, contextRolePrefix+"#")
+	case strings.HasPrefix(s, contextRolePrefix+"/"):
+		r.Kind = RoleKindContext
+		r.Principal, r.SubRole = splitSubRole(strings.TrimPrefix(s, contextRolePrefix+"/"), "#")
+	case strings.HasPrefix(s, legacySystemRolePrefix):
+		r.Kind, r.Principal = RoleKindSystem, strings.TrimPrefix(s, legacySystemRolePrefix)
+	case strings.HasPrefix(s, legacyInstitutionRolePrefix):
+		r.Kind, r.Principal = RoleKindInstitution, strings.TrimPrefix(s, legacyInstitutionRolePrefix)
+	case strings.HasPrefix(s, legacyContextRolePrefix):
+		r.Kind = RoleKindContext
+		r.Principal, r.SubRole = splitSubRole(strings.TrimPrefix(s, legacyContextRolePrefix), "/")
+	case s != "" && !strings.Contains(s, ":"):
+		// Simple names are only defined for context roles
+		r.Kind = RoleKindContext
+		r.Principal, r.SubRole = splitSubRole(s, "#/")
+	default:
+		r.Principal = s
+		return r
+	}
+
+	// LTI 1.1 defined TeachingAssistant as a context role of its own; it is a sub-role of Instructor in LTI 1.3
+	if r.Kind == RoleKindContext && r.Principal == "TeachingAssistant" && r.SubRole == "" {
+		r.Principal, r.SubRole = "Instructor", "TeachingAssistant"
+	}
+	return r
+}
+
+func splitSubRole(s, separators string) (string, string) {
+	if i := strings.IndexAny(s, separators); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// String returns the canonical LTI 1.3 URI of the role
+func (r Role) String() string {
+	switch r.Kind {
+	case RoleKindSystem:
+		if r.Principal == "TestUser" {
+			return ltiSystemRolePrefix + r.Principal
+		}
+		return systemRolePrefix + r.Principal
+	case RoleKindInstitution:
+		return institutionRolePrefix + r.Principal
+	case RoleKindContext:
+		if r.SubRole != "" {
+			return contextRolePrefix + "/" + r.Principal + "#" + r.SubRole
+		}
+		return contextRolePrefix + "#" + r.Principal
+	default:
+		return r.URI
+	}
+}
+
+// Implies reports whether holding this role also grants the other role
+// Roles are equivalent regardless of the form they were sent in, and a sub-role implies its principal role, so
+// membership/Instructor#TeachingAssistant implies membership#Instructor but not the other way around.
+func (r Role) Implies(other Role) bool {
+	if r.Kind != other.Kind || r.Principal != other.Principal {
+		return false
+	}
+	return other.SubRole == "" || other.SubRole == r.SubRole
+}
+
+// ParsedRoles returns the roles of the message, parsed
+func (rlm LaunchMessage) ParsedRoles() []Role {
+	roles := make([]Role, len(rlm.Roles))
+	for i := range rlm.Roles {
+		roles[i] = ParseRole(rlm.Roles[i])
+	}
+	return roles
+}
+
+// HasImpliedRole check if any role of the message implies the given role
+// Unlike HasRole, roles are compared by meaning rather than exact string, so short names and sub-roles match (see
+// Role.Implies).
+func (rlm LaunchMessage) HasImpliedRole(role string) bool {
+	return rlm.hasImpliedRole(ParseRole(role))
+}
+
+// HasAnyImpliedRole check if any role of the message implies one of the given roles, see HasImpliedRole
+func (rlm LaunchMessage) HasAnyImpliedRole(roles []string) bool {
+	targets := make([]Role, len(roles))
+	for i := range roles {
+		targets[i] = ParseRole(roles[i])
+	}
+	return rlm.hasImpliedRole(targets...)
+}
+
+// hasImpliedRole checks if any role of the message implies one of the given roles
+func (rlm LaunchMessage) hasImpliedRole(targets ...Role) bool {
+	for _, role := range rlm.ParsedRoles() {
+		for _, target := range targets {
+			if role.Implies(target) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsInstructor check if the user is an instructor in the context, including instructor sub-roles such as teaching
+// assistants. Use IsTeachingAssistant to tell teaching assistants apart.
+func (rlm LaunchMessage) IsInstructor() bool {
+	return rlm.hasImpliedRole(ParseRole(ContextRoleInstructor))
+}
+
+// IsTeachingAssistant check if the user is a teaching assistant in the context
+func (rlm LaunchMessage) IsTeachingAssistant() bool {
+	for _, role := range rlm.ParsedRoles() {
+		if role.Kind == RoleKindContext && role.Principal == "Instructor" && strings.HasPrefix(role.SubRole, "TeachingAssistant") {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLearner check if the user is a learner in the context
+func (rlm LaunchMessage) IsLearner() bool {
+	return rlm.hasImpliedRole(ParseRole(ContextRoleLearner))
+}
+
+// IsMentor check if the user is a mentor in the context, e.g. a parent or advisor
+func (rlm LaunchMessage) IsMentor() bool {
+	return rlm.hasImpliedRole(ParseRole(ContextRoleMentor))
+}
+
+// IsContentDeveloper check if the user is a content developer in the context
+func (rlm LaunchMessage) IsContentDeveloper() bool {
+	return rlm.hasImpliedRole(ParseRole(ContextRoleContentDeveloper))
+}
+
+// IsAdmin check if the user is an administrator of the system, the institution or the context
+func (rlm LaunchMessage) IsAdmin() bool {
+	return rlm.hasImpliedRole(
+		ParseRole(SystemRoleAdministrator),
+		ParseRole(SystemRoleSysAdmin),
+		ParseRole(SystemRoleAccountAdmin),
+		ParseRole(InstitutionRoleAdministrator),
+		ParseRole(ContextRoleAdministrator),
+	)
+}
+
+// IsTestUser check if the launch was made by a platform's test user, e.g. "student view"
+func (rlm LaunchMessage) IsTestUser() bool {
+	return rlm.hasImpliedRole(ParseRole(SystemRoleTestUser))
+}
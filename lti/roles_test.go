@@ -0,0 +1,94 @@
+package lti
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRole(t *testing.T) {
+	tests := []struct {
+		in        string
+		kind      RoleKind
+		principal string
+		subRole   string
+		canonical string
+	}{
+		{ContextRoleInstructor, RoleKindContext, "Instructor", "", ContextRoleInstructor},
+		{ContextSubRoleTeachingAssistant, RoleKindContext, "Instructor", "TeachingAssistant", ContextSubRoleTeachingAssistant},
+		{"Instructor", RoleKindContext, "Instructor", "", ContextRoleInstructor},
+		{"Learner", RoleKindContext, "Learner", "", ContextRoleLearner},
+		{"TeachingAssistant", RoleKindContext, "Instructor", "TeachingAssistant", ContextSubRoleTeachingAssistant},
+		{"urn:lti:role:ims/lis/Instructor/TeachingAssistant", RoleKindContext, "Instructor", "TeachingAssistant", ContextSubRoleTeachingAssistant},
+		{"urn:lti:role:ims/lis/Learner", RoleKindContext, "Learner", "", ContextRoleLearner},
+		{"urn:lti:instrole:ims/lis/Administrator", RoleKindInstitution, "Administrator", "", InstitutionRoleAdministrator},
+		{"urn:lti:sysrole:ims/lis/SysAdmin", RoleKindSystem, "SysAdmin", "", SystemRoleSysAdmin},
+		{InstitutionRoleFaculty, RoleKindInstitution, "Faculty", "", InstitutionRoleFaculty},
+		{SystemRoleUser, RoleKindSystem, "User", "", SystemRoleUser},
+		{SystemRoleTestUser, RoleKindSystem, "TestUser", "", SystemRoleTestUser},
+		{"https://purl.imsglobal.org/vocab/lis/v2/membership#Mentor", RoleKindContext, "Mentor", "", ContextRoleMentor},
+		{"http://example.com/roles#Custom", RoleKindUnknown, "http://example.com/roles#Custom", "", "http://example.com/roles#Custom"},
+	}
+
+	for _, tt := range tests {
+		r := ParseRole(tt.in)
+		assert.Equal(t, tt.kind, r.Kind, tt.in)
+		assert.Equal(t, tt.principal, r.Principal, tt.in)
+		assert.Equal(t, tt.subRole, r.SubRole, tt.in)
+		assert.Equal(t, tt.canonical, r.String(), tt.in)
+	}
+}
+
+func TestRoleHelpers(t *testing.T) {
+	ta := LaunchMessage{Roles: []string{ContextSubRoleTeachingAssistant}}
+	assert.True(t, ta.IsInstructor())
+	assert.True(t, ta.IsTeachingAssistant())
+	assert.False(t, ta.IsLearner())
+	assert.True(t, ta.HasImpliedRole(ContextRoleInstructor))
+	assert.False(t, ta.HasRole(ContextRoleInstructor), "HasRole matches exactly")
+	assert.False(t, LaunchMessage{Roles: []string{ContextRoleInstructor}}.HasImpliedRole(ContextSubRoleTeachingAssistant))
+
+	short := LaunchMessage{Roles: []string{"Learner"}}
+	assert.True(t, short.IsLearner())
+	assert.True(t, short.HasImpliedRole(ContextRoleLearner))
+	assert.False(t, short.HasRole(ContextRoleLearner))
+	assert.True(t, short.HasRole("Learner"))
+	assert.False(t, short.IsInstructor())
+
+	admin := LaunchMessage{Roles: []string{InstitutionRoleAdministrator, ContextRoleLearner}}
+	assert.True(t, admin.IsAdmin())
+	assert.True(t, admin.HasAnyImpliedRole([]string{ContextRoleInstructor, "Learner"}))
+	assert.False(t, admin.HasAnyRole([]string{ContextRoleInstructor, "Learner"}))
+	assert.True(t, admin.HasAnyRole([]string{ContextRoleInstructor, ContextRoleLearner}))
+
+	testUser := LaunchMessage{Roles: []string{SystemRoleTestUser, "Learner"}}
+	assert.True(t, testUser.IsTestUser())
+	assert.False(t, testUser.IsAdmin())
+}
+
+func TestMentees(t *testing.T) {
+	mentees := []string{"student-1", "student-2"}
+
+	mentor := LaunchMessage{Roles: []string{ContextSubRoleAdvisor}, RoleScopeMentor: &mentees}
+	assert.Equal(t, mentees, mentor.Mentees())
+
+	notMentor := LaunchMessage{Roles: []string{ContextRoleLearner}, RoleScopeMentor: &mentees}
+	assert.Nil(t, notMentor.Mentees())
+
+	msg, err := ParseLaunchMessage(map[string]interface{}{
+		"iss":   "https://platform.example.com",
+		"aud":   "present",
+		"iat":   1000,
+		"exp":   1000,
+		"nonce": "present",
+		"https://purl.imsglobal.org/spec/lti/claim/message_type":      "LtiResourceLinkRequest",
+		"https://purl.imsglobal.org/spec/lti/claim/version":           "1.3.0",
+		"https://purl.imsglobal.org/spec/lti/claim/deployment_id":     "present",
+		"https://purl.imsglobal.org/spec/lti/claim/target_link_uri":   "https://tool.example.com/launch",
+		"https://purl.imsglobal.org/spec/lti/claim/resource_link":     map[string]interface{}{"id": "present"},
+		"https://purl.imsglobal.org/spec/lti/claim/roles":             []interface{}{ContextRoleMentor},
+		"https://purl.imsglobal.org/spec/lti/claim/role_scope_mentor": []interface{}{"student-1"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"student-1"}, msg.Mentees())
+}
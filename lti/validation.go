@@ -0,0 +1,258 @@
+package lti
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// Severity of a validation violation
+type Severity string
+
+const (
+	// SeverityError a violation that makes the message unusable
+	SeverityError Severity = "error"
+	// SeverityWarning a deviation from the specification that the message can still be used with
+	SeverityWarning Severity = "warning"
+)
+
+// Violation a single problem found in a launch message
+// Path is the JSON claim path of the offending value, with nested fields and array indexes in brackets, e.g.
+// "https://purl.imsglobal.org/spec/lti/claim/resource_link[id]"
+type Violation struct {
+	Path     string
+	Message  string
+	Severity Severity
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s: %s", v.Severity, v.Path, v.Message)
+}
+
+// ValidationReport lists every violation found in a launch message
+// The report is meant to be logged or shown to platform administrators, e.g. while onboarding a new platform.
+type ValidationReport struct {
+	MessageType string
+	Violations  []Violation
+}
+
+// Valid reports whether the message has no error-level violations; warnings are allowed
+func (r *ValidationReport) Valid() bool {
+	return len(r.Errors()) == 0
+}
+
+// Errors returns the error-level violations
+func (r *ValidationReport) Errors() []Violation {
+	return r.filter(SeverityError)
+}
+
+// Warnings returns the warning-level violations
+func (r *ValidationReport) Warnings() []Violation {
+	return r.filter(SeverityWarning)
+}
+
+// Err returns the report as an error if it contains error-level violations, or nil otherwise
+func (r *ValidationReport) Err() error {
+	if r.Valid() {
+		return nil
+	}
+	return r
+}
+
+// Error summarizes the error-level violations on a single line
+func (r *ValidationReport) Error() string {
+	errs := r.Errors()
+	parts := make([]string, len(errs))
+	for i, v := range errs {
+		parts[i] = fmt.Sprintf("%s: %s", v.Path, v.Message)
+	}
+	return fmt.Sprintf("launch message has %d violation(s): %s", len(errs), strings.Join(parts, "; "))
+}
+
+// String lists every violation, one per line
+func (r *ValidationReport) String() string {
+	if len(r.Violations) == 0 {
+		return "launch message is valid"
+	}
+	lines := make([]string, len(r.Violations))
+	for i, v := range r.Violations {
+		lines[i] = v.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *ValidationReport) filter(severity Severity) []Violation {
+	out := []Violation{}
+	for _, v := range r.Violations {
+		if v.Severity == severity {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func (r *ValidationReport) addError(path, format string, a ...interface{}) {
+	r.Violations = append(r.Violations, Violation{Path: path, Message: fmt.Sprintf(format, a...), Severity: SeverityError})
+}
+
+func (r *ValidationReport) addWarning(path, format string, a ...interface{}) {
+	r.Violations = append(r.Violations, Violation{Path: path, Message: fmt.Sprintf(format, a...), Severity: SeverityWarning})
+}
+
+// Claim names used in validation paths
+const (
+	claimMessageType         = "https://purl.imsglobal.org/spec/lti/claim/message_type"
+	claimVersion             = "https://purl.imsglobal.org/spec/lti/claim/version"
+	claimTargetLinkURI       = "https://purl.imsglobal.org/spec/lti/claim/target_link_uri"
+	claimResourceLink        = "https://purl.imsglobal.org/spec/lti/claim/resource_link"
+	claimRoles               = "https://purl.imsglobal.org/spec/lti/claim/roles"
+	claimToolPlatform        = "https://purl.imsglobal.org/spec/lti/claim/tool_platform"
+	claimLaunchPresentation  = "https://purl.imsglobal.org/spec/lti/claim/launch_presentation"
+	claimDeepLinkingSettings = "https://purl.imsglobal.org/spec/lti-dl/claim/deep_linking_settings"
+	claimEndpoint            = "https://purl.imsglobal.org/spec/lti-ags/claim/endpoint"
+	claimNamesRoleService    = "https://purl.imsglobal.org/spec/lti-nrps/claim/namesroleservice"
+)
+
+// Message types with rules of their own
+const (
+	MessageTypeResourceLink     = "LtiResourceLinkRequest"
+	MessageTypeDeepLinking      = "LtiDeepLinkingRequest"
+	MessageTypeSubmissionReview = "LtiSubmissionReviewRequest"
+)
+
+// ValidateLaunchMessage checks a launch message against the LTI 1.3 specification and reports every violation
+// Besides fields tagged as required, it checks rules that depend on the message type and constraints on values
+// such as the version, URL-typed claims and role URIs.
+func ValidateLaunchMessage(msg LaunchMessage) *ValidationReport {
+	report := &ValidationReport{MessageType: msg.MessageType}
+
+	validateRequired(report, reflect.ValueOf(msg), true, "")
+
+	if msg.Version != "" && msg.Version != "1.3.0" {
+		report.addError(claimVersion, "version must be %q, got %q", "1.3.0", msg.Version)
+	}
+
+	switch msg.MessageType {
+	case MessageTypeResourceLink:
+		if msg.ResourceLink == nil {
+			report.addError(claimResourceLink, "is required for %s", msg.MessageType)
+		}
+		if msg.TargetLinkURI == "" {
+			report.addError(claimTargetLinkURI, "is required for %s", msg.MessageType)
+		}
+	case MessageTypeSubmissionReview:
+		if msg.ResourceLink == nil {
+			report.addError(claimResourceLink, "is required for %s", msg.MessageType)
+		}
+		if msg.Endpoint == nil {
+			report.addError(claimEndpoint, "is required for %s", msg.MessageType)
+		}
+	case MessageTypeDeepLinking:
+		if msg.DeepLinkingSettings == nil {
+			report.addError(claimDeepLinkingSettings, "is required for %s", msg.MessageType)
+		} else {
+			if len(msg.DeepLinkingSettings.AcceptTypes) == 0 {
+				report.addWarning(claimPath(claimDeepLinkingSettings, "accept_types"), "should list the accepted content item types")
+			}
+			if len(msg.DeepLinkingSettings.AcceptPresentationDocumentTargets) == 0 {
+				report.addWarning(claimPath(claimDeepLinkingSettings, "accept_presentation_document_targets"), "should list the accepted document targets")
+			}
+		}
+	}
+
+	if msg.Sub != nil && len(*msg.Sub) > 255 {
+		report.addError("sub", "must not be longer than 255 characters")
+	}
+
+	validateURL(report, "iss", msg.Iss)
+	validateURL(report, claimTargetLinkURI, msg.TargetLinkURI)
+	if msg.Picture != nil {
+		validateURL(report, "picture", *msg.Picture)
+	}
+	if msg.ToolPlatform != nil {
+		validateURL(report, claimPath(claimToolPlatform, "url"), msg.ToolPlatform.URL)
+	}
+	if msg.LaunchPresentation != nil {
+		validateURL(report, claimPath(claimLaunchPresentation, "return_url"), msg.LaunchPresentation.ReturnURL)
+	}
+	if msg.DeepLinkingSettings != nil {
+		validateURL(report, claimPath(claimDeepLinkingSettings, "deep_link_return_url"), msg.DeepLinkingSettings.DeepLinkReturnURL)
+	}
+	if msg.Endpoint != nil {
+		validateURL(report, claimPath(claimEndpoint, "lineitem"), msg.Endpoint.LineItem)
+		validateURL(report, claimPath(claimEndpoint, "lineitems"), msg.Endpoint.LineItems)
+	}
+	if msg.NamesRoleService != nil {
+		validateURL(report, claimPath(claimNamesRoleService, "context_memberships_url"), msg.NamesRoleService.ContextMembershipsURL)
+	}
+
+	for i, role := range msg.Roles {
+		path := fmt.Sprintf("%s[%d]", claimRoles, i)
+		switch {
+		case role == "":
+			report.addError(path, "role must not be empty")
+		case !strings.Contains(role, ":"):
+			report.addWarning(path, "simple role name %q is deprecated, a full role URI should be used", role)
+		default:
+			if u, err := url.Parse(role); err != nil || u.Scheme == "" {
+				report.addError(path, "role %q is not a valid URI", role)
+			}
+		}
+	}
+
+	return report
+}
+
+// validateRequired walks the struct fields and reports every required field that is missing
+func validateRequired(report *ValidationReport, v reflect.Value, required bool, path string) {
+	exists := !(!v.IsValid() || v.IsZero())
+
+	if required && !exists {
+		// A field must be present if it's required
+		report.addError(path, "is required")
+		return
+	}
+	if !exists {
+		return
+	}
+
+	t := v.Type()
+
+	// Deference a pointer to a struct
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct {
+		v = v.Elem()
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		st := t.Field(i)
+		name := strings.Split(st.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		validateRequired(report, v.Field(i), st.Tag.Get("required") == "true", claimPath(path, name))
+	}
+}
+
+// validateURL reports a URL-typed claim that is present but not an absolute http(s) URL
+func validateURL(report *ValidationReport, path, value string) {
+	if value == "" {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		report.addError(path, "%q is not an absolute http(s) URL", value)
+	}
+}
+
+func claimPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return fmt.Sprintf("%s[%s]", parent, name)
+}
@@ -0,0 +1,381 @@
+package lti11
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MZDevinc/go-lti/lti"
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxSkew how far the oauth_timestamp of a launch may be from the current time
+const DefaultMaxSkew = 5 * time.Minute
+
+// LTI 1.1 message types
+const (
+	MessageTypeBasicLaunch          = "basic-lti-launch-request"
+	MessageTypeContentItemSelection = "ContentItemSelectionRequest"
+)
+
+// Launch verification errors
+var (
+	ErrUnknownConsumer  = errors.New("unknown oauth_consumer_key")
+	ErrInvalidSignature = errors.New("invalid oauth_signature")
+	ErrNonceReused      = errors.New("oauth_nonce was already used")
+	ErrTimestamp        = errors.New("oauth_timestamp is out of range")
+)
+
+// SecretLookup returns the shared secret of an LTI 1.1 consumer key, or ErrUnknownConsumer
+type SecretLookup func(consumerKey string) (string, error)
+
+// ErrorHandler responds to a launch that failed verification or could not be parsed
+type ErrorHandler func(w http.ResponseWriter, req *http.Request, err error)
+
+// Provider verifies and handles LTI 1.1 launches
+type Provider struct {
+	// Secrets looks up the shared secret of a consumer key
+	Secrets SecretLookup
+	// Nonces records used nonces; a Provider without one does not detect replayed launches
+	Nonces NonceStore
+	// LaunchURL the URL platforms launch, used to verify signatures when the tool runs behind a proxy that rewrites
+	// the request URL. If empty, the URL is derived from the request.
+	LaunchURL string
+	// MaxSkew how far oauth_timestamp may be from the current time; DefaultMaxSkew if zero
+	MaxSkew time.Duration
+	// Now returns the current time; time.Now if nil
+	Now func() time.Time
+	// ErrorHandler responds to failed launches; DefaultErrorHandler if nil
+	ErrorHandler ErrorHandler
+	// Debug receives debug messages, such as why a launch failed; nil discards them
+	Debug func(format string, args ...interface{})
+}
+
+// NewProvider returns a Provider looking up secrets with the given function and keeping nonces in memory
+func NewProvider(secrets SecretLookup) *Provider {
+	return &Provider{
+		Secrets: secrets,
+		Nonces:  NewMemoryNonceStore(),
+	}
+}
+
+// StaticSecrets returns a SecretLookup for a fixed map of consumer keys to secrets
+func StaticSecrets(secrets map[string]string) SecretLookup {
+	return func(consumerKey string) (string, error) {
+		secret, ok := secrets[consumerKey]
+		if !ok {
+			return "", ErrUnknownConsumer
+		}
+		return secret, nil
+	}
+}
+
+// DefaultErrorHandler responds 401 to failed verification and 400 to any other error, without revealing details
+func DefaultErrorHandler(w http.ResponseWriter, req *http.Request, err error) {
+	switch errors.Cause(err) {
+	case ErrUnknownConsumer, ErrInvalidSignature, ErrNonceReused, ErrTimestamp:
+		http.Error(w, "The LTI launch could not be verified.", http.StatusUnauthorized)
+	default:
+		http.Error(w, "The LTI launch request is invalid.", http.StatusBadRequest)
+	}
+}
+
+// GetLaunchHandler returns an http.Handler that verifies LTI 1.1 launches and calls the callback with the launch
+// converted to an lti.LaunchMessage (see ParseLaunchParams), with the launched URL as TargetLinkURI
+func (p *Provider) GetLaunchHandler(callback func(lti.LaunchMessage)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		params, err := p.Verify(req)
+		if err == nil {
+			var msg lti.LaunchMessage
+			if msg, err = ParseLaunchParams(params); err == nil {
+				msg.TargetLinkURI = p.requestURL(req)
+				callback(msg)
+				return
+			}
+		}
+
+		p.debug("LTI 1.1 launch failed: %v", err)
+		handler := p.ErrorHandler
+		if handler == nil {
+			handler = DefaultErrorHandler
+		}
+		handler(w, req, err)
+	})
+}
+
+// Verify checks the OAuth 1.0a signature, timestamp and nonce of a launch and returns its form parameters
+func (p *Provider) Verify(req *http.Request) (url.Values, error) {
+	if req.Method != http.MethodPost {
+		return nil, errors.Errorf("LTI 1.1 launches must be POST requests, got %s", req.Method)
+	}
+	if err := req.ParseForm(); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse launch form")
+	}
+	params := req.PostForm
+
+	for _, name := range []string{ParamConsumerKey, ParamNonce, ParamSignature, ParamTimestamp} {
+		if params.Get(name) == "" {
+			return nil, errors.Errorf("Launch is missing %s", name)
+		}
+	}
+	if method := params.Get(ParamSignatureMethod); method != SignatureMethodHMACSHA1 {
+		return nil, errors.Errorf("Unsupported oauth_signature_method %q", method)
+	}
+	if version := params.Get(ParamVersion); version != "" && version != "1.0" {
+		return nil, errors.Errorf("Unsupported oauth_version %q", version)
+	}
+
+	timestamp, err := strconv.ParseInt(params.Get(ParamTimestamp), 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(ErrTimestamp, "oauth_timestamp is not a number")
+	}
+	ts := time.Unix(timestamp, 0)
+	skew := p.maxSkew()
+	if d := p.now().Sub(ts); d > skew || d < -skew {
+		return nil, errors.Wrapf(ErrTimestamp, "oauth_timestamp is %s off", d)
+	}
+
+	consumerKey := params.Get(ParamConsumerKey)
+	if p.Secrets == nil {
+		return nil, ErrUnknownConsumer
+	}
+	secret, err := p.Secrets(consumerKey)
+	if err != nil {
+		return nil, err
+	}
+
+	expected, err := Sign(req.Method, p.requestURL(req), params, secret)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(expected), []byte(params.Get(ParamSignature))) {
+		return nil, ErrInvalidSignature
+	}
+
+	// Nonces are only recorded for verified launches, so forged requests can't use them up
+	if p.Nonces != nil {
+		fresh, err := p.Nonces.Use(consumerKey, params.Get(ParamNonce), ts.Add(skew))
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to record oauth_nonce")
+		}
+		if !fresh {
+			return nil, ErrNonceReused
+		}
+	}
+
+	return params, nil
+}
+
+func (p *Provider) debug(format string, args ...interface{}) {
+	if p.Debug != nil {
+		p.Debug(format, args...)
+	}
+}
+
+func (p *Provider) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+	return time.Now()
+}
+
+func (p *Provider) maxSkew() time.Duration {
+	if p.MaxSkew > 0 {
+		return p.MaxSkew
+	}
+	return DefaultMaxSkew
+}
+
+// requestURL returns the URL the platform signed, including the query string
+func (p *Provider) requestURL(req *http.Request) string {
+	base := p.LaunchURL
+	if base == "" {
+		scheme := "http"
+		if req.TLS != nil {
+			scheme = "https"
+		}
+		if proto := req.Header.Get("X-Forwarded-Proto"); proto != "" {
+			scheme = strings.ToLower(strings.TrimSpace(strings.Split(proto, ",")[0]))
+		}
+		base = scheme + "://" + req.Host + req.URL.EscapedPath()
+	}
+	if req.URL.RawQuery != "" {
+		if strings.Contains(base, "?") {
+			return base + "&" + req.URL.RawQuery
+		}
+		return base + "?" + req.URL.RawQuery
+	}
+	return base
+}
+
+// ParseLaunchParams converts the parameters of an LTI 1.1 launch to the LTI 1.3 launch message shape
+// Basic launches become LtiResourceLinkRequest messages and content item selection requests become
+// LtiDeepLinkingRequest messages. The consumer key is used as both audience and deployment ID, the lti_version is kept
+// as Version, and Iat is the OAuth timestamp. Roles are converted to LTI 1.3 role URIs. custom_ parameters are
+// returned as Custom without their prefix, ext_ parameters as Extensions, and the LTI1p1 claim holds the LTI 1.1
+// identifiers.
+func ParseLaunchParams(params url.Values) (lti.LaunchMessage, error) {
+	msg := lti.LaunchMessage{
+		Iss:          params.Get("tool_consumer_instance_guid"),
+		Aud:          params.Get(ParamConsumerKey),
+		Nonce:        params.Get(ParamNonce),
+		Version:      params.Get("lti_version"),
+		DeploymentID: params.Get(ParamConsumerKey),
+	}
+	if ts, err := strconv.Atoi(params.Get(ParamTimestamp)); err == nil {
+		msg.Iat = ts
+	}
+
+	switch messageType := params.Get("lti_message_type"); messageType {
+	case MessageTypeBasicLaunch:
+		msg.MessageType = lti.MessageTypeResourceLink
+		if params.Get("resource_link_id") == "" {
+			return msg, errors.New("Launch is missing resource_link_id")
+		}
+	case MessageTypeContentItemSelection:
+		msg.MessageType = lti.MessageTypeDeepLinking
+		if params.Get("content_item_return_url") == "" {
+			return msg, errors.New("Launch is missing content_item_return_url")
+		}
+		msg.DeepLinkingSettings = &lti.DeepLinkingSettings{
+			DeepLinkReturnURL:                 params.Get("content_item_return_url"),
+			AcceptMediaTypes:                  params.Get("accept_media_types"),
+			AcceptPresentationDocumentTargets: splitList(params.Get("accept_presentation_document_targets")),
+			AcceptMultiple:                    params.Get("accept_multiple") == "true",
+			AutoCreate:                        params.Get("auto_create") == "true",
+			Title:                             params.Get("title"),
+			Text:                              params.Get("text"),
+			Data:                              params.Get("data"),
+		}
+	default:
+		return msg, errors.Errorf("Unsupported lti_message_type %q", messageType)
+	}
+
+	if id := params.Get("resource_link_id"); id != "" {
+		msg.ResourceLink = &lti.ResourceLink{
+			ID:          id,
+			Title:       params.Get("resource_link_title"),
+			Description: params.Get("resource_link_description"),
+		}
+	}
+
+	msg.Sub = optional(params, "user_id")
+	msg.GivenName = optional(params, "lis_person_name_given")
+	msg.FamilyName = optional(params, "lis_person_name_family")
+	msg.Name = optional(params, "lis_person_name_full")
+	msg.Email = optional(params, "lis_person_contact_email_primary")
+	msg.Picture = optional(params, "user_image")
+	msg.Locale = optional(params, "launch_presentation_locale")
+
+	msg.Roles = []string{}
+	for _, role := range splitList(params.Get("roles")) {
+		msg.Roles = append(msg.Roles, lti.ParseRole(role).String())
+	}
+	if mentees := splitList(params.Get("role_scope_mentor")); len(mentees) > 0 {
+		msg.RoleScopeMentor = &mentees
+	}
+
+	if id := params.Get("context_id"); id != "" {
+		msg.Context = &lti.Context{
+			ID:    id,
+			Label: params.Get("context_label"),
+			Title: params.Get("context_title"),
+		}
+		for _, t := range splitList(params.Get("context_type")) {
+			msg.Context.Type = append(msg.Context.Type, contextType(t))
+		}
+	}
+
+	if guid := params.Get("tool_consumer_instance_guid"); guid != "" {
+		msg.ToolPlatform = &lti.ToolPlatform{
+			GUID:              guid,
+			Name:              params.Get("tool_consumer_instance_name"),
+			Description:       params.Get("tool_consumer_instance_description"),
+			URL:               params.Get("tool_consumer_instance_url"),
+			ContactEmail:      params.Get("tool_consumer_instance_contact_email"),
+			ProductFamilyCode: params.Get("tool_consumer_info_product_family_code"),
+			Version:           params.Get("tool_consumer_info_version"),
+		}
+	}
+
+	presentation := lti.LaunchPresentation{
+		DocumentTarget: params.Get("launch_presentation_document_target"),
+		ReturnURL:      params.Get("launch_presentation_return_url"),
+		Locale:         params.Get("launch_presentation_locale"),
+	}
+	presentation.Width, _ = strconv.Atoi(params.Get("launch_presentation_width"))
+	presentation.Height, _ = strconv.Atoi(params.Get("launch_presentation_height"))
+	if presentation != (lti.LaunchPresentation{}) {
+		msg.LaunchPresentation = &presentation
+	}
+
+	lis := lti.LIS{
+		CourseOfferingSourcedID: params.Get("lis_course_offering_sourcedid"),
+		CourseSectionSourcedID:  params.Get("lis_course_section_sourcedid"),
+		OutcomeServiceURL:       params.Get("lis_outcome_service_url"),
+		PersonSourcedID:         params.Get("lis_person_sourcedid"),
+		ResultSourcedID:         params.Get("lis_result_sourcedid"),
+	}
+	if lis != (lti.LIS{}) {
+		msg.LIS = &lis
+	}
+
+	custom := map[string]interface{}{}
+	for key := range params {
+		switch {
+		case strings.HasPrefix(key, "custom_"):
+			custom[strings.TrimPrefix(key, "custom_")] = params.Get(key)
+		case strings.HasPrefix(key, "ext_"):
+			raw, err := json.Marshal(params.Get(key))
+			if err != nil {
+				return msg, errors.Wrapf(err, "Failed to serialize %s", key)
+			}
+			if msg.Extensions == nil {
+				msg.Extensions = map[string]json.RawMessage{}
+			}
+			msg.Extensions[key] = raw
+		}
+	}
+	if len(custom) > 0 {
+		msg.Custom = &custom
+	}
+
+	msg.LTI1p1 = &lti.LTI1p1{
+		UserID:           params.Get("user_id"),
+		OAuthConsumerKey: params.Get(ParamConsumerKey),
+		ResourceLinkID:   params.Get("resource_link_id"),
+	}
+
+	return msg, nil
+}
+
+// contextType converts an LTI 1.1 context type, either a simple name or a URN, to its LTI 1.3 URI
+func contextType(t string) string {
+	name := strings.TrimPrefix(t, "urn:lti:context-type:ims/lis/")
+	switch name {
+	case "CourseTemplate", "CourseOffering", "CourseSection", "Group":
+		return "http://purl.imsglobal.org/vocab/lis/v2/course#" + name
+	}
+	return t
+}
+
+func optional(params url.Values, name string) *string {
+	if value := params.Get(name); value != "" {
+		return &value
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	out := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,165 @@
+package lti11
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MZDevinc/go-lti/lti"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testConsumerKey = "consumer-key"
+	testSecret      = "consumer-secret"
+	testLaunchURL   = "https://tool.example.com/lti11/launch"
+)
+
+func launchParams(nonce string, ts time.Time) url.Values {
+	return url.Values{
+		"lti_message_type":                 {MessageTypeBasicLaunch},
+		"lti_version":                      {"LTI-1p0"},
+		"resource_link_id":                 {"link-1"},
+		"resource_link_title":              {"Week 1 Quiz"},
+		"user_id":                          {"user-11"},
+		"roles":                            {"Instructor,urn:lti:instrole:ims/lis/Faculty"},
+		"lis_person_name_full":             {"Jane Teacher"},
+		"lis_person_contact_email_primary": {"jane@example.edu"},
+		"context_id":                       {"course-1"},
+		"context_type":                     {"CourseSection"},
+		"context_title":                    {"Biology"},
+		"tool_consumer_instance_guid":      {"lms.example.edu"},
+		"lis_outcome_service_url":          {"https://lms.example.edu/outcomes"},
+		"lis_result_sourcedid":             {"result-1"},
+		"launch_presentation_width":        {"800"},
+		"custom_chapter":                   {"3"},
+		"ext_lms":                          {"example"},
+		"oauth_callback":                   {"about:blank"},
+		ParamConsumerKey:                   {testConsumerKey},
+		ParamNonce:                         {nonce},
+		ParamSignatureMethod:               {SignatureMethodHMACSHA1},
+		ParamTimestamp:                     {strconv.FormatInt(ts.Unix(), 10)},
+		ParamVersion:                       {"1.0"},
+	}
+}
+
+func signedLaunch(t *testing.T, params url.Values, secret string) *http.Request {
+	signature, err := Sign("POST", testLaunchURL, params, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params.Set(ParamSignature, signature)
+
+	req := httptest.NewRequest("POST", "/lti11/launch", strings.NewReader(params.Encode()))
+	req.Host = "tool.example.com"
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	return req
+}
+
+func TestLaunchHandler(t *testing.T) {
+	provider := NewProvider(StaticSecrets(map[string]string{testConsumerKey: testSecret}))
+
+	var launched *lti.LaunchMessage
+	handler := provider.GetLaunchHandler(func(msg lti.LaunchMessage) {
+		launched = &msg
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, signedLaunch(t, launchParams("nonce-1", time.Now()), testSecret))
+	if !assert.NotNil(t, launched, w.Body.String()) {
+		return
+	}
+	msg := *launched
+	assert.Equal(t, lti.MessageTypeResourceLink, msg.MessageType)
+	assert.Equal(t, "LTI-1p0", msg.Version)
+	assert.Equal(t, testConsumerKey, msg.DeploymentID)
+	assert.Equal(t, testLaunchURL, msg.TargetLinkURI)
+	assert.Equal(t, "link-1", msg.ResourceLink.ID)
+	assert.Equal(t, "user-11", *msg.Sub)
+	assert.Equal(t, "Jane Teacher", *msg.Name)
+	assert.Equal(t, []string{lti.ContextRoleInstructor, lti.InstitutionRoleFaculty}, msg.Roles)
+	assert.True(t, msg.IsInstructor())
+	assert.Equal(t, []string{"http://purl.imsglobal.org/vocab/lis/v2/course#CourseSection"}, msg.Context.Type)
+	assert.Equal(t, "lms.example.edu", msg.ToolPlatform.GUID)
+	assert.Equal(t, 800, msg.LaunchPresentation.Width)
+	assert.Equal(t, map[string]interface{}{"chapter": "3"}, *msg.Custom)
+	assert.True(t, msg.HasExtension("ext_lms"))
+	assert.Equal(t, &lti.LTI1p1{UserID: "user-11", OAuthConsumerKey: testConsumerKey, ResourceLinkID: "link-1"}, msg.LTI1p1)
+
+	serviceURL, sourcedID, ok := LaunchOutcome(msg)
+	assert.True(t, ok)
+	assert.Equal(t, "https://lms.example.edu/outcomes", serviceURL)
+	assert.Equal(t, "result-1", sourcedID)
+}
+
+func TestLaunchHandlerRejects(t *testing.T) {
+	provider := NewProvider(StaticSecrets(map[string]string{testConsumerKey: testSecret}))
+	verify := func(req *http.Request) error {
+		_, err := provider.Verify(req)
+		return err
+	}
+
+	assert.NoError(t, verify(signedLaunch(t, launchParams("nonce-replay", time.Now()), testSecret)))
+	assert.Equal(t, ErrNonceReused, verify(signedLaunch(t, launchParams("nonce-replay", time.Now()), testSecret)))
+
+	assert.Equal(t, ErrInvalidSignature, verify(signedLaunch(t, launchParams("nonce-2", time.Now()), "wrong-secret")))
+
+	tampered := signedLaunch(t, launchParams("nonce-3", time.Now()), testSecret)
+	tampered.Header.Set("X-Forwarded-Proto", "http")
+	assert.Equal(t, ErrInvalidSignature, verify(tampered))
+
+	stale := launchParams("nonce-4", time.Now().Add(-time.Hour))
+	err := verify(signedLaunch(t, stale, testSecret))
+	assert.Error(t, err)
+
+	unknown := launchParams("nonce-5", time.Now())
+	unknown.Set(ParamConsumerKey, "other-key")
+	assert.Equal(t, ErrUnknownConsumer, verify(signedLaunch(t, unknown, testSecret)))
+
+	plaintext := launchParams("nonce-6", time.Now())
+	plaintext.Set(ParamSignatureMethod, "PLAINTEXT")
+	assert.Error(t, verify(signedLaunch(t, plaintext, testSecret)))
+
+	// A forged launch must not use up the nonce of a later legitimate one
+	assert.NoError(t, verify(signedLaunch(t, launchParams("nonce-2", time.Now()), testSecret)))
+
+	var debugged []string
+	provider.Debug = func(format string, args ...interface{}) {
+		debugged = append(debugged, fmt.Sprintf(format, args...))
+	}
+	w := httptest.NewRecorder()
+	provider.GetLaunchHandler(func(lti.LaunchMessage) {
+		t.Fatal("callback reached for a forged launch")
+	}).ServeHTTP(w, signedLaunch(t, launchParams("nonce-7", time.Now()), "wrong-secret"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, []string{"LTI 1.1 launch failed: " + ErrInvalidSignature.Error()}, debugged)
+}
+
+func TestParseLaunchParams(t *testing.T) {
+	params := launchParams("nonce", time.Now())
+	params.Set("lti_message_type", MessageTypeContentItemSelection)
+	params.Set("content_item_return_url", "https://lms.example.edu/return")
+	params.Set("accept_multiple", "true")
+	params.Set("data", "opaque")
+	msg, err := ParseLaunchParams(params)
+	assert.NoError(t, err)
+	assert.Equal(t, lti.MessageTypeDeepLinking, msg.MessageType)
+	assert.Equal(t, "https://lms.example.edu/return", msg.DeepLinkingSettings.DeepLinkReturnURL)
+	assert.True(t, msg.DeepLinkingSettings.AcceptMultiple)
+	assert.Equal(t, "opaque", msg.DeepLinkingSettings.Data)
+
+	params.Set("lti_message_type", "ToolProxyRegistrationRequest")
+	_, err = ParseLaunchParams(params)
+	assert.Error(t, err)
+
+	params = launchParams("nonce", time.Now())
+	params.Del("resource_link_id")
+	_, err = ParseLaunchParams(params)
+	assert.Error(t, err)
+}
@@ -0,0 +1,45 @@
+package lti11
+
+import (
+	"sync"
+	"time"
+)
+
+// NonceStore remembers the OAuth nonces of verified requests, so a captured launch cannot be replayed
+type NonceStore interface {
+	// Use records the nonce for the consumer key and reports whether it was unused
+	// The nonce can be forgotten after expires, when the request timestamp would no longer be accepted anyway.
+	Use(consumerKey, nonce string, expires time.Time) (bool, error)
+}
+
+// MemoryNonceStore a NonceStore kept in memory
+// It is only suitable for a tool running in a single process.
+type MemoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+// NewMemoryNonceStore returns an empty MemoryNonceStore
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: map[string]time.Time{}}
+}
+
+// Use records the nonce and reports whether it was unused, forgetting expired nonces
+func (s *MemoryNonceStore) Use(consumerKey, nonce string, expires time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, exp := range s.nonces {
+		if exp.Before(now) {
+			delete(s.nonces, key)
+		}
+	}
+
+	key := consumerKey + "\x00" + nonce
+	if _, used := s.nonces[key]; used {
+		return false, nil
+	}
+	s.nonces[key] = expires
+	return true, nil
+}
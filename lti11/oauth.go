@@ -0,0 +1,134 @@
+// Package lti11 supports legacy LTI 1.1 launches, signed with OAuth 1.0a HMAC-SHA1, and the LTI 1.1 Basic Outcomes
+// service, so a tool can serve LTI 1.1 and LTI 1.3 platforms from one codebase
+// See https://www.imsglobal.org/specs/ltiv1p1/implementation-guide
+package lti11
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// OAuth parameter names
+const (
+	ParamConsumerKey     = "oauth_consumer_key"
+	ParamNonce           = "oauth_nonce"
+	ParamSignature       = "oauth_signature"
+	ParamSignatureMethod = "oauth_signature_method"
+	ParamTimestamp       = "oauth_timestamp"
+	ParamVersion         = "oauth_version"
+	ParamCallback        = "oauth_callback"
+	ParamBodyHash        = "oauth_body_hash"
+
+	// SignatureMethodHMACSHA1 the only signature method LTI 1.1 requires
+	SignatureMethodHMACSHA1 = "HMAC-SHA1"
+)
+
+// Sign computes the OAuth 1.0a HMAC-SHA1 signature of a request
+// params holds every form and query parameter of the request and the oauth_* protocol parameters; any
+// oauth_signature in it is ignored. LTI does not use access tokens, so the signing key is the consumer secret alone.
+func Sign(method, rawURL string, params url.Values, consumerSecret string) (string, error) {
+	return sign(method, rawURL, params, consumerSecret, "")
+}
+
+func sign(method, rawURL string, params url.Values, consumerSecret, tokenSecret string) (string, error) {
+	base, err := SignatureBaseString(method, rawURL, params)
+	if err != nil {
+		return "", err
+	}
+
+	key := percentEncode(consumerSecret) + "&" + percentEncode(tokenSecret)
+	mac := hmac.New(sha1.New, []byte(key))
+	mac.Write([]byte(base))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// SignatureBaseString builds the OAuth 1.0a signature base string of a request, as defined by RFC 5849 section 3.4.1
+// Query parameters of rawURL are added to params.
+func SignatureBaseString(method, rawURL string, params url.Values) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("Invalid request URL %q: %v", rawURL, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("Request URL %q is not absolute", rawURL)
+	}
+
+	all := url.Values{}
+	for key, values := range u.Query() {
+		all[key] = append(all[key], values...)
+	}
+	for key, values := range params {
+		if key == ParamSignature {
+			continue
+		}
+		all[key] = append(all[key], values...)
+	}
+
+	return strings.Join([]string{
+		strings.ToUpper(method),
+		percentEncode(baseStringURI(u)),
+		percentEncode(normalizeParameters(all)),
+	}, "&"), nil
+}
+
+// baseStringURI returns the URL without query or fragment, with lowercase scheme and host and without a default port
+func baseStringURI(u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if port != "" && !(scheme == "http" && port == "80") && !(scheme == "https" && port == "443") {
+		host = host + ":" + port
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	return scheme + "://" + host + path
+}
+
+// normalizeParameters encodes every parameter and sorts them by name, then value
+func normalizeParameters(params url.Values) string {
+	pairs := []string{}
+	for key, values := range params {
+		for _, value := range values {
+			pairs = append(pairs, percentEncode(key)+"="+percentEncode(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// percentEncode encodes a string as RFC 5849 section 3.6 requires, leaving only unreserved characters as they are
+func percentEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// authorizationHeader formats OAuth protocol parameters as an Authorization header value
+func authorizationHeader(params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf(`%s="%s"`, percentEncode(key), percentEncode(params.Get(key)))
+	}
+	return "OAuth " + strings.Join(parts, ", ")
+}
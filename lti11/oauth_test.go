@@ -0,0 +1,37 @@
+package lti11
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSign uses the example from https://developer.twitter.com/en/docs/authentication/oauth-1-0a/creating-a-signature
+func TestSign(t *testing.T) {
+	params := url.Values{
+		"status":                 {"Hello Ladies + Gentlemen, a signed OAuth request!"},
+		"oauth_consumer_key":     {"xvz1evFS4wEEPTGEFPHBog"},
+		"oauth_nonce":            {"kYjzVBB8Y0ZFabxSWbWovY3uYSQ2pTgmZeNu2VS4cg"},
+		"oauth_signature_method": {"HMAC-SHA1"},
+		"oauth_timestamp":        {"1318622958"},
+		"oauth_token":            {"370773112-GmHxMAgYyLbNEtIKZeRNFsMKPR9EyMZeS9weJAEb"},
+		"oauth_version":          {"1.0"},
+		"oauth_signature":        {"ignored"},
+	}
+	signature, err := sign("post", "https://API.twitter.com:443/1/statuses/update.json?include_entities=true", params,
+		"kAcSOqF21Fu85e7zjz7ZN2U4ZRhfV3WpwPAoE3Z7kBw", "LswwdoUaIvS8ltyTt5jkRh4J50vUPVVHtR2YPi5kE")
+	assert.NoError(t, err)
+	assert.Equal(t, "tnnArxj06cWHq44gCs1OSKk/jLY=", signature)
+
+	_, err = Sign("POST", "/relative", params, "secret")
+	assert.Error(t, err)
+}
+
+func TestPercentEncode(t *testing.T) {
+	assert.Equal(t, "Ladies%20%2B%20Gentlemen", percentEncode("Ladies + Gentlemen"))
+	assert.Equal(t, "An%20encoded%20string%21", percentEncode("An encoded string!"))
+	assert.Equal(t, "Dogs%2C%20Cats%20%26%20Mice", percentEncode("Dogs, Cats & Mice"))
+	assert.Equal(t, "%E2%98%83", percentEncode("☃"))
+	assert.Equal(t, "-._~", percentEncode("-._~"))
+}
@@ -0,0 +1,240 @@
+package lti11
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MZDevinc/go-lti/lti"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// poxNamespace the XML namespace of LTI 1.1 Basic Outcomes messages
+const poxNamespace = "http://www.imsglobal.org/services/ltiv1p1/xsd/imsoms_v1p0"
+
+// Basic Outcomes operations
+const (
+	OperationReplaceResult = "replaceResult"
+	OperationReadResult    = "readResult"
+	OperationDeleteResult  = "deleteResult"
+)
+
+// OutcomeError is returned when the platform does not report success for an outcomes request
+type OutcomeError struct {
+	Operation   string
+	CodeMajor   string
+	Description string
+}
+
+func (e *OutcomeError) Error() string {
+	return fmt.Sprintf("%s failed with %s: %s", e.Operation, e.CodeMajor, e.Description)
+}
+
+// OutcomesClient sends LTI 1.1 Basic Outcomes requests, signed with the consumer key and secret of the launch
+// See https://www.imsglobal.org/specs/ltiv1p1/implementation-guide#toc-26
+type OutcomesClient struct {
+	ConsumerKey string
+	Secret      string
+	HTTPClient  *http.Client
+}
+
+// NewOutcomesClient returns an OutcomesClient for the given consumer
+func NewOutcomesClient(consumerKey, secret string) *OutcomesClient {
+	return &OutcomesClient{
+		ConsumerKey: consumerKey,
+		Secret:      secret,
+		HTTPClient:  &http.Client{Timeout: time.Second * 30},
+	}
+}
+
+// LaunchOutcome returns the outcome service URL and result sourcedid of a launch
+// The third value is false if the platform did not ask for an outcome for this launch.
+func LaunchOutcome(msg lti.LaunchMessage) (serviceURL, sourcedID string, ok bool) {
+	if msg.LIS == nil || msg.LIS.OutcomeServiceURL == "" || msg.LIS.ResultSourcedID == "" {
+		return "", "", false
+	}
+	return msg.LIS.OutcomeServiceURL, msg.LIS.ResultSourcedID, true
+}
+
+// ReplaceResult sets the score of a result, between 0 and 1
+func (c *OutcomesClient) ReplaceResult(serviceURL, sourcedID string, score float64) error {
+	if score < 0 || score > 1 {
+		return fmt.Errorf("Score must be between 0 and 1, got %v", score)
+	}
+	record := poxResultRecord{
+		SourcedID: sourcedID,
+		Result: &poxResult{ResultScore: poxResultScore{
+			Language:   "en",
+			TextString: strconv.FormatFloat(score, 'f', -1, 64),
+		}},
+	}
+	_, err := c.send(serviceURL, poxRequestBody{ReplaceResult: &poxResultRequest{ResultRecord: record}}, OperationReplaceResult)
+	return err
+}
+
+// ReadResult returns the score of a result
+// The second value is false if the result has no score yet.
+func (c *OutcomesClient) ReadResult(serviceURL, sourcedID string) (float64, bool, error) {
+	record := poxResultRecord{SourcedID: sourcedID}
+	resp, err := c.send(serviceURL, poxRequestBody{ReadResult: &poxResultRequest{ResultRecord: record}}, OperationReadResult)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if resp.Body.ReadResult == nil {
+		return 0, false, nil
+	}
+	text := strings.TrimSpace(resp.Body.ReadResult.ResultScore.TextString)
+	if text == "" {
+		return 0, false, nil
+	}
+	score, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "Platform returned an invalid score %q", text)
+	}
+	return score, true, nil
+}
+
+// DeleteResult removes the score of a result
+func (c *OutcomesClient) DeleteResult(serviceURL, sourcedID string) error {
+	record := poxResultRecord{SourcedID: sourcedID}
+	_, err := c.send(serviceURL, poxRequestBody{DeleteResult: &poxResultRequest{ResultRecord: record}}, OperationDeleteResult)
+	return err
+}
+
+// send signs and posts a POX request and checks the status of the response
+func (c *OutcomesClient) send(serviceURL string, body poxRequestBody, operation string) (*poxResponse, error) {
+	envelope := poxRequest{
+		Xmlns: poxNamespace,
+		Header: poxRequestHeader{
+			Version:           "V1.0",
+			MessageIdentifier: uuid.NewV4().String(),
+		},
+		Body: body,
+	}
+	payload, err := xml.Marshal(envelope)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to serialize %s request", operation)
+	}
+	payload = append([]byte(xml.Header), payload...)
+
+	authorization, err := c.authorization(serviceURL, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", serviceURL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to create %s request", operation)
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Authorization", authorization)
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to send %s request", operation)
+	}
+	defer response.Body.Close()
+
+	respBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read %s response", operation)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s request failed with status %s: %s", operation, response.Status, respBody)
+	}
+
+	resp := &poxResponse{}
+	if err := xml.Unmarshal(respBody, resp); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse %s response", operation)
+	}
+	status := resp.Header.StatusInfo
+	if status.CodeMajor != "success" {
+		return nil, &OutcomeError{Operation: operation, CodeMajor: status.CodeMajor, Description: status.Description}
+	}
+	return resp, nil
+}
+
+// authorization returns the OAuth Authorization header for a POX request, with the body hash of the payload
+func (c *OutcomesClient) authorization(serviceURL string, payload []byte) (string, error) {
+	hash := sha1.Sum(payload)
+	params := url.Values{}
+	params.Set(ParamBodyHash, base64.StdEncoding.EncodeToString(hash[:]))
+	params.Set(ParamConsumerKey, c.ConsumerKey)
+	params.Set(ParamNonce, uuid.NewV4().String())
+	params.Set(ParamSignatureMethod, SignatureMethodHMACSHA1)
+	params.Set(ParamTimestamp, strconv.FormatInt(time.Now().Unix(), 10))
+	params.Set(ParamVersion, "1.0")
+
+	signature, err := Sign("POST", serviceURL, params, c.Secret)
+	if err != nil {
+		return "", err
+	}
+	params.Set(ParamSignature, signature)
+	return authorizationHeader(params), nil
+}
+
+type poxRequest struct {
+	XMLName xml.Name         `xml:"imsx_POXEnvelopeRequest"`
+	Xmlns   string           `xml:"xmlns,attr"`
+	Header  poxRequestHeader `xml:"imsx_POXHeader>imsx_POXRequestHeaderInfo"`
+	Body    poxRequestBody   `xml:"imsx_POXBody"`
+}
+
+type poxRequestHeader struct {
+	Version           string `xml:"imsx_version"`
+	MessageIdentifier string `xml:"imsx_messageIdentifier"`
+}
+
+type poxRequestBody struct {
+	ReplaceResult *poxResultRequest `xml:"replaceResultRequest,omitempty"`
+	ReadResult    *poxResultRequest `xml:"readResultRequest,omitempty"`
+	DeleteResult  *poxResultRequest `xml:"deleteResultRequest,omitempty"`
+}
+
+type poxResultRequest struct {
+	ResultRecord poxResultRecord `xml:"resultRecord"`
+}
+
+type poxResultRecord struct {
+	SourcedID string     `xml:"sourcedGUID>sourcedId"`
+	Result    *poxResult `xml:"result,omitempty"`
+}
+
+type poxResult struct {
+	ResultScore poxResultScore `xml:"resultScore"`
+}
+
+type poxResultScore struct {
+	Language   string `xml:"language"`
+	TextString string `xml:"textString"`
+}
+
+type poxResponse struct {
+	XMLName xml.Name `xml:"imsx_POXEnvelopeResponse"`
+	Header  struct {
+		StatusInfo poxStatusInfo `xml:"imsx_statusInfo"`
+	} `xml:"imsx_POXHeader>imsx_POXResponseHeaderInfo"`
+	Body struct {
+		ReadResult *poxResult `xml:"readResultResponse>result"`
+	} `xml:"imsx_POXBody"`
+}
+
+type poxStatusInfo struct {
+	CodeMajor   string `xml:"imsx_codeMajor"`
+	Severity    string `xml:"imsx_severity"`
+	Description string `xml:"imsx_description"`
+}
@@ -0,0 +1,118 @@
+package lti11
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const poxResponseTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<imsx_POXEnvelopeResponse xmlns="http://www.imsglobal.org/services/ltiv1p1/xsd/imsoms_v1p0">
+  <imsx_POXHeader>
+    <imsx_POXResponseHeaderInfo>
+      <imsx_version>V1.0</imsx_version>
+      <imsx_messageIdentifier>4560</imsx_messageIdentifier>
+      <imsx_statusInfo>
+        <imsx_codeMajor>%s</imsx_codeMajor>
+        <imsx_severity>status</imsx_severity>
+        <imsx_description>%s</imsx_description>
+      </imsx_statusInfo>
+    </imsx_POXResponseHeaderInfo>
+  </imsx_POXHeader>
+  <imsx_POXBody>%s</imsx_POXBody>
+</imsx_POXEnvelopeResponse>`
+
+// parseAuthorizationHeader reads the OAuth protocol parameters of an Authorization header
+func parseAuthorizationHeader(header string) url.Values {
+	params := url.Values{}
+	for _, part := range strings.Split(strings.TrimPrefix(header, "OAuth "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		value, _ := url.PathUnescape(strings.Trim(kv[1], `"`))
+		params.Set(kv[0], value)
+	}
+	return params
+}
+
+// outcomesServer is a platform outcome service keeping one score per sourcedid
+func outcomesServer(t *testing.T) *httptest.Server {
+	scores := map[string]string{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		params := parseAuthorizationHeader(req.Header.Get("Authorization"))
+
+		hash := sha1.Sum(body)
+		if params.Get(ParamBodyHash) != base64.StdEncoding.EncodeToString(hash[:]) {
+			t.Errorf("body hash does not match")
+		}
+		signature, _ := Sign("POST", "http://"+req.Host+req.URL.Path, params, testSecret)
+		if params.Get(ParamSignature) != signature {
+			fmt.Fprintf(w, poxResponseTemplate, "failure", "Invalid signature", "")
+			return
+		}
+
+		var envelope struct {
+			Replace *poxResultRecord `xml:"imsx_POXBody>replaceResultRequest>resultRecord"`
+			Read    *poxResultRecord `xml:"imsx_POXBody>readResultRequest>resultRecord"`
+			Delete  *poxResultRecord `xml:"imsx_POXBody>deleteResultRequest>resultRecord"`
+		}
+		if err := xml.Unmarshal(body, &envelope); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+
+		switch {
+		case envelope.Replace != nil:
+			scores[envelope.Replace.SourcedID] = envelope.Replace.Result.ResultScore.TextString
+			fmt.Fprintf(w, poxResponseTemplate, "success", "Score set", "<replaceResultResponse/>")
+		case envelope.Read != nil:
+			result := fmt.Sprintf("<readResultResponse><result><resultScore><language>en</language><textString>%s</textString></resultScore></result></readResultResponse>", scores[envelope.Read.SourcedID])
+			fmt.Fprintf(w, poxResponseTemplate, "success", "Result read", result)
+		case envelope.Delete != nil:
+			delete(scores, envelope.Delete.SourcedID)
+			fmt.Fprintf(w, poxResponseTemplate, "success", "Score deleted", "<deleteResultResponse/>")
+		default:
+			fmt.Fprintf(w, poxResponseTemplate, "unsupported", "Unknown operation", "")
+		}
+	}))
+}
+
+func TestOutcomesClient(t *testing.T) {
+	server := outcomesServer(t)
+	defer server.Close()
+	serviceURL := server.URL + "/outcomes"
+
+	client := NewOutcomesClient(testConsumerKey, testSecret)
+
+	_, ok, err := client.ReadResult(serviceURL, "result-1")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, client.ReplaceResult(serviceURL, "result-1", 0.92))
+	score, ok, err := client.ReadResult(serviceURL, "result-1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 0.92, score)
+
+	assert.NoError(t, client.DeleteResult(serviceURL, "result-1"))
+	_, ok, err = client.ReadResult(serviceURL, "result-1")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.Error(t, client.ReplaceResult(serviceURL, "result-1", 1.5))
+
+	wrongSecret := NewOutcomesClient(testConsumerKey, "wrong-secret")
+	err = wrongSecret.ReplaceResult(serviceURL, "result-1", 0.5)
+	if assert.IsType(t, &OutcomeError{}, err) {
+		assert.Equal(t, "failure", err.(*OutcomeError).CodeMajor)
+		assert.Equal(t, OperationReplaceResult, err.(*OutcomeError).Operation)
+	}
+}
@@ -0,0 +1,256 @@
+package ltiservice
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	uuid "github.com/satori/go.uuid"
+)
+
+// StorageTargetParam the login and launch parameter naming the platform frame that offers LTI Client Side
+// postMessage Storage
+// The storage is only used to check launches when a state store is configured: the values read from it are posted
+// by the browser, so the launch must also match the single-use record the state store keeps of its login.
+// See https://www.imsglobal.org/spec/lti-cs-pm/v0p1
+const StorageTargetParam = "lti_storage_target"
+
+// Form fields the launch page adds with the values it read from the platform's storage
+const (
+	storageStateField  = "lti_storage_state"
+	storageNonceField  = "lti_storage_nonce"
+	storageTargetField = "lti_storage_target_link_uri"
+)
+
+// clientStorageItem a value written to, or read from, the platform's storage
+type clientStorageItem struct {
+	MessageID string `json:"message_id"`
+	Key       string `json:"key"`
+	Value     string `json:"value,omitempty"`
+	// Field the launch form field that receives the value read
+	Field string `json:"field,omitempty"`
+}
+
+type clientStoragePage struct {
+	Target string
+	Origin string
+	Items  []clientStorageItem
+	// RedirectURL where the login page continues once the values are stored
+	RedirectURL string
+	// Action and Fields the launch form the launch page posts again with the values read
+	Action string
+	Fields map[string]string
+}
+
+func stateStorageKey(state string) string {
+	return "state_" + state
+}
+
+func nonceStorageKey(nonce string) string {
+	return "nonce_" + nonce
+}
+
+func targetStorageKey(state string) string {
+	return "target_" + state
+}
+
+// usesClientStorage checks whether the platform offers postMessage storage for the request
+func usesClientStorage(req *http.Request) bool {
+	return req.FormValue(StorageTargetParam) != ""
+}
+
+// readsClientStorage checks whether the service uses the platform's postMessage storage for the request, which it
+// only does together with the state store, see StorageTargetParam
+func (ltis *LTIService) readsClientStorage(req *http.Request) bool {
+	return usesClientStorage(req) && ltis.States != nil && ltis.stateMode() != StateModeStore
+}
+
+// storageOrigin returns the origin of the platform's frame, which is the origin of its OIDC authorization endpoint
+func (ltis *LTIService) storageOrigin() (string, error) {
+	u, err := url.Parse(ltis.Config.AuthLoginURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("Cannot determine the platform origin from auth login URL %q", ltis.Config.AuthLoginURL)
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// renderStoragePutPage writes the login page that stores the state, nonce and requested target link URI in the
+// platform's storage, then continues to the platform's authorization endpoint
+func (ltis *LTIService) renderStoragePutPage(w http.ResponseWriter, req *http.Request, state, nonce, target, redirectURL string) {
+	origin, err := ltis.storageOrigin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page := clientStoragePage{
+		Target: req.FormValue(StorageTargetParam),
+		Origin: origin,
+		Items: []clientStorageItem{
+			{MessageID: uuid.NewV4().String(), Key: stateStorageKey(state), Value: state},
+			{MessageID: uuid.NewV4().String(), Key: nonceStorageKey(nonce), Value: nonce},
+		},
+		RedirectURL: redirectURL,
+	}
+	if target != "" {
+		page.Items = append(page.Items, clientStorageItem{MessageID: uuid.NewV4().String(), Key: targetStorageKey(state), Value: target})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := storagePutTemplate.Execute(w, page); err != nil {
+		ltis.debug("Failed rendering storage page: %v", err)
+	}
+}
+
+// renderStorageGetPage writes the launch page that reads the state and nonce back from the platform's storage and
+// posts the launch again with them to the same URL
+func (ltis *LTIService) renderStorageGetPage(w http.ResponseWriter, req *http.Request, claims jwt.MapClaims) {
+	origin, err := ltis.storageOrigin()
+	if err != nil {
+		ltis.handleLaunchError(w, req, newLaunchError(ErrCodeInternal, err))
+		return
+	}
+	nonce, _ := claims["nonce"].(string)
+
+	page := clientStoragePage{
+		Target: req.FormValue(StorageTargetParam),
+		Origin: origin,
+		Items: []clientStorageItem{
+			{MessageID: uuid.NewV4().String(), Key: stateStorageKey(req.FormValue("state")), Field: storageStateField},
+			{MessageID: uuid.NewV4().String(), Key: nonceStorageKey(nonce), Field: storageNonceField},
+			{MessageID: uuid.NewV4().String(), Key: targetStorageKey(req.FormValue("state")), Field: storageTargetField},
+		},
+		Action: req.URL.RequestURI(),
+		Fields: map[string]string{
+			"id_token":         req.FormValue("id_token"),
+			"state":            req.FormValue("state"),
+			StorageTargetParam: req.FormValue(StorageTargetParam),
+		},
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := storageGetTemplate.Execute(w, page); err != nil {
+		ltis.debug("Failed rendering storage page: %v", err)
+	}
+}
+
+// hasClientStorageValues checks whether the launch was posted again by the storage page
+func hasClientStorageValues(req *http.Request) bool {
+	_, state := req.PostForm[storageStateField]
+	_, nonce := req.PostForm[storageNonceField]
+	return state || nonce
+}
+
+// validateClientStorage checks the state and nonce read from the platform's storage against the launch
+func validateClientStorage(req *http.Request, claims jwt.MapClaims) error {
+	state := req.FormValue("state")
+	if state == "" || req.PostFormValue(storageStateField) != state {
+		return fmt.Errorf("State %q was not found in the platform storage", state)
+	}
+	nonce, _ := claims["nonce"].(string)
+	if nonce == "" || req.PostFormValue(storageNonceField) != nonce {
+		return fmt.Errorf("Nonce %q was not found in the platform storage", nonce)
+	}
+	//Logins without a target link URI store none
+	if target := req.PostFormValue(storageTargetField); target != "" {
+		if err := matchTargetLinkURI(claims, target); err != nil {
+			return newLaunchError(ErrCodeTargetMismatch, err)
+		}
+	}
+	return nil
+}
+
+// clientStorageScript sends the items to the platform frame and calls done once every item is answered, or after
+// a timeout so that a platform that ignores the messages does not stall the launch
+var clientStorageScript = `{{define "script"}}
+<script>
+(function() {
+	var target = {{.Target}};
+	var origin = {{.Origin}};
+	var items = {{.Items}};
+	var frame = window.parent;
+	if (target !== "_parent") {
+		try {
+			frame = window.parent.frames[target] || window.parent;
+		} catch (e) {}
+	}
+
+	var pending = {};
+	var remaining = items.length;
+	var finished = false;
+	function finish() {
+		if (!finished) {
+			finished = true;
+			done();
+		}
+	}
+
+	window.addEventListener("message", function(event) {
+		var data = event.data || {};
+		if (event.origin !== origin || !pending[data.message_id]) {
+			return;
+		}
+		received(pending[data.message_id], data);
+		delete pending[data.message_id];
+		if (--remaining === 0) {
+			finish();
+		}
+	});
+	items.forEach(function(item) {
+		pending[item.message_id] = item;
+		frame.postMessage({subject: subject, message_id: item.message_id, key: item.key, value: item.value}, origin);
+	});
+	setTimeout(finish, 2000);
+})();
+</script>
+{{end}}`
+
+var storagePutTemplate = template.Must(template.Must(template.New("storagePut").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Logging in</title>
+</head>
+<body>
+<p>Logging in. <a href="{{.RedirectURL}}">Continue</a> if nothing happens.</p>
+<script>
+var subject = "lti.put_data";
+function received(item, data) {}
+function done() {
+	window.location.href = {{.RedirectURL}};
+}
+</script>
+{{template "script" .}}
+</body>
+</html>
+`)).Parse(clientStorageScript))
+
+var storageGetTemplate = template.Must(template.Must(template.New("storageGet").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Launching</title>
+</head>
+<body>
+<form id="launch" method="POST" action="{{.Action}}">
+{{range $name, $value := .Fields}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<input type="hidden" name="lti_storage_state" value="">
+<input type="hidden" name="lti_storage_nonce" value="">
+<input type="hidden" name="lti_storage_target_link_uri" value="">
+<noscript><button type="submit">Continue</button></noscript>
+</form>
+<script>
+var subject = "lti.get_data";
+function received(item, data) {
+	if (typeof data.value === "string") {
+		document.getElementById("launch").elements[item.field].value = data.value;
+	}
+}
+function done() {
+	document.getElementById("launch").submit();
+}
+</script>
+{{template "script" .}}
+</body>
+</html>
+`)).Parse(clientStorageScript))
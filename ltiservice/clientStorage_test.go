@@ -0,0 +1,142 @@
+package ltiservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginWithClientStorage(t *testing.T) {
+	ltis := NewLTIService(nil, Config{
+		PlatformIssuer: testIssuer,
+		ClientID:       testClientID,
+		AuthLoginURL:   "https://platform.example.com/auth",
+		LaunchURL:      "https://tool.example.com/launch",
+	})
+
+	query := url.Values{}
+	query.Set("iss", testIssuer)
+	query.Set("login_hint", "user-1")
+	query.Set(StorageTargetParam, "post_message_forwarding")
+	w := httptest.NewRecorder()
+	ltis.GetLoginHandler().ServeHTTP(w, httptest.NewRequest("GET", "/login?"+query.Encode(), nil))
+	assert.Equal(t, http.StatusFound, w.Code, "without a state store launches never read the storage, so login redirects at once")
+	assert.NotContains(t, w.Header().Get("Location"), StorageTargetParam)
+
+	ltis.SetStateStore(NewMemoryStateStore(0))
+	w = httptest.NewRecorder()
+	ltis.GetLoginHandler().ServeHTTP(w, httptest.NewRequest("GET", "/login?"+query.Encode(), nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `"lti.put_data"`)
+	assert.Contains(t, body, `"https://platform.example.com"`)
+	assert.Contains(t, body, `"post_message_forwarding"`)
+	assert.Contains(t, body, `lti_storage_target=post_message_forwarding`)
+	assert.Contains(t, body, `"key":"state_state-`)
+	assert.Contains(t, body, `"key":"nonce_nonce-`)
+	assert.Len(t, w.Result().Cookies(), 2, "state cookies are still set for browsers that accept them")
+}
+
+func TestLaunchWithClientStorage(t *testing.T) {
+	keySet := keySetServer(t)
+	defer keySet.Close()
+
+	ltis := NewLTIService(nil, Config{
+		PlatformIssuer: testIssuer,
+		ClientID:       testClientID,
+		KeySetURL:      keySet.URL,
+		AuthLoginURL:   "https://platform.example.com/auth",
+		LaunchURL:      "https://tool.example.com/launch",
+	})
+	ltis.SetStateStore(NewMemoryStateStore(0))
+	require.NoError(t, ltis.States.SaveState(nil, nil, testStateRecord(time.Now())))
+	called := false
+	handler := ltis.GetLaunchContextHandler(func(launch *Launch) {
+		called = true
+	})
+	idToken := signRawPayload(t, validLaunchPayload())
+
+	post := func(stored url.Values) *httptest.ResponseRecorder {
+		called = false
+		form := url.Values{}
+		form.Set("id_token", idToken)
+		form.Set("state", "state-fuzz")
+		form.Set(StorageTargetParam, "_parent")
+		for name := range stored {
+			form.Set(name, stored.Get(name))
+		}
+		req := httptest.NewRequest("POST", "/launch", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// Without cookies, the launch first reads the state and nonce back from the platform
+	w := post(nil)
+	assert.False(t, called)
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `"lti.get_data"`)
+	assert.Contains(t, body, `action="/launch"`)
+	assert.Contains(t, body, `name="id_token" value="`+idToken+`"`)
+	assert.Contains(t, body, `"key":"state_state-fuzz"`)
+	assert.Contains(t, body, `"key":"nonce_nonce-fuzz"`)
+
+	w = post(url.Values{storageStateField: {"state-fuzz"}, storageNonceField: {"other-nonce"}})
+	assert.False(t, called)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = post(url.Values{storageStateField: {""}, storageNonceField: {""}})
+	assert.False(t, called, "values the platform did not return must not pass")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	stored := url.Values{storageStateField: {"state-fuzz"}, storageNonceField: {"nonce-fuzz"}}
+	w = post(stored)
+	assert.True(t, called, "launch was rejected: %d %s", w.Code, w.Body.String())
+
+	w = post(stored)
+	assert.False(t, called, "the login of a state can only be used once")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestLaunchWithForgedClientStorage(t *testing.T) {
+	keySet := keySetServer(t)
+	defer keySet.Close()
+
+	config := Config{
+		PlatformIssuer: testIssuer,
+		ClientID:       testClientID,
+		KeySetURL:      keySet.URL,
+		AuthLoginURL:   "https://platform.example.com/auth",
+		LaunchURL:      "https://tool.example.com/launch",
+	}
+	// A forged form fills in the storage fields itself, consistent with the state and the token's nonce
+	forged := url.Values{}
+	forged.Set("id_token", signRawPayload(t, validLaunchPayload()))
+	forged.Set("state", "state-fuzz")
+	forged.Set(StorageTargetParam, "_parent")
+	forged.Set(storageStateField, "state-fuzz")
+	forged.Set(storageNonceField, "nonce-fuzz")
+
+	for _, withStore := range []bool{false, true} {
+		ltis := NewLTIService(nil, config)
+		if withStore {
+			// The store has no record of a login with this state
+			ltis.SetStateStore(NewMemoryStateStore(0))
+		}
+		called := false
+		req := httptest.NewRequest("POST", "/launch", strings.NewReader(forged.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		ltis.GetLaunchContextHandler(func(*Launch) { called = true }).ServeHTTP(w, req)
+		assert.False(t, called, "store configured: %v", withStore)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+}
@@ -0,0 +1,113 @@
+package ltiservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// DefaultClockLeeway the clock skew tolerated between platform and tool when no other policy is set
+const DefaultClockLeeway = 5 * time.Second
+
+// ClockPolicy controls how the timestamps of incoming tokens are checked
+type ClockPolicy struct {
+	// Now returns the current time; time.Now is used when nil. Tests can replace it to avoid sleeping.
+	Now func() time.Time
+	// Leeway is the clock skew tolerated when checking iat, nbf and exp
+	Leeway time.Duration
+	// MaxAge is the longest accepted time between a token's iat and now; zero means no limit
+	MaxAge time.Duration
+}
+
+// DefaultClockPolicy Returns the clock policy used by new services
+func DefaultClockPolicy() ClockPolicy {
+	return ClockPolicy{Leeway: DefaultClockLeeway}
+}
+
+// SetClockPolicy Define how token timestamps are checked
+func (ltis *LTIService) SetClockPolicy(policy ClockPolicy) {
+	ltis.Clock = policy
+}
+
+func (p ClockPolicy) now() time.Time {
+	if p.Now == nil {
+		return time.Now()
+	}
+	return p.Now()
+}
+
+// validate checks the iat, exp and nbf claims against the policy
+func (p ClockPolicy) validate(claims jwt.MapClaims) error {
+	iat, ok, err := claimTime(claims, "iat")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("Token creation time is missing")
+	}
+
+	exp, ok, err := claimTime(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("Token expiration time is missing")
+	}
+
+	nbf, hasNbf, err := claimTime(claims, "nbf")
+	if err != nil {
+		return err
+	}
+
+	now := p.now()
+	if iat.After(now.Add(p.Leeway)) {
+		return fmt.Errorf("Token creation time %s is in the future", iat.UTC().Format(time.RFC3339))
+	}
+	if now.After(exp.Add(p.Leeway)) {
+		return newLaunchError(ErrCodeExpired, fmt.Errorf("Token expired at %s", exp.UTC().Format(time.RFC3339)))
+	}
+	if hasNbf && nbf.After(now.Add(p.Leeway)) {
+		return fmt.Errorf("Token is not valid before %s", nbf.UTC().Format(time.RFC3339))
+	}
+	if p.MaxAge > 0 && now.Sub(iat) > p.MaxAge+p.Leeway {
+		return newLaunchError(ErrCodeExpired, fmt.Errorf("Token created at %s is older than %s", iat.UTC().Format(time.RFC3339), p.MaxAge))
+	}
+
+	return nil
+}
+
+// claimTime reads a NumericDate claim, reporting whether it was present
+// A claim of the wrong type is an error rather than a panic, since tokens come from outside.
+func claimTime(claims jwt.MapClaims, name string) (time.Time, bool, error) {
+	raw, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	var secs float64
+	switch v := raw.(type) {
+	case float64:
+		secs = v
+	case int64:
+		secs = float64(v)
+	case int:
+		secs = float64(v)
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, true, fmt.Errorf("%s claim is not a number: %q", name, v)
+		}
+		secs = f
+	default:
+		return time.Time{}, true, fmt.Errorf("%s claim is unexpected type: %T", name, raw)
+	}
+	if math.IsNaN(secs) || math.IsInf(secs, 0) {
+		return time.Time{}, true, fmt.Errorf("%s claim is not a valid time", name)
+	}
+
+	whole, frac := math.Modf(secs)
+	return time.Unix(int64(whole), int64(frac*1e9)), true, nil
+}
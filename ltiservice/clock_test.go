@@ -0,0 +1,48 @@
+package ltiservice
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClockPolicy(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	policy := ClockPolicy{
+		Now:    func() time.Time { return now },
+		Leeway: 10 * time.Second,
+		MaxAge: 5 * time.Minute,
+	}
+	unix := now.Unix()
+
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		wantErr bool
+	}{
+		{name: "valid", claims: jwt.MapClaims{"iat": float64(unix), "exp": float64(unix + 60)}},
+		{name: "iat within leeway", claims: jwt.MapClaims{"iat": float64(unix + 5), "exp": float64(unix + 60)}},
+		{name: "iat beyond leeway", claims: jwt.MapClaims{"iat": float64(unix + 30), "exp": float64(unix + 60)}, wantErr: true},
+		{name: "exp within leeway", claims: jwt.MapClaims{"iat": float64(unix - 60), "exp": float64(unix - 5)}},
+		{name: "exp beyond leeway", claims: jwt.MapClaims{"iat": float64(unix - 60), "exp": float64(unix - 30)}, wantErr: true},
+		{name: "nbf beyond leeway", claims: jwt.MapClaims{"iat": float64(unix), "exp": float64(unix + 60), "nbf": float64(unix + 30)}, wantErr: true},
+		{name: "older than max age", claims: jwt.MapClaims{"iat": float64(unix - 600), "exp": float64(unix + 60)}, wantErr: true},
+		{name: "missing iat", claims: jwt.MapClaims{"exp": float64(unix + 60)}, wantErr: true},
+		{name: "missing exp", claims: jwt.MapClaims{"iat": float64(unix)}, wantErr: true},
+		{name: "string iat", claims: jwt.MapClaims{"iat": "1600000000", "exp": float64(unix + 60)}, wantErr: true},
+		{name: "object exp", claims: jwt.MapClaims{"iat": float64(unix), "exp": map[string]interface{}{}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.validate(tt.claims)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -3,7 +3,6 @@ package ltiservice
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"html/template"
 	"net/http"
 	"time"
@@ -88,7 +87,6 @@ func (ltis *LTIService) createJWT(data interface{}) ([]byte, error) {
 		return nil, errors.Wrap(err, `failed to sign payload`)
 	}
 
-	fmt.Println(method, key)
 	return signed, nil
 }
 
@@ -0,0 +1,166 @@
+package ltiservice
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/MZDevinc/go-lti/lti"
+	"github.com/pkg/errors"
+)
+
+// Deployment a single deployment of the tool within a platform registration
+// Platforms can create many deployments for one client ID (e.g. one per institution or sub-account), so settings
+// such as licensing and feature flags usually belong on the deployment rather than the registration.
+type Deployment struct {
+	Issuer       string
+	ClientID     string
+	DeploymentID string
+	// Settings holds arbitrary per-deployment configuration for use by the tool
+	Settings map[string]interface{}
+	// Revoked marks a deployment that may no longer launch the tool
+	// A revoked deployment stays in the deployment store, so that neither Config.DeploymentIDs nor the
+	// DeploymentApprover lets it launch again.
+	Revoked bool
+}
+
+// DeploymentStore looks up and persists the deployments that are allowed to launch the tool
+type DeploymentStore interface {
+	// FindDeployment returns the matching deployment, or nil (with no error) if the deployment is not known
+	FindDeployment(issuer, clientID, deploymentID string) (*Deployment, error)
+	// SaveDeployment adds or replaces a deployment
+	SaveDeployment(dep Deployment) error
+}
+
+// DeploymentApprover decides whether a deployment that is launching for the first time may be registered
+// It receives the launch message that introduced the deployment, so the decision can depend on the platform details.
+type DeploymentApprover func(dep Deployment, msg lti.LaunchMessage) (bool, error)
+
+// SetDeploymentStore Define the store used to look up deployments during launch
+func (ltis *LTIService) SetDeploymentStore(store DeploymentStore) {
+	ltis.Deployments = store
+}
+
+// SetDeploymentApprover Enable automatic registration of unknown deployments on their first launch
+// The approver is called for each unknown deployment; approved deployments are saved to the deployment store (if any).
+func (ltis *LTIService) SetDeploymentApprover(approver DeploymentApprover) {
+	ltis.DeploymentApprover = approver
+}
+
+// resolveDeployment finds the deployment record for a launch, registering it if allowed
+// Deployments revoked in the store are rejected before the allowlist and the approver are consulted. When neither an
+// allowlist, a store nor an approver is configured, any deployment is accepted.
+func (ltis *LTIService) resolveDeployment(msg lti.LaunchMessage) (*Deployment, error) {
+	dep := Deployment{
+		Issuer:       msg.Iss,
+		ClientID:     msg.Aud,
+		DeploymentID: msg.DeploymentID,
+	}
+
+	if ltis.Deployments != nil {
+		found, err := ltis.Deployments.FindDeployment(dep.Issuer, dep.ClientID, dep.DeploymentID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed looking up deployment %q", dep.DeploymentID)
+		}
+		if found != nil {
+			if found.Revoked {
+				return nil, fmt.Errorf("Deployment %q was revoked", dep.DeploymentID)
+			}
+			return found, nil
+		}
+	}
+
+	for _, id := range ltis.Config.DeploymentIDs {
+		if id == dep.DeploymentID {
+			return &dep, nil
+		}
+	}
+
+	if ltis.DeploymentApprover != nil {
+		approved, err := ltis.DeploymentApprover(dep, msg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed approving deployment %q", dep.DeploymentID)
+		}
+		if !approved {
+			return nil, fmt.Errorf("Deployment %q was not approved", dep.DeploymentID)
+		}
+		if ltis.Deployments != nil {
+			if err := ltis.Deployments.SaveDeployment(dep); err != nil {
+				return nil, errors.Wrapf(err, "Failed saving deployment %q", dep.DeploymentID)
+			}
+		}
+		ltis.debug("Registered new deployment %q", dep.DeploymentID)
+		return &dep, nil
+	}
+
+	if ltis.Deployments == nil && len(ltis.Config.DeploymentIDs) == 0 {
+		return &dep, nil
+	}
+
+	return nil, fmt.Errorf("Unknown deployment %q", dep.DeploymentID)
+}
+
+// MemoryDeploymentStore a DeploymentStore that keeps deployments in memory
+type MemoryDeploymentStore struct {
+	mu          sync.RWMutex
+	deployments map[string]Deployment
+}
+
+// NewMemoryDeploymentStore Returns a MemoryDeploymentStore holding the given deployments
+func NewMemoryDeploymentStore(deployments ...Deployment) *MemoryDeploymentStore {
+	store := &MemoryDeploymentStore{deployments: map[string]Deployment{}}
+	for _, dep := range deployments {
+		store.deployments[deploymentKey(dep.Issuer, dep.ClientID, dep.DeploymentID)] = dep
+	}
+	return store
+}
+
+// FindDeployment returns the matching deployment, or nil if the deployment is not known
+func (s *MemoryDeploymentStore) FindDeployment(issuer, clientID, deploymentID string) (*Deployment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dep, ok := s.deployments[deploymentKey(issuer, clientID, deploymentID)]
+	if !ok {
+		return nil, nil
+	}
+	return &dep, nil
+}
+
+// SaveDeployment adds or replaces a deployment
+func (s *MemoryDeploymentStore) SaveDeployment(dep Deployment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deployments[deploymentKey(dep.Issuer, dep.ClientID, dep.DeploymentID)] = dep
+	return nil
+}
+
+// RevokeDeployment marks a deployment as revoked, so that it can no longer launch the tool
+// Deployments the store does not know yet are added as revoked, so that the allowlist or the approver cannot let them
+// in either.
+func (s *MemoryDeploymentStore) RevokeDeployment(issuer, clientID, deploymentID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := deploymentKey(issuer, clientID, deploymentID)
+	dep, ok := s.deployments[key]
+	if !ok {
+		dep = Deployment{Issuer: issuer, ClientID: clientID, DeploymentID: deploymentID}
+	}
+	dep.Revoked = true
+	s.deployments[key] = dep
+}
+
+// RemoveDeployment forgets a deployment
+// Unlike RevokeDeployment, this does not stop the deployment from launching: Config.DeploymentIDs or the
+// DeploymentApprover may still let it in, and the approver may register it again.
+func (s *MemoryDeploymentStore) RemoveDeployment(issuer, clientID, deploymentID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.deployments, deploymentKey(issuer, clientID, deploymentID))
+}
+
+func deploymentKey(issuer, clientID, deploymentID string) string {
+	return fmt.Sprintf("%s\x00%s\x00%s", issuer, clientID, deploymentID)
+}
@@ -0,0 +1,210 @@
+package ltiservice
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MZDevinc/go-lti/lti"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func deploymentMessage(deploymentID string) lti.LaunchMessage {
+	msg := lti.LaunchMessage{}
+	msg.Iss = testIssuer
+	msg.Aud = testClientID
+	msg.DeploymentID = deploymentID
+	return msg
+}
+
+func TestResolveDeployment(t *testing.T) {
+	stored := Deployment{
+		Issuer:       testIssuer,
+		ClientID:     testClientID,
+		DeploymentID: "stored",
+		Settings:     map[string]interface{}{"plan": "pro"},
+	}
+
+	tests := []struct {
+		name         string
+		allowlist    []string
+		store        bool
+		deploymentID string
+		found        bool
+		settings     bool
+	}{
+		{name: "nothing configured", deploymentID: "any", found: true},
+		{name: "allowlisted", allowlist: []string{"allowed"}, deploymentID: "allowed", found: true},
+		{name: "not allowlisted", allowlist: []string{"allowed"}, deploymentID: "other"},
+		{name: "stored", store: true, deploymentID: "stored", found: true, settings: true},
+		{name: "not stored", store: true, deploymentID: "other"},
+		{name: "allowlisted with store", allowlist: []string{"allowed"}, store: true, deploymentID: "allowed", found: true},
+		{name: "stored with allowlist", allowlist: []string{"allowed"}, store: true, deploymentID: "stored", found: true, settings: true},
+		{name: "other issuer's deployment", store: true, deploymentID: "stored-elsewhere"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ltis := testService()
+			ltis.Config.DeploymentIDs = test.allowlist
+			if test.store {
+				ltis.SetDeploymentStore(NewMemoryDeploymentStore(stored, Deployment{
+					Issuer:       "https://other.example.com",
+					ClientID:     testClientID,
+					DeploymentID: "stored-elsewhere",
+				}))
+			}
+
+			dep, err := ltis.resolveDeployment(deploymentMessage(test.deploymentID))
+			if !test.found {
+				assert.Error(t, err)
+				assert.Nil(t, dep)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.deploymentID, dep.DeploymentID)
+			assert.Equal(t, testIssuer, dep.Issuer)
+			assert.Equal(t, testClientID, dep.ClientID)
+			assert.Equal(t, test.settings, dep.Settings != nil)
+		})
+	}
+}
+
+func TestDeploymentApprover(t *testing.T) {
+	ltis := testService()
+	ltis.Config.DeploymentIDs = []string{"allowed"}
+	store := NewMemoryDeploymentStore()
+	ltis.SetDeploymentStore(store)
+
+	var asked []string
+	approve := map[string]bool{"approved": true}
+	ltis.SetDeploymentApprover(func(dep Deployment, msg lti.LaunchMessage) (bool, error) {
+		asked = append(asked, dep.DeploymentID)
+		assert.Equal(t, msg.DeploymentID, dep.DeploymentID)
+		if dep.DeploymentID == "broken" {
+			return true, fmt.Errorf("approval service is down")
+		}
+		return approve[dep.DeploymentID], nil
+	})
+
+	dep, err := ltis.resolveDeployment(deploymentMessage("allowed"))
+	require.NoError(t, err)
+	assert.Equal(t, "allowed", dep.DeploymentID)
+	assert.Empty(t, asked, "allowlisted deployments need no approval")
+
+	dep, err = ltis.resolveDeployment(deploymentMessage("approved"))
+	require.NoError(t, err)
+	assert.Equal(t, "approved", dep.DeploymentID)
+	saved, err := store.FindDeployment(testIssuer, testClientID, "approved")
+	require.NoError(t, err)
+	assert.NotNil(t, saved, "approved deployments are saved")
+
+	_, err = ltis.resolveDeployment(deploymentMessage("approved"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"approved"}, asked, "saved deployments are not approved again")
+
+	for _, id := range []string{"rejected", "broken"} {
+		_, err = ltis.resolveDeployment(deploymentMessage(id))
+		assert.Error(t, err, id)
+		saved, err = store.FindDeployment(testIssuer, testClientID, id)
+		require.NoError(t, err)
+		assert.Nil(t, saved, "%s deployments are not saved", id)
+	}
+	assert.Equal(t, []string{"approved", "rejected", "broken"}, asked)
+}
+
+func TestRevokedDeployment(t *testing.T) {
+	ltis := testService()
+	ltis.Config.DeploymentIDs = []string{"revoked"}
+	store := NewMemoryDeploymentStore(Deployment{
+		Issuer:       testIssuer,
+		ClientID:     testClientID,
+		DeploymentID: "revoked",
+		Settings:     map[string]interface{}{"plan": "pro"},
+	})
+	ltis.SetDeploymentStore(store)
+	asked := false
+	ltis.SetDeploymentApprover(func(Deployment, lti.LaunchMessage) (bool, error) {
+		asked = true
+		return true, nil
+	})
+
+	dep, err := ltis.resolveDeployment(deploymentMessage("revoked"))
+	require.NoError(t, err)
+	saved := *dep
+
+	store.RevokeDeployment(testIssuer, testClientID, "revoked")
+	_, err = ltis.resolveDeployment(deploymentMessage("revoked"))
+	assert.Error(t, err, "the allowlist does not override a revocation")
+	_, err = ltis.findLaunchDeployment(deploymentMessage("revoked"), &saved)
+	assert.Error(t, err, "launches saved before the revocation are refused too")
+
+	store.RevokeDeployment(testIssuer, testClientID, "unknown")
+	_, err = ltis.resolveDeployment(deploymentMessage("unknown"))
+	assert.Error(t, err, "the approver does not override a revocation")
+	assert.False(t, asked)
+
+	revoked, err := store.FindDeployment(testIssuer, testClientID, "revoked")
+	require.NoError(t, err)
+	assert.True(t, revoked.Revoked)
+	assert.Equal(t, "pro", revoked.Settings["plan"], "revoking keeps the deployment's settings")
+}
+
+func TestMemoryDeploymentStore(t *testing.T) {
+	store := NewMemoryDeploymentStore(Deployment{Issuer: testIssuer, ClientID: testClientID, DeploymentID: "dep-1"})
+
+	dep, err := store.FindDeployment(testIssuer, testClientID, "dep-1")
+	require.NoError(t, err)
+	assert.NotNil(t, dep)
+
+	for _, key := range [][3]string{
+		{"https://other.example.com", testClientID, "dep-1"},
+		{testIssuer, "other-client", "dep-1"},
+		{testIssuer, testClientID, "dep-2"},
+	} {
+		dep, err = store.FindDeployment(key[0], key[1], key[2])
+		require.NoError(t, err)
+		assert.Nil(t, dep, "%v", key)
+	}
+
+	require.NoError(t, store.SaveDeployment(Deployment{
+		Issuer:       testIssuer,
+		ClientID:     testClientID,
+		DeploymentID: "dep-1",
+		Settings:     map[string]interface{}{"plan": "pro"},
+	}))
+	dep, err = store.FindDeployment(testIssuer, testClientID, "dep-1")
+	require.NoError(t, err)
+	assert.Equal(t, "pro", dep.Settings["plan"], "saving replaces the deployment")
+
+	store.RemoveDeployment(testIssuer, testClientID, "dep-1")
+	dep, err = store.FindDeployment(testIssuer, testClientID, "dep-1")
+	require.NoError(t, err)
+	assert.Nil(t, dep)
+}
+
+func TestLaunchRejectsUnknownDeployment(t *testing.T) {
+	keySet := keySetServer(t)
+	defer keySet.Close()
+	ltis := NewLTIService(nil, Config{
+		PlatformIssuer: testIssuer,
+		ClientID:       testClientID,
+		KeySetURL:      keySet.URL,
+		DeploymentIDs:  []string{"deployment-2"},
+	})
+	var reported *LaunchError
+	ltis.SetErrorReporter(func(_ *http.Request, err *LaunchError) {
+		reported = err
+	})
+
+	called := false
+	w := httptest.NewRecorder()
+	ltis.GetLaunchContextHandler(func(*Launch) { called = true }).ServeHTTP(w, launchRequest(signRawPayload(t, validLaunchPayload())))
+	assert.False(t, called)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	if assert.NotNil(t, reported) {
+		assert.Equal(t, ErrCodeDeploymentUnknown, reported.Code)
+	}
+}
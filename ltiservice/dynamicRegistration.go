@@ -0,0 +1,402 @@
+package ltiservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ToolConfiguration describes the tool to platforms
+type ToolConfiguration struct {
+	ClientName  string
+	Description string
+	LogoURI     string
+	Contacts    []string
+
+	// InitiateLoginURI the tool's login URL, served by GetLoginHandler
+	InitiateLoginURI string
+	// RedirectURIs the tool's launch URLs; Config.LaunchURL and Config.RedirectURIs if empty
+	RedirectURIs []string
+	// TargetLinkURI the default launch target; Config.LaunchURL if empty
+	TargetLinkURI string
+	// JWKSURI the URL of the tool's public keys
+	JWKSURI string
+	// Domain the tool's domain; the host of TargetLinkURI if empty
+	Domain string
+
+	// Scopes the service scopes the tool requests, e.g. lti.ScopeLineItem
+	Scopes []string
+	// Claims the optional claims the tool wants in launches, e.g. "email" or "name"
+	Claims           []string
+	Messages         []ToolMessage
+	CustomParameters map[string]string
+}
+
+// ToolMessage a message type the tool supports, with where the platform should offer it
+type ToolMessage struct {
+	Type             string            `json:"type"`
+	TargetLinkURI    string            `json:"target_link_uri,omitempty"`
+	Label            string            `json:"label,omitempty"`
+	IconURI          string            `json:"icon_uri,omitempty"`
+	Placements       []string          `json:"placements,omitempty"`
+	Roles            []string          `json:"roles,omitempty"`
+	CustomParameters map[string]string `json:"custom_parameters,omitempty"`
+}
+
+// ClientRegistration the OpenID client registration document of LTI Dynamic Registration
+// The tool sends it to the platform's registration endpoint, which returns it with ClientID and DeploymentID set.
+// See https://www.imsglobal.org/spec/lti-dr/v1p0#tool-configuration
+type ClientRegistration struct {
+	ClientID                string               `json:"client_id,omitempty"`
+	ApplicationType         string               `json:"application_type"`
+	ResponseTypes           []string             `json:"response_types"`
+	GrantTypes              []string             `json:"grant_types"`
+	InitiateLoginURI        string               `json:"initiate_login_uri"`
+	RedirectURIs            []string             `json:"redirect_uris"`
+	ClientName              string               `json:"client_name"`
+	JWKSURI                 string               `json:"jwks_uri"`
+	LogoURI                 string               `json:"logo_uri,omitempty"`
+	TokenEndpointAuthMethod string               `json:"token_endpoint_auth_method"`
+	Contacts                []string             `json:"contacts,omitempty"`
+	Scope                   string               `json:"scope,omitempty"`
+	LTIToolConfiguration    LTIToolConfiguration `json:"https://purl.imsglobal.org/spec/lti-tool-configuration"`
+}
+
+// LTIToolConfiguration the LTI specific part of a client registration
+type LTIToolConfiguration struct {
+	Domain           string            `json:"domain"`
+	SecondaryDomains []string          `json:"secondary_domains,omitempty"`
+	DeploymentID     string            `json:"deployment_id,omitempty"`
+	TargetLinkURI    string            `json:"target_link_uri"`
+	CustomParameters map[string]string `json:"custom_parameters,omitempty"`
+	Description      string            `json:"description,omitempty"`
+	Messages         []ToolMessage     `json:"messages"`
+	Claims           []string          `json:"claims"`
+}
+
+// withDefaults fills in the settings the tool configuration leaves empty from the service Config
+func (tc ToolConfiguration) withDefaults(config Config) ToolConfiguration {
+	if len(tc.RedirectURIs) == 0 {
+		tc.RedirectURIs = config.redirectURIs()
+	}
+	if tc.TargetLinkURI == "" {
+		tc.TargetLinkURI = config.LaunchURL
+	}
+	if tc.Domain == "" {
+		if u, err := url.Parse(tc.TargetLinkURI); err == nil {
+			tc.Domain = u.Host
+		}
+	}
+	return tc
+}
+
+// ClientRegistration returns the registration document describing the tool
+func (tc ToolConfiguration) ClientRegistration() ClientRegistration {
+	messages := tc.Messages
+	if messages == nil {
+		messages = []ToolMessage{}
+	}
+	claims := append([]string{"iss", "sub"}, tc.Claims...)
+
+	return ClientRegistration{
+		ApplicationType:         "web",
+		ResponseTypes:           []string{"id_token"},
+		GrantTypes:              []string{"implicit", "client_credentials"},
+		InitiateLoginURI:        tc.InitiateLoginURI,
+		RedirectURIs:            tc.RedirectURIs,
+		ClientName:              tc.ClientName,
+		JWKSURI:                 tc.JWKSURI,
+		LogoURI:                 tc.LogoURI,
+		TokenEndpointAuthMethod: "private_key_jwt",
+		Contacts:                tc.Contacts,
+		Scope:                   strings.Join(tc.Scopes, " "),
+		LTIToolConfiguration: LTIToolConfiguration{
+			Domain:           tc.Domain,
+			TargetLinkURI:    tc.TargetLinkURI,
+			CustomParameters: tc.CustomParameters,
+			Description:      tc.Description,
+			Messages:         messages,
+			Claims:           claims,
+		},
+	}
+}
+
+// Validate checks that the tool configuration has the settings platforms require
+func (tc ToolConfiguration) Validate() error {
+	if tc.ClientName == "" {
+		return fmt.Errorf("Tool configuration is missing a client name")
+	}
+	for name, value := range map[string]string{
+		"initiate login URI": tc.InitiateLoginURI,
+		"JWKS URI":           tc.JWKSURI,
+		"target link URI":    tc.TargetLinkURI,
+	} {
+		if err := validateAbsoluteURL(value); err != nil {
+			return errors.Wrapf(err, "Tool configuration has invalid %s", name)
+		}
+	}
+	if len(tc.RedirectURIs) == 0 {
+		return fmt.Errorf("Tool configuration has no redirect URIs")
+	}
+	return nil
+}
+
+// RegistrationApprover decides whether a dynamic registration request may register the tool with the platform
+// It receives the registration request, e.g. to check the administrator's session, and the platform's configuration.
+type RegistrationApprover func(req *http.Request, platform *PlatformConfiguration) (bool, error)
+
+// SetRegistrationApprover Define the approver GetRegistrationHandler asks before registering the tool with a platform
+func (ltis *LTIService) SetRegistrationApprover(approver RegistrationApprover) {
+	ltis.RegistrationApprover = approver
+}
+
+// GetRegistrationHandler Returns a handler for LTI Dynamic Registration
+// The platform opens it with openid_configuration and registration_token parameters. The handler fetches the
+// platform's configuration, asks the registration approver, registers the tool there and saves the resulting
+// registration to the registration store, then renders a page that tells the platform to close the registration
+// window. Registrations are refused until an approver is set, and only public https platform URLs are fetched.
+func (ltis *LTIService) GetRegistrationHandler(tool ToolConfiguration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ltis.register(w, req, ltis.BuildToolConfiguration(tool))
+	})
+}
+
+func (ltis *LTIService) register(w http.ResponseWriter, req *http.Request, tool ToolConfiguration) {
+	if ltis.Registrations == nil {
+		http.Error(w, "No registration store is configured.", http.StatusInternalServerError)
+		return
+	}
+	if ltis.RegistrationApprover == nil {
+		http.Error(w, "No registration approver is configured.", http.StatusInternalServerError)
+		return
+	}
+	if err := tool.Validate(); err != nil {
+		ltis.debug("Dynamic registration: %v", err)
+		http.Error(w, "The tool configuration is incomplete.", http.StatusInternalServerError)
+		return
+	}
+
+	configURL := req.FormValue("openid_configuration")
+	if configURL == "" {
+		http.Error(w, "Required openid_configuration not found.", http.StatusBadRequest)
+		return
+	}
+	if err := validateRegistrationURL(configURL); err != nil {
+		http.Error(w, errors.Wrap(err, "Invalid openid_configuration URL").Error(), http.StatusBadRequest)
+		return
+	}
+
+	client := ltis.registrationClient
+	if client == nil {
+		client = newRegistrationClient()
+	}
+	platform, err := fetchPlatformConfiguration(client, configURL)
+	if err != nil {
+		ltis.debug("Failed fetching platform configuration %q: %v", configURL, err)
+		http.Error(w, "The platform configuration could not be retrieved.", http.StatusBadRequest)
+		return
+	}
+	if platform.RegistrationEndpoint == "" {
+		http.Error(w, "The platform does not support dynamic registration.", http.StatusBadRequest)
+		return
+	}
+	if err := validateRegistrationURL(platform.RegistrationEndpoint); err != nil {
+		http.Error(w, errors.Wrap(err, "Invalid registration_endpoint URL").Error(), http.StatusBadRequest)
+		return
+	}
+
+	approved, err := ltis.RegistrationApprover(req, platform)
+	if err != nil {
+		ltis.debug("Failed approving registration with platform %q: %v", platform.Issuer, err)
+		http.Error(w, "Failed approving the registration.", http.StatusInternalServerError)
+		return
+	}
+	if !approved {
+		ltis.debug("Registration with platform %q was not approved", platform.Issuer)
+		http.Error(w, "The registration was not approved.", http.StatusForbidden)
+		return
+	}
+
+	registered, err := postClientRegistration(client, platform.RegistrationEndpoint, req.FormValue("registration_token"), tool.ClientRegistration())
+	if err != nil {
+		ltis.debug("Failed registering with platform %q: %v", platform.Issuer, err)
+		http.Error(w, "The platform did not accept the registration.", http.StatusBadGateway)
+		return
+	}
+
+	reg := platform.Config(registered.ClientID)
+	if id := registered.LTIToolConfiguration.DeploymentID; id != "" {
+		reg.DeploymentIDs = []string{id}
+	}
+	if err := ltis.Registrations.SaveRegistration(reg); err != nil {
+		ltis.debug("Failed saving registration with platform %q: %v", reg.PlatformIssuer, err)
+		http.Error(w, "The registration could not be saved.", http.StatusInternalServerError)
+		return
+	}
+	ltis.debug("Registered client ID %q with platform %q", reg.ClientID, reg.PlatformIssuer)
+
+	name := platform.Issuer
+	if platform.LTIPlatformConfiguration.ProductFamilyCode != "" {
+		name = platform.LTIPlatformConfiguration.ProductFamilyCode
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := registrationCompleteTemplate.Execute(w, map[string]string{"Platform": name}); err != nil {
+		ltis.debug("Failed rendering registration page: %v", err)
+	}
+}
+
+// maxRegistrationResponseSize the most the tool reads of a platform's configuration or registration response
+const maxRegistrationResponseSize = 1 << 20
+
+// internalNetworks the address ranges registration requests may not reach: loopback, private, link-local,
+// shared and unspecified addresses
+var internalNetworks = parseNetworks(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+	"192.168.0.0/16", "224.0.0.0/4", "::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+func isInternalIP(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, network := range internalNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateRegistrationURL checks that a URL from a registration request is an https URL of a public host
+// Host names are checked again when connecting, see newRegistrationClient.
+func validateRegistrationURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute https URL", value)
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%q is not a public URL", value)
+	}
+	if ip := net.ParseIP(host); ip != nil && isInternalIP(ip) {
+		return fmt.Errorf("%q is not a public URL", value)
+	}
+	return nil
+}
+
+// newRegistrationClient returns the HTTP client for the URLs of registration requests
+// It refuses to connect to internal addresses, whatever a host name resolves to, and to follow redirects to URLs
+// validateRegistrationURL rejects. Proxies are not used, as they would hide the address being connected to.
+func newRegistrationClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: time.Second * 30,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isInternalIP(ip) {
+				return fmt.Errorf("Refusing to connect to internal address %q", address)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: time.Second * 30,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, address)
+			},
+			TLSHandshakeTimeout: time.Second * 10,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("Stopped after %d redirects", len(via))
+			}
+			return validateRegistrationURL(req.URL.String())
+		},
+	}
+}
+
+// postClientRegistration sends the tool's registration to the platform and returns the registered client
+func postClientRegistration(client *http.Client, endpoint, token string, registration ClientRegistration) (*ClientRegistration, error) {
+	body, err := json.Marshal(registration)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to serialize client registration")
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to create registration request for %q", endpoint)
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+	if token != "" {
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to send registration to %q", endpoint)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxRegistrationResponseSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read registration response from %q", endpoint)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("Registration request to %q failed with status %s: %s", endpoint, resp.Status, respBody)
+	}
+
+	registered := &ClientRegistration{}
+	if err := json.Unmarshal(respBody, registered); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse registration response from %q", endpoint)
+	}
+	if registered.ClientID == "" {
+		return nil, fmt.Errorf("Registration response from %q has no client_id", endpoint)
+	}
+	return registered, nil
+}
+
+var registrationCompleteTemplate = template.Must(template.New("registrationComplete").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Registration complete</title>
+</head>
+<body>
+<p>The tool is now registered with {{.Platform}}. You can close this window.</p>
+<script>
+(window.opener || window.parent).postMessage({subject: "org.imsglobal.lti.close"}, "*");
+</script>
+</body>
+</html>
+`))
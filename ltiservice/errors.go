@@ -0,0 +1,230 @@
+package ltiservice
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+)
+
+// LaunchErrorCode identifies why a launch request was rejected
+type LaunchErrorCode string
+
+// Codes reported by launch validation
+const (
+	ErrCodeTokenMissing      LaunchErrorCode = "token_missing"
+	ErrCodeInvalidToken      LaunchErrorCode = "invalid_token"
+	ErrCodeBadSignature      LaunchErrorCode = "bad_signature"
+	ErrCodeKeyUnavailable    LaunchErrorCode = "key_unavailable"
+	ErrCodeExpired           LaunchErrorCode = "expired"
+	ErrCodeInvalidTiming     LaunchErrorCode = "invalid_timing"
+	ErrCodeIssuerMismatch    LaunchErrorCode = "issuer_mismatch"
+	ErrCodeStateMismatch     LaunchErrorCode = "state_mismatch"
+	ErrCodeCookieBlocked     LaunchErrorCode = "cookie_blocked"
+	ErrCodeClientIDMismatch  LaunchErrorCode = "client_id_mismatch"
+	ErrCodeDeploymentUnknown LaunchErrorCode = "deployment_unknown"
+	ErrCodeInvalidMessage    LaunchErrorCode = "invalid_message"
+	ErrCodeTargetMismatch    LaunchErrorCode = "target_mismatch"
+	ErrCodeInternal          LaunchErrorCode = "internal"
+)
+
+// launchErrorMessages are the user-facing descriptions of each code. They deliberately contain no details from the
+// underlying error, which may include token contents or internal configuration.
+var launchErrorMessages = map[LaunchErrorCode]string{
+	ErrCodeTokenMissing:      "The launch request did not contain an identity token.",
+	ErrCodeInvalidToken:      "The launch request contained an invalid identity token.",
+	ErrCodeBadSignature:      "The identity token could not be verified.",
+	ErrCodeKeyUnavailable:    "The platform's signing keys could not be retrieved. Please try launching the tool again.",
+	ErrCodeExpired:           "The launch request has expired. Please try launching the tool again.",
+	ErrCodeInvalidTiming:     "The launch request has an invalid timestamp.",
+	ErrCodeIssuerMismatch:    "The launch request came from an unknown platform.",
+	ErrCodeStateMismatch:     "The launch request could not be matched with a login. Please try launching the tool again.",
+	ErrCodeCookieBlocked:     "Your browser blocked the cookies needed to launch this tool inside the page.",
+	ErrCodeClientIDMismatch:  "The launch request was not meant for this tool.",
+	ErrCodeDeploymentUnknown: "This tool deployment is not recognised.",
+	ErrCodeInvalidMessage:    "The launch request was missing required information.",
+	ErrCodeTargetMismatch:    "The launch request targets a page this tool does not offer.",
+	ErrCodeInternal:          "The tool could not process the launch request.",
+}
+
+// LaunchError describes a failed launch
+// Err holds the underlying cause, which is meant for logs and monitoring rather than for the user.
+type LaunchError struct {
+	Code   LaunchErrorCode
+	Status int
+	Err    error
+	// RecoveryURL is a page the user can open outside of the platform's frame to continue, if one is known
+	RecoveryURL string
+	// RecoveryFields if set, are posted to RecoveryURL from the new window instead of opening it with a GET request
+	RecoveryFields map[string]string
+}
+
+func newLaunchError(code LaunchErrorCode, err error) *LaunchError {
+	status := http.StatusUnauthorized
+	switch code {
+	case ErrCodeInternal:
+		status = http.StatusInternalServerError
+	case ErrCodeKeyUnavailable:
+		status = http.StatusServiceUnavailable
+	}
+	return &LaunchError{Code: code, Status: status, Err: err}
+}
+
+// asLaunchError returns err as a LaunchError, wrapping it with the given code if it isn't one already
+func asLaunchError(err error, code LaunchErrorCode) *LaunchError {
+	if lerr, ok := err.(*LaunchError); ok {
+		return lerr
+	}
+	return newLaunchError(code, err)
+}
+
+func (e *LaunchError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("launch error (%s)", e.Code)
+	}
+	return fmt.Sprintf("launch error (%s): %s", e.Code, e.Err.Error())
+}
+
+// Cause returns the underlying error, for compatibility with github.com/pkg/errors
+func (e *LaunchError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the underlying error, for compatibility with the errors package
+func (e *LaunchError) Unwrap() error {
+	return e.Err
+}
+
+// Message returns a description of the error that is safe to show to the user
+func (e *LaunchError) Message() string {
+	if msg, ok := launchErrorMessages[e.Code]; ok {
+		return msg
+	}
+	return launchErrorMessages[ErrCodeInternal]
+}
+
+// ErrorHandler writes the response for a failed launch
+type ErrorHandler func(w http.ResponseWriter, req *http.Request, err *LaunchError)
+
+// ErrorReporter is notified of every failed launch, e.g. to forward errors to a monitoring system
+type ErrorReporter func(req *http.Request, err *LaunchError)
+
+// SetErrorHandler Define a function that writes the response for failed launches, replacing the default error page
+func (ltis *LTIService) SetErrorHandler(handler ErrorHandler) {
+	ltis.ErrorHandler = handler
+}
+
+// SetErrorReporter Define a function that is notified of every failed launch
+func (ltis *LTIService) SetErrorReporter(reporter ErrorReporter) {
+	ltis.ErrorReporter = reporter
+}
+
+func (ltis *LTIService) handleLaunchError(w http.ResponseWriter, req *http.Request, err *LaunchError) {
+	ltis.debug("Launch failed: %s", err.Error())
+
+	if ltis.ErrorReporter != nil {
+		ltis.ErrorReporter(req, err)
+	}
+
+	if ltis.ErrorHandler != nil {
+		ltis.ErrorHandler(w, req, err)
+		return
+	}
+	DefaultErrorHandler(w, req, err)
+}
+
+var errorPageTemplate = template.Must(template.New("launchErrorHTML").Parse(`
+<html>
+	<head>
+		<title>Launch failed</title>
+	</head>
+	<body>
+		<h1>Launch failed</h1>
+		<p>{{.Message}}</p>
+		{{if .RecoveryURL}}
+		<p>Opening the tool outside of this page may work around the problem.</p>
+		{{if .RecoveryFields}}
+		<form method="POST" action="{{.RecoveryURL}}" target="_blank">
+			{{range $name, $value := .RecoveryFields}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+			{{end}}<button type="submit">Open in new window</button>
+		</form>
+		{{else}}
+		<p><a href="{{.RecoveryURL}}" target="_blank" rel="noopener">Open in new window</a></p>
+		{{end}}
+		{{end}}
+		<p><small>Error code: {{.Code}}</small></p>
+	</body>
+</html>
+`))
+
+type errorPageData struct {
+	Code           LaunchErrorCode
+	Message        string
+	RecoveryURL    string
+	RecoveryFields map[string]string
+}
+
+// DefaultErrorHandler renders a minimal HTML error page suitable for display inside the platform's frame
+// When cookies were blocked and a recovery URL is known, the page offers to open the tool in a new window.
+func DefaultErrorHandler(w http.ResponseWriter, req *http.Request, err *LaunchError) {
+	status := err.Status
+	if status == 0 {
+		status = http.StatusUnauthorized
+	}
+
+	dat := errorPageData{
+		Code:    err.Code,
+		Message: err.Message(),
+	}
+	if err.Code == ErrCodeCookieBlocked {
+		dat.RecoveryURL = err.RecoveryURL
+		dat.RecoveryFields = err.RecoveryFields
+	}
+
+	buf := new(bytes.Buffer)
+	if tmplErr := errorPageTemplate.Execute(buf, dat); tmplErr != nil {
+		log.Printf("Failed rendering launch error page: %s", tmplErr)
+		http.Error(w, dat.Message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// LoginError describes a rejected login initiation request
+// It is written as a JSON body in the style of OAuth error responses, naming the parameter at fault and the issuer
+// the request claimed to come from.
+type LoginError struct {
+	Status      int    `json:"-"`
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+	Parameter   string `json:"parameter,omitempty"`
+	Issuer      string `json:"iss,omitempty"`
+}
+
+func (e *LoginError) Error() string {
+	return fmt.Sprintf("login error (%s): %s", e.Code, e.Description)
+}
+
+// newLoginError returns a LoginError for an invalid or missing parameter of the login request
+func newLoginError(param, issuer, format string, a ...interface{}) *LoginError {
+	return &LoginError{
+		Status:      http.StatusBadRequest,
+		Code:        "invalid_request",
+		Description: fmt.Sprintf(format, a...),
+		Parameter:   param,
+		Issuer:      issuer,
+	}
+}
+
+func writeLoginError(w http.ResponseWriter, err *LoginError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.Status)
+	if encErr := json.NewEncoder(w).Encode(err); encErr != nil {
+		log.Printf("Failed writing login error: %s", encErr)
+	}
+}
@@ -0,0 +1,223 @@
+package ltiservice
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLaunchErrorCodes(t *testing.T) {
+	tests := []struct {
+		code   LaunchErrorCode
+		status int
+	}{
+		{ErrCodeTokenMissing, http.StatusUnauthorized},
+		{ErrCodeInvalidToken, http.StatusUnauthorized},
+		{ErrCodeBadSignature, http.StatusUnauthorized},
+		{ErrCodeKeyUnavailable, http.StatusServiceUnavailable},
+		{ErrCodeExpired, http.StatusUnauthorized},
+		{ErrCodeInvalidTiming, http.StatusUnauthorized},
+		{ErrCodeIssuerMismatch, http.StatusUnauthorized},
+		{ErrCodeStateMismatch, http.StatusUnauthorized},
+		{ErrCodeCookieBlocked, http.StatusUnauthorized},
+		{ErrCodeClientIDMismatch, http.StatusUnauthorized},
+		{ErrCodeDeploymentUnknown, http.StatusUnauthorized},
+		{ErrCodeInvalidMessage, http.StatusUnauthorized},
+		{ErrCodeTargetMismatch, http.StatusUnauthorized},
+		{ErrCodeInternal, http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.code), func(t *testing.T) {
+			lerr := newLaunchError(test.code, fmt.Errorf("Secret detail"))
+			assert.Equal(t, test.status, lerr.Status)
+			assert.Equal(t, launchErrorMessages[test.code], lerr.Message())
+			assert.NotEmpty(t, lerr.Message())
+			assert.NotContains(t, lerr.Message(), "Secret detail", "messages never include the cause")
+			assert.Equal(t, fmt.Sprintf("launch error (%s): Secret detail", test.code), lerr.Error())
+		})
+	}
+
+	unknown := &LaunchError{Code: "something_else"}
+	assert.Equal(t, launchErrorMessages[ErrCodeInternal], unknown.Message())
+	assert.Equal(t, "launch error (something_else)", unknown.Error())
+}
+
+func TestAsLaunchError(t *testing.T) {
+	cause := fmt.Errorf("Token expired")
+	lerr := asLaunchError(cause, ErrCodeInvalidTiming)
+	assert.Equal(t, ErrCodeInvalidTiming, lerr.Code)
+	assert.Equal(t, http.StatusUnauthorized, lerr.Status)
+	assert.Equal(t, cause, errors.Unwrap(lerr))
+	assert.Equal(t, cause, pkgerrors.Cause(lerr))
+
+	expired := newLaunchError(ErrCodeExpired, cause)
+	assert.Equal(t, expired, asLaunchError(expired, ErrCodeInvalidTiming), "launch errors keep their code")
+}
+
+func TestDefaultErrorHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      *LaunchError
+		status   int
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "message and code",
+			err:      newLaunchError(ErrCodeStateMismatch, fmt.Errorf("State cookie \"abc\" missing")),
+			status:   http.StatusUnauthorized,
+			contains: []string{launchErrorMessages[ErrCodeStateMismatch], "Error code: state_mismatch"},
+			excludes: []string{"abc", "Open in new window"},
+		},
+		{
+			name:     "internal",
+			err:      newLaunchError(ErrCodeInternal, fmt.Errorf("database password rejected")),
+			status:   http.StatusInternalServerError,
+			contains: []string{launchErrorMessages[ErrCodeInternal], "Error code: internal"},
+			excludes: []string{"password"},
+		},
+		{
+			name:     "zero status",
+			err:      &LaunchError{Code: ErrCodeInvalidToken},
+			status:   http.StatusUnauthorized,
+			contains: []string{launchErrorMessages[ErrCodeInvalidToken]},
+		},
+		{
+			name: "cookie blocked with recovery URL",
+			err: &LaunchError{
+				Code:        ErrCodeCookieBlocked,
+				Status:      http.StatusUnauthorized,
+				RecoveryURL: "https://tool.example.com/launch?a=1&b=<2>",
+			},
+			status: http.StatusUnauthorized,
+			contains: []string{
+				launchErrorMessages[ErrCodeCookieBlocked],
+				`href="https://tool.example.com/launch?a=1&amp;b=%3c2%3e"`,
+				"Open in new window",
+			},
+		},
+		{
+			name: "cookie blocked with recovery form",
+			err: &LaunchError{
+				Code:           ErrCodeCookieBlocked,
+				Status:         http.StatusUnauthorized,
+				RecoveryURL:    "/launch",
+				RecoveryFields: map[string]string{"state": `"><script>`},
+			},
+			status: http.StatusUnauthorized,
+			contains: []string{
+				`<form method="POST" action="/launch" target="_blank">`,
+				`<input type="hidden" name="state" value="&#34;&gt;&lt;script&gt;">`,
+				"Open in new window",
+			},
+			excludes: []string{"<a href"},
+		},
+		{
+			name: "recovery URL of other codes",
+			err: &LaunchError{
+				Code:        ErrCodeExpired,
+				Status:      http.StatusUnauthorized,
+				RecoveryURL: "https://tool.example.com/launch",
+			},
+			status:   http.StatusUnauthorized,
+			excludes: []string{"Open in new window"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			DefaultErrorHandler(w, httptest.NewRequest("POST", "/launch", nil), test.err)
+			assert.Equal(t, test.status, w.Code)
+			assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+			body := w.Body.String()
+			for _, s := range test.contains {
+				assert.Contains(t, body, s)
+			}
+			for _, s := range test.excludes {
+				assert.False(t, strings.Contains(body, s), "page contains %q", s)
+			}
+		})
+	}
+}
+
+func TestHandleLaunchError(t *testing.T) {
+	ltis := testService()
+	lerr := newLaunchError(ErrCodeDeploymentUnknown, fmt.Errorf("Unknown deployment %q", "d-1"))
+
+	var reported *LaunchError
+	ltis.SetErrorReporter(func(req *http.Request, err *LaunchError) {
+		reported = err
+	})
+	w := httptest.NewRecorder()
+	ltis.handleLaunchError(w, httptest.NewRequest("POST", "/launch", nil), lerr)
+	assert.Equal(t, lerr, reported)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "the default page is rendered")
+
+	ltis.SetErrorHandler(func(w http.ResponseWriter, req *http.Request, err *LaunchError) {
+		http.Error(w, string(err.Code), http.StatusTeapot)
+	})
+	w = httptest.NewRecorder()
+	ltis.handleLaunchError(w, httptest.NewRequest("POST", "/launch", nil), lerr)
+	assert.Equal(t, http.StatusTeapot, w.Code)
+	assert.Equal(t, "deployment_unknown\n", w.Body.String())
+}
+
+// recoveryForm returns the request the "Open in new window" form of a cookie_blocked error page posts
+func recoveryForm(t *testing.T, page string) *http.Request {
+	action := regexp.MustCompile(`<form method="POST" action="([^"]*)" target="_blank">`).FindStringSubmatch(page)
+	require.NotNil(t, action, "the page has no recovery form: %s", page)
+	form := url.Values{}
+	for _, field := range regexp.MustCompile(`<input type="hidden" name="([^"]*)" value="([^"]*)">`).FindAllStringSubmatch(page, -1) {
+		form.Set(html.UnescapeString(field[1]), html.UnescapeString(field[2]))
+	}
+	req := httptest.NewRequest("POST", html.UnescapeString(action[1]), strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func TestCookieBlockedRecovery(t *testing.T) {
+	keySet := keySetServer(t)
+	defer keySet.Close()
+	blockedLaunch := func(handler http.Handler) string {
+		req := launchRequest(signRawPayload(t, validLaunchPayload()))
+		req.Header.Del("Cookie")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Contains(t, w.Body.String(), "Error code: cookie_blocked")
+		return w.Body.String()
+	}
+
+	ltis := NewLTIService(nil, Config{PlatformIssuer: testIssuer, ClientID: testClientID, KeySetURL: keySet.URL})
+	launches := 0
+	handler := ltis.GetLaunchContextHandler(func(*Launch) { launches++ })
+	assert.NotContains(t, blockedLaunch(handler), "Open in new window", "without a state store the launch cannot be checked again")
+
+	ltis.SetStateStore(NewMemoryStateStore(0))
+	require.NoError(t, ltis.States.SaveState(nil, nil, testStateRecord(time.Now())))
+	page := blockedLaunch(handler)
+	assert.Equal(t, 0, launches)
+
+	recovery := recoveryForm(t, page)
+	assert.Equal(t, "/launch", recovery.URL.Path)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, recovery)
+	assert.Equal(t, 1, launches, "the launch posted from the new window is accepted: %d %s", w.Code, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, recoveryForm(t, page))
+	assert.Equal(t, 1, launches, "the state store's record is single use")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
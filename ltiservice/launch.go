@@ -3,93 +3,264 @@ package ltiservice
 import (
 	"fmt"
 	"net/http"
-	"time"
+	"strings"
 
 	"github.com/MZDevinc/go-lti/lti"
-	jwtmiddleware "github.com/auth0/go-jwt-middleware"
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/pkg/errors"
 )
 
-// The name of the property in the request where the user information
-// from the JWT will be stored.
-const userProperty = "user"
+// Launch holds a validated launch message together with the records the tool resolved for it
+type Launch struct {
+	// ID the launch ID to pass to GetLaunch in later requests; empty when no launch store is configured or saving failed
+	ID         string
+	Message    lti.LaunchMessage
+	Deployment *Deployment
+	// AGS and NRPS connect to the assignment and grade and the names and roles services of the launch, if it offers them
+	AGS  *AGService
+	NRPS *NRPService
+	// SessionToken a signed tool session token for later API calls; empty unless LTIService.SessionTokenTTL is set
+	SessionToken string
+}
 
 //GetLaunchHandler Returns a handler for a LaunchMessage
 //Once the incoming JWT is decoded and validated, the provided callback function will
 //be executed
 func (ltis *LTIService) GetLaunchHandler(callback func(lti.LaunchMessage)) http.Handler {
+	return ltis.GetLaunchContextHandler(func(launch *Launch) {
+		callback(launch.Message)
+	})
+}
+
+//GetLaunchContextHandler Returns a handler for a LaunchMessage, like GetLaunchHandler
+//The callback receives the full Launch, including the resolved deployment record
+func (ltis *LTIService) GetLaunchContextHandler(callback func(*Launch)) http.Handler {
 	handlerFunc := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		ltis.launch(w, req, callback)
 	})
+	return handlerFunc
+}
 
-	//Wraps the handler with middleware that decodes the incoming JWT
-	opts := jwtmiddleware.Options{
-		SigningMethod: jwt.SigningMethodRS256,
-		UserProperty:  userProperty,
-		Extractor: func(r *http.Request) (string, error) {
-			return r.FormValue("id_token"), nil
-		},
-		Debug:               true,
-		ValidationKeyGetter: ltis.getValidationKey,
-		ErrorHandler:        tokenMWErrorHandler,
+func (ltis *LTIService) launch(w http.ResponseWriter, req *http.Request, callback func(*Launch)) {
+	//Select the registration the token claims to come from; its keys and settings are used from here on
+	svc, lerr := ltis.launchRegistration(req)
+	if lerr != nil {
+		ltis.handleLaunchError(w, req, lerr)
+		return
 	}
-	jwtMW := jwtmiddleware.New(opts)
-
-	return jwtMW.Handler(handlerFunc)
+	svc.completeLaunch(w, req, callback)
 }
 
-func (ltis *LTIService) launch(w http.ResponseWriter, req *http.Request, callback func(lti.LaunchMessage)) {
-	//Extract claims from the JWT
-	userToken := req.Context().Value(userProperty)
-	tok := userToken.(*jwt.Token)
+func (ltis *LTIService) completeLaunch(w http.ResponseWriter, req *http.Request, callback func(*Launch)) {
+	//Decode the incoming JWT and extract its claims
+	tok, lerr := ltis.parseIDToken(req)
+	if lerr != nil {
+		ltis.handleLaunchError(w, req, lerr)
+		return
+	}
 	claims := tok.Claims.(jwt.MapClaims)
 
-	//Validate state
-	if err := ltis.validateState(req); err != nil {
-		http.Error(w, err.Error(), 401)
+	//Validate state as the registration's state mode requires
+	if !ltis.checkLaunchState(w, req, claims) {
 		return
 	}
 
 	//Validate nonce
 	//disabled for now because apparently it doesn't work anyway
 
-	//Validate client ID
-	if err := ltis.validateClientID(claims); err != nil {
-		http.Error(w, err.Error(), 401)
+	//Validate issuer, client ID and timing
+	if lerr := ltis.validateIDToken(claims); lerr != nil {
+		ltis.handleLaunchError(w, req, lerr)
+		return
+	}
+
+	//Decode the claims into a typed message; malformed claims fail here instead of panicking later
+	launchMessage, err := lti.ParseLaunchMessage(claims)
+	if err != nil {
+		ltis.handleLaunchError(w, req, newLaunchError(ErrCodeInvalidMessage, err))
 		return
 	}
 
 	//Validate deployment
-	if err := ltis.validateDeployment(claims); err != nil {
-		http.Error(w, err.Error(), 401)
+	if err := validateDeployment(launchMessage); err != nil {
+		ltis.handleLaunchError(w, req, newLaunchError(ErrCodeDeploymentUnknown, err))
 		return
 	}
 
 	//Validate message
-	if err := ltis.validateMessage(claims); err != nil {
-		http.Error(w, err.Error(), 401)
+	if err := validateMessage(launchMessage); err != nil {
+		ltis.handleLaunchError(w, req, newLaunchError(ErrCodeInvalidMessage, err))
 		return
 	}
 
-	//Validate timing
-	if err := ltis.validateTiming(claims); err != nil {
-		http.Error(w, err.Error(), 401)
+	//Validate the target against the registration's allowlist, so the tool never forwards to a foreign page
+	if err := ltis.validateTargetLinkURI(launchMessage); err != nil {
+		ltis.handleLaunchError(w, req, newLaunchError(ErrCodeTargetMismatch, err))
 		return
 	}
 
-	// launchMessage, err := lti.ParseLaunchMessage(claims)
-	launchMessage, err := lti.ParseLaunchMessage(claims)
+	//Resolve deployment against the allowlist
+	deployment, err := ltis.resolveDeployment(launchMessage)
 	if err != nil {
-		http.Error(w, err.Error(), 401)
+		ltis.handleLaunchError(w, req, newLaunchError(ErrCodeDeploymentUnknown, err))
+		return
+	}
+
+	launch := &Launch{Message: launchMessage, Deployment: deployment}
+	ltis.attachServices(launch)
+
+	//Keep the launch for later requests of the same user
+	if err := ltis.saveLaunch(w, req, launch); err != nil {
+		//The launch itself is valid; without a launch ID the tool can still use it, just not look it up later
+		ltis.debug("Failed saving launch: %v", err)
+		launch.ID = ""
+	}
+
+	//Mint a tool session token for front ends that cannot rely on cookies
+	if err := ltis.mintSessionToken(launch); err != nil {
+		ltis.handleLaunchError(w, req, newLaunchError(ErrCodeInternal, errors.Wrap(err, "Failed creating session token")))
+		return
+	}
+
+	callback(launch)
+}
+
+//checkLaunchState matches the launch with its login through the state cookies, the platform's postMessage storage
+//and the state store, as Config.StateMode requires
+//It returns false once it has written a response, either an error or the page reading the postMessage storage.
+func (ltis *LTIService) checkLaunchState(w http.ResponseWriter, req *http.Request, claims jwt.MapClaims) bool {
+	mode := ltis.stateMode()
+	if mode == StateModeCookieOrStore && ltis.States != nil {
+		//A record the store has decides the launch; only a login the store never saw falls back to the cookies
+		record, err := ltis.takeStoredState(w, req)
+		if err == nil && record != nil {
+			err = validateStateRecord(record, claims)
+			if err == nil {
+				return true
+			}
+		}
+		if err != nil {
+			ltis.handleLaunchError(w, req, asLaunchError(err, ErrCodeStateMismatch))
+			return false
+		}
 	}
 
-	callback(launchMessage)
+	if mode == StateModeCookie && ltis.States != nil && req.PostFormValue(recoveryField) != "" {
+		//The launch was posted again from the cookie_blocked error page in a new window, where the login's cookies
+		//are not available either; the single-use record the state store keeps of the login stands in for them
+		if err := ltis.validateStoredState(w, req, claims); err != nil {
+			ltis.handleLaunchError(w, req, asLaunchError(err, ErrCodeStateMismatch))
+			return false
+		}
+		return true
+	}
+
+	if mode != StateModeStore {
+		//Use the platform's postMessage storage when the state cookies did not make it through
+		//The storage values are posted in the same form as the state, so they only count together with the
+		//single-use record the state store keeps of the login
+		if ltis.readsClientStorage(req) && !hasStateCookies(req) {
+			if !hasClientStorageValues(req) {
+				ltis.renderStorageGetPage(w, req, claims)
+				return false
+			}
+			if err := validateClientStorage(req, claims); err != nil {
+				ltis.handleLaunchError(w, req, asLaunchError(err, ErrCodeStateMismatch))
+				return false
+			}
+			if err := ltis.validateStoredState(w, req, claims); err != nil {
+				ltis.handleLaunchError(w, req, asLaunchError(err, ErrCodeStateMismatch))
+				return false
+			}
+			return true
+		} else if err := ltis.validateState(req); err != nil {
+			lerr := asLaunchError(err, ErrCodeStateMismatch)
+			if lerr.Code == ErrCodeCookieBlocked && mode == StateModeCookie && ltis.States != nil {
+				//Offer to post the launch again outside of the platform's frame, see recoveryField
+				lerr.RecoveryURL = req.URL.RequestURI()
+				lerr.RecoveryFields = map[string]string{
+					"id_token":    req.FormValue("id_token"),
+					"state":       req.FormValue("state"),
+					recoveryField: "1",
+				}
+			}
+			ltis.handleLaunchError(w, req, lerr)
+			return false
+		} else if err := validateTargetCookie(req, claims); err != nil {
+			ltis.handleLaunchError(w, req, newLaunchError(ErrCodeTargetMismatch, err))
+			return false
+		}
+		if mode != StateModeCookieAndStore {
+			return true
+		}
+	}
+
+	if err := ltis.validateStoredState(w, req, claims); err != nil {
+		ltis.handleLaunchError(w, req, asLaunchError(err, ErrCodeStateMismatch))
+		return false
+	}
+	return true
+}
+
+//parseIDToken decodes the id_token of the request and verifies its signature
+//Timestamps are not checked here; validateTiming applies the service's ClockPolicy to them later.
+func (ltis *LTIService) parseIDToken(req *http.Request) (*jwt.Token, *LaunchError) {
+	idToken := req.FormValue("id_token")
+	if idToken == "" {
+		return nil, newLaunchError(ErrCodeTokenMissing, fmt.Errorf("Required id_token not found"))
+	}
+
+	parser := jwt.Parser{
+		ValidMethods:         []string{jwt.SigningMethodRS256.Alg()},
+		SkipClaimsValidation: true,
+	}
+	tok, err := parser.Parse(idToken, ltis.getValidationKey)
+	if err != nil {
+		code := ErrCodeInvalidToken
+		if vErr, ok := err.(*jwt.ValidationError); ok {
+			//Unverifiable means no key could be found for the token, e.g. the platform's key set is unreachable
+			if vErr.Errors&jwt.ValidationErrorUnverifiable != 0 {
+				code = ErrCodeKeyUnavailable
+			} else if vErr.Errors&jwt.ValidationErrorSignatureInvalid != 0 {
+				code = ErrCodeBadSignature
+			}
+		}
+		return nil, newLaunchError(code, errors.Wrap(err, "Token issue"))
+	}
+	if _, ok := tok.Claims.(jwt.MapClaims); !ok {
+		return nil, newLaunchError(ErrCodeInvalidToken, fmt.Errorf("Could not get JWT claims"))
+	}
+	return tok, nil
 }
 
-//tokenMWErrorHandler provided to the JWT middleware for it to handle errors
-func tokenMWErrorHandler(w http.ResponseWriter, r *http.Request, err string) {
-	http.Error(w, fmt.Sprintf("Token issue: %s", err), 401)
+//launchRegistration selects the registration matching the unverified iss and aud claims of the id_token
+//A missing or undecodable token is left for parseIDToken to report.
+func (ltis *LTIService) launchRegistration(req *http.Request) (*LTIService, *LaunchError) {
+	if ltis.Registrations == nil {
+		return ltis, nil
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(req.FormValue("id_token"), claims); err != nil {
+		return ltis, nil
+	}
+	iss, ok := claims["iss"].(string)
+	if !ok || iss == "" {
+		return nil, newLaunchError(ErrCodeIssuerMismatch, fmt.Errorf("Token is missing issuer (iss) claim"))
+	}
+	aud, err := audiences(claims)
+	if err != nil {
+		return nil, newLaunchError(ErrCodeClientIDMismatch, err)
+	}
+	if azp, ok := claims["azp"].(string); ok {
+		aud = []string{azp}
+	}
+
+	svc, err := ltis.findRegistration(iss, aud...)
+	if err != nil {
+		return nil, newLaunchError(ErrCodeIssuerMismatch, err)
+	}
+	return svc, nil
 }
 
 func (ltis *LTIService) validateState(req *http.Request) error {
@@ -101,7 +272,11 @@ func (ltis *LTIService) validateState(req *http.Request) error {
 	stateCookie2, err2 := req.Cookie(cookieName2)
 
 	if err != nil && err2 != nil {
-		return errors.Wrap(err, "Missing authentication cookie\nPlease ensure that your browser is not blocking cookies\nError")
+		// If no state cookie arrived at all, the browser is most likely refusing cookies inside the platform's frame
+		if !hasStateCookies(req) {
+			return newLaunchError(ErrCodeCookieBlocked, errors.Wrap(err, "Missing authentication cookie\nPlease ensure that your browser is not blocking cookies\nError"))
+		}
+		return newLaunchError(ErrCodeStateMismatch, fmt.Errorf("No state cookie matches state %q", stateVal))
 	}
 	if (stateCookie == nil || stateCookie.Value == "") && (stateCookie2 == nil || stateCookie2.Value == "") {
 		return fmt.Errorf("Empty state cookie in request")
@@ -112,6 +287,19 @@ func (ltis *LTIService) validateState(req *http.Request) error {
 	return nil
 }
 
+//recoveryField the form field marking a launch posted again from the cookie_blocked error page
+const recoveryField = "lti_recovery"
+
+//hasStateCookies checks whether the request carries any state cookie set by the login step
+func hasStateCookies(req *http.Request) bool {
+	for _, cookie := range req.Cookies() {
+		if strings.HasPrefix(cookie.Name, "mzdevinc_lti_go_") || strings.HasPrefix(cookie.Name, "mzdevinc_lti_go2_") {
+			return true
+		}
+	}
+	return false
+}
+
 // func (ltis *LTIService) validateNonce(req *http.Request, nonce string) error {
 // 	nonceOk := cache.CheckNonce(req, nonce)
 // 	if nonceOk {
@@ -125,134 +313,185 @@ func (ltis *LTIService) validateState(req *http.Request) error {
 // 	return nil
 // }
 
-func (ltis *LTIService) validateClientID(claims jwt.MapClaims) error {
-	var aud string
-	var audClaim interface{} = claims["aud"]
-	switch v := audClaim.(type) {
-	case string:
-		aud = v
-	case []string:
-		aud = v[0]
-	default:
-		return fmt.Errorf("aud claim is unexpected type: %T", v)
+//validateIDToken checks the id_token claims that bind the token to this tool's registration
+func (ltis *LTIService) validateIDToken(claims jwt.MapClaims) *LaunchError {
+	if err := ltis.validateIssuer(claims); err != nil {
+		return newLaunchError(ErrCodeIssuerMismatch, err)
 	}
-	// check that the clientIds match
-	if ltis.Config.ClientID != aud {
-		return fmt.Errorf("ClientId does not match issuer registration")
+	if err := ltis.validateClientID(claims); err != nil {
+		return newLaunchError(ErrCodeClientIDMismatch, err)
+	}
+	if err := ltis.validateTiming(claims); err != nil {
+		return asLaunchError(err, ErrCodeInvalidTiming)
 	}
 	return nil
 }
 
-func (ltis *LTIService) validateDeployment(claims jwt.MapClaims) error {
-	depID, ok := claims["https://purl.imsglobal.org/spec/lti/claim/deployment_id"]
-	if !ok {
-		return fmt.Errorf("No deployment ID")
+func (ltis *LTIService) validateIssuer(claims jwt.MapClaims) error {
+	iss, ok := claims["iss"].(string)
+	if !ok || iss == "" {
+		return fmt.Errorf("Token is missing issuer (iss) claim")
 	}
-	depIDStr := depID.(string)
-	if depIDStr == "" {
-		return fmt.Errorf("No deployment ID")
+	if ltis.Config.PlatformIssuer == "" {
+		return fmt.Errorf("No platform issuer is configured for client ID %q, set Config.PlatformIssuer to %q to accept its launches", ltis.Config.ClientID, iss)
+	}
+	if iss != ltis.Config.PlatformIssuer {
+		return fmt.Errorf("Issuer %q does not match registered platform issuer %q", iss, ltis.Config.PlatformIssuer)
 	}
-
 	return nil
 }
 
-func (ltis *LTIService) validateMessage(claims jwt.MapClaims) error {
-	msgType, ok := claims["https://purl.imsglobal.org/spec/lti/claim/message_type"]
-	if !ok {
-		return fmt.Errorf("Empty message type not allowed")
+//validateClientID checks the audience of the token according to OpenID Connect Core 1.0 section 3.1.3.7
+//The audience must contain our client ID, and when there are several audiences the authorized party (azp) must be us
+func (ltis *LTIService) validateClientID(claims jwt.MapClaims) error {
+	aud, err := audiences(claims)
+	if err != nil {
+		return err
 	}
-	msgTypeStr := msgType.(string)
 
-	switch msgTypeStr {
-	case "":
-		return fmt.Errorf("Empty message type not allowed")
-	case "LtiResourceLinkRequest":
-		return validateMessageTypeLinkRequest(claims)
-	case "LtiDeepLinkingRequest":
-		return validateMessageTypeDeepLink(claims)
-	default:
-		return fmt.Errorf("unknown message type (%q)", msgType)
+	found := false
+	for _, a := range aud {
+		if a == ltis.Config.ClientID {
+			found = true
+			break
+		}
 	}
-}
-
-func (ltis *LTIService) validateTiming(claims jwt.MapClaims) error {
-	iatRaw, ok := claims["iat"]
-	if !ok {
-		return fmt.Errorf("Token creation time is missing")
+	if !found {
+		return fmt.Errorf("Audience %q does not contain registered client ID %q", aud, ltis.Config.ClientID)
 	}
-	iat := iatRaw.(float64)
 
-	expRaw, ok := claims["exp"]
+	azpRaw, hasAzp := claims["azp"]
+	if !hasAzp {
+		if len(aud) > 1 {
+			return fmt.Errorf("Token with multiple audiences is missing authorized party (azp) claim")
+		}
+		return nil
+	}
+	azp, ok := azpRaw.(string)
 	if !ok {
-		return fmt.Errorf("Token expiration time is missing")
+		return fmt.Errorf("azp claim is unexpected type: %T", azpRaw)
 	}
-	exp := expRaw.(float64)
+	if azp != ltis.Config.ClientID {
+		return fmt.Errorf("Authorized party %q does not match registered client ID %q", azp, ltis.Config.ClientID)
+	}
+	return nil
+}
 
-	currentTime := float64(time.Now().Unix())
-	if iat-1 > currentTime {
-		return fmt.Errorf("Token creation time is invalid")
+//audiences returns the aud claim, which may be a single string or an array
+func audiences(claims jwt.MapClaims) ([]string, error) {
+	var aud []string
+	switch v := claims["aud"].(type) {
+	case string:
+		aud = []string{v}
+	case []string:
+		aud = v
+	case []interface{}:
+		for _, a := range v {
+			str, ok := a.(string)
+			if !ok {
+				return nil, fmt.Errorf("aud claim contains unexpected type: %T", a)
+			}
+			aud = append(aud, str)
+		}
+	case nil:
+		return nil, fmt.Errorf("Token is missing audience (aud) claim")
+	default:
+		return nil, fmt.Errorf("aud claim is unexpected type: %T", v)
 	}
-	if currentTime > exp {
-		return fmt.Errorf("Token is expired")
+	return aud, nil
+}
+
+func validateDeployment(msg lti.LaunchMessage) error {
+	if msg.DeploymentID == "" {
+		return fmt.Errorf("No deployment ID")
 	}
 
 	return nil
 }
 
-func validateMessageTypeLinkRequest(claims jwt.MapClaims) error {
-	if err := validateMessageTypeCommon(claims); err != nil {
+func validateMessage(msg lti.LaunchMessage) error {
+	switch msg.MessageType {
+	case "":
+		return fmt.Errorf("Empty message type not allowed")
+	case lti.MessageTypeResourceLink:
+		return validateMessageTypeLinkRequest(msg)
+	case lti.MessageTypeDeepLinking:
+		return validateMessageTypeDeepLink(msg)
+	case lti.MessageTypeSubmissionReview:
+		return validateMessageTypeSubmissionReview(msg)
+	default:
+		return fmt.Errorf("unknown message type (%q)", msg.MessageType)
+	}
+}
+
+func (ltis *LTIService) validateTiming(claims jwt.MapClaims) error {
+	return ltis.Clock.validate(claims)
+}
+
+func validateMessageTypeLinkRequest(msg lti.LaunchMessage) error {
+	if err := validateMessageTypeCommon(msg); err != nil {
 		return err
 	}
 
-	rlMap, ok := claims["https://purl.imsglobal.org/spec/lti/claim/resource_link"].(map[string]interface{})
-	if !ok {
+	if msg.ResourceLink == nil {
 		return fmt.Errorf("resource link claim is missing")
 	}
-	if id, ok := rlMap["id"]; !ok || id.(string) == "" {
+	if msg.ResourceLink.ID == "" {
 		return fmt.Errorf("resource link id is missing")
 	}
-	if targetLinkURI, ok := claims["https://purl.imsglobal.org/spec/lti/claim/target_link_uri"]; !ok || targetLinkURI.(string) == "" {
+	if msg.TargetLinkURI == "" {
 		return fmt.Errorf("target link URI is missing")
 	}
 	return nil
 }
 
-func validateMessageTypeDeepLink(claims jwt.MapClaims) error {
-	if err := validateMessageTypeCommon(claims); err != nil {
+func validateMessageTypeDeepLink(msg lti.LaunchMessage) error {
+	if err := validateMessageTypeCommon(msg); err != nil {
 		return err
 	}
 
-	dlsMap, ok := claims["https://purl.imsglobal.org/spec/lti-dl/claim/deep_linking_settings"].(map[string]interface{})
-	if !ok {
+	if msg.DeepLinkingSettings == nil {
 		return fmt.Errorf("deep link settings claim is missing")
 	}
-	if deepLinkReturnURL, ok := dlsMap["deep_link_return_url"]; !ok || deepLinkReturnURL.(string) == "" {
+	if msg.DeepLinkingSettings.DeepLinkReturnURL == "" {
 		return fmt.Errorf("deep link return url is missing")
 	}
 
 	return nil
 }
 
+func validateMessageTypeSubmissionReview(msg lti.LaunchMessage) error {
+	if err := validateMessageTypeCommon(msg); err != nil {
+		return err
+	}
+
+	if msg.ResourceLink == nil || msg.ResourceLink.ID == "" {
+		return fmt.Errorf("resource link claim is missing")
+	}
+	if msg.Endpoint == nil {
+		return fmt.Errorf("assignment and grade services claim is missing")
+	}
+	return nil
+}
+
 //validateMessageTypeCommon checks for claims that should be part of any message type
-func validateMessageTypeCommon(claims jwt.MapClaims) error {
-	if sub, ok := claims["sub"]; !ok || sub.(string) == "" {
+func validateMessageTypeCommon(msg lti.LaunchMessage) error {
+	if msg.Sub == nil || *msg.Sub == "" {
 		return fmt.Errorf("token is missing user (sub) claim")
 	}
-	if version, ok := claims["https://purl.imsglobal.org/spec/lti/claim/version"]; !ok || version.(string) != "1.3.0" {
+	if msg.Version != "1.3.0" {
 		return fmt.Errorf("token has incompatible lti version")
 	}
-	if roles, ok := claims["https://purl.imsglobal.org/spec/lti/claim/roles"]; !ok || roles == nil {
+	if msg.Roles == nil {
 		return fmt.Errorf("token is missing roles claim")
 	}
 	return nil
 }
 
-func isDeepLinkLaunch(claims jwt.MapClaims) bool {
-	msgType := claims["https://purl.imsglobal.org/spec/lti/claim/message_type"].(string)
-	return msgType == "LtiDeepLinkingRequest"
+func isDeepLinkLaunch(msg lti.LaunchMessage) bool {
+	return msg.MessageType == lti.MessageTypeDeepLinking
 }
 
-func isResourceLaunch(claims jwt.MapClaims) bool {
-	msgType := claims["https://purl.imsglobal.org/spec/lti/claim/message_type"].(string)
-	return msgType == "LtiResourceLinkRequest"
+func isResourceLaunch(msg lti.LaunchMessage) bool {
+	return msg.MessageType == lti.MessageTypeResourceLink
 }
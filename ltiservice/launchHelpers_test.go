@@ -0,0 +1,87 @@
+package ltiservice
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MZDevinc/go-lti/lti"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+const testKid = "test-key"
+
+// keySetServer serves the public half of the test key as a JWKS
+func keySetServer(t testing.TB) *httptest.Server {
+	key, err := jwk.New(&testKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := key.Set(jwk.KeyIDKey, testKid); err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(jwk.Set{Keys: []jwk.Key{key}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+}
+
+// signRawPayload signs arbitrary bytes as a JWT payload, which need not be valid JSON
+func signRawPayload(t testing.TB, payload []byte) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT","kid":"` + testKid + `"}`))
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, testKey, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// launchRequest posts the id_token with the state and state cookie of a login
+func launchRequest(idToken string) *http.Request {
+	const state = "state-fuzz"
+	form := url.Values{}
+	form.Set("id_token", idToken)
+	form.Set("state", state)
+
+	req := httptest.NewRequest("POST", "/launch", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "mzdevinc_lti_go_" + state, Value: state})
+	return req
+}
+
+// validLaunchPayload is a valid resource link launch for the test registration
+func validLaunchPayload() []byte {
+	now := time.Now().Unix()
+	payload, _ := json.Marshal(map[string]interface{}{
+		"iss":   testIssuer,
+		"aud":   testClientID,
+		"iat":   now,
+		"exp":   now + 60,
+		"nonce": "nonce-fuzz",
+		"sub":   "user-1",
+		"https://purl.imsglobal.org/spec/lti/claim/message_type":    "LtiResourceLinkRequest",
+		"https://purl.imsglobal.org/spec/lti/claim/version":         "1.3.0",
+		"https://purl.imsglobal.org/spec/lti/claim/deployment_id":   "deployment-1",
+		"https://purl.imsglobal.org/spec/lti/claim/target_link_uri": "https://tool.example.com/launch",
+		"https://purl.imsglobal.org/spec/lti/claim/roles":           []string{lti.ContextRoleInstructor},
+		"https://purl.imsglobal.org/spec/lti/claim/resource_link":   map[string]interface{}{"id": "link-1"},
+	})
+	return payload
+}
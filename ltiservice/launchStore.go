@@ -0,0 +1,301 @@
+package ltiservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/MZDevinc/go-lti/lti"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/sessions"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// DefaultLaunchTTL how long a launch stays in a launch store when no other TTL is given
+const DefaultLaunchTTL = 2 * time.Hour
+
+// ErrLaunchNotFound is returned by GetLaunch for launch IDs that are unknown or expired
+var ErrLaunchNotFound = errors.New("launch not found or expired")
+
+// StoredLaunch a validated launch kept in a LaunchStore, with the registration it came through
+type StoredLaunch struct {
+	ID         string
+	Message    lti.LaunchMessage
+	Deployment *Deployment // used by GetLaunch when the deployment store does not have the deployment; may be nil
+	// Issuer and ClientID identify the platform registration that validated the launch
+	Issuer   string
+	ClientID string
+	Created  time.Time
+}
+
+// LaunchStore keeps validated launches, so that later requests of the same user can use them by launch ID
+type LaunchStore interface {
+	// SaveLaunch stores the launch under its ID
+	SaveLaunch(w http.ResponseWriter, req *http.Request, launch StoredLaunch) error
+	// FindLaunch returns the launch with the ID, or nil (with no error) if it is unknown or expired
+	FindLaunch(req *http.Request, launchID string) (*StoredLaunch, error)
+}
+
+// SetLaunchStore Define the store that keeps every validated launch under a launch ID, see Launch.ID and GetLaunch
+func (ltis *LTIService) SetLaunchStore(store LaunchStore) {
+	ltis.Launches = store
+}
+
+// saveLaunch stores the launch under a new launch ID, which it sets on the launch
+func (ltis *LTIService) saveLaunch(w http.ResponseWriter, req *http.Request, launch *Launch) error {
+	if ltis.Launches == nil {
+		return nil
+	}
+	launch.ID = uuid.NewV4().String()
+	return ltis.Launches.SaveLaunch(w, req, StoredLaunch{
+		ID:         launch.ID,
+		Message:    launch.Message,
+		Deployment: launch.Deployment,
+		Issuer:     ltis.Config.PlatformIssuer,
+		ClientID:   ltis.Config.ClientID,
+		Created:    time.Now(),
+	})
+}
+
+// GetLaunch Returns the launch saved under the launch ID, with service connections for the platform it came from
+// The request is passed to the launch store, which may need it to find the user's session. The platform registration
+// is looked up again by issuer and client ID, see SetRegistrationStore. ErrLaunchNotFound is returned for unknown and
+// expired launch IDs.
+func (ltis *LTIService) GetLaunch(req *http.Request, launchID string) (*Launch, error) {
+	if ltis.Launches == nil {
+		return nil, fmt.Errorf("No launch store is configured")
+	}
+	stored, err := ltis.Launches.FindLaunch(req, launchID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed looking up launch %q", launchID)
+	}
+	if stored == nil {
+		return nil, ErrLaunchNotFound
+	}
+
+	svc, err := ltis.findRegistration(stored.Issuer, stored.ClientID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed finding the registration of launch %q", launchID)
+	}
+	dep, err := svc.findLaunchDeployment(stored.Message, stored.Deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	launch := &Launch{ID: stored.ID, Message: stored.Message, Deployment: dep}
+	svc.attachServices(launch)
+	return launch, nil
+}
+
+// findLaunchDeployment returns the deployment of a stored launch from the deployment store, so that revocations and
+// changed settings apply to launches saved before. If the store does not have it, the deployment saved with the launch
+// is returned, or one with only the launch's IDs.
+func (ltis *LTIService) findLaunchDeployment(msg lti.LaunchMessage, saved *Deployment) (*Deployment, error) {
+	if ltis.Deployments != nil {
+		dep, err := ltis.Deployments.FindDeployment(msg.Iss, msg.Aud, msg.DeploymentID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed looking up deployment %q", msg.DeploymentID)
+		}
+		if dep != nil {
+			if dep.Revoked {
+				return nil, fmt.Errorf("Deployment %q was revoked", msg.DeploymentID)
+			}
+			return dep, nil
+		}
+	}
+	if saved != nil {
+		return saved, nil
+	}
+	return &Deployment{Issuer: msg.Iss, ClientID: msg.Aud, DeploymentID: msg.DeploymentID}, nil
+}
+
+// attachServices sets the assignment and grade and the names and roles services the launch offers
+func (ltis *LTIService) attachServices(launch *Launch) {
+	if ags, err := ltis.GetAGService(launch.Message); err == nil {
+		launch.AGS = ags
+	}
+	if nrps, err := ltis.GetNRPService(launch.Message); err == nil {
+		launch.NRPS = nrps
+	}
+}
+
+func launchTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return DefaultLaunchTTL
+	}
+	return ttl
+}
+
+// MemoryLaunchStore a LaunchStore that keeps launches in memory
+// It only works when the launch and later requests reach the same process.
+type MemoryLaunchStore struct {
+	mu       sync.RWMutex
+	ttl      time.Duration
+	now      func() time.Time
+	launches map[string]StoredLaunch
+}
+
+// NewMemoryLaunchStore Returns a MemoryLaunchStore whose launches expire after the TTL, or DefaultLaunchTTL if zero
+func NewMemoryLaunchStore(ttl time.Duration) *MemoryLaunchStore {
+	return &MemoryLaunchStore{ttl: launchTTL(ttl), now: time.Now, launches: map[string]StoredLaunch{}}
+}
+
+// SaveLaunch stores the launch under its ID, dropping expired launches
+func (s *MemoryLaunchStore) SaveLaunch(w http.ResponseWriter, req *http.Request, launch StoredLaunch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for id, existing := range s.launches {
+		if now.Sub(existing.Created) > s.ttl {
+			delete(s.launches, id)
+		}
+	}
+	s.launches[launch.ID] = launch
+	return nil
+}
+
+// FindLaunch returns the launch with the ID, or nil if it is unknown or expired
+func (s *MemoryLaunchStore) FindLaunch(req *http.Request, launchID string) (*StoredLaunch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	launch, ok := s.launches[launchID]
+	if !ok || s.now().Sub(launch.Created) > s.ttl {
+		return nil, nil
+	}
+	return &launch, nil
+}
+
+// SessionLaunchStore a LaunchStore that keeps the latest launch of a user in a gorilla session, such as LTIService.Store
+// To fit in a cookie, the session holds a single launch: each launch replaces the previous one, so an earlier launch
+// ID (from another tab or course) is no longer found. Only the claims that identify the launch and the services it
+// offers are kept (see sessionLaunchClaims): user profile, presentation, custom and extension claims are dropped, and
+// the registration and deployment are looked up again in GetLaunch. Use a MemoryLaunchStore or a LaunchStore of your
+// own to keep several or full launches.
+type SessionLaunchStore struct {
+	store sessions.Store
+	name  string
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+// NewSessionLaunchStore Returns a SessionLaunchStore using the named session of the store, whose launches expire
+// after the TTL, or DefaultLaunchTTL if zero
+func NewSessionLaunchStore(store sessions.Store, sessionName string, ttl time.Duration) *SessionLaunchStore {
+	return &SessionLaunchStore{store: store, name: sessionName, ttl: launchTTL(ttl), now: time.Now}
+}
+
+// sessionLaunchClaims the claims of a launch message a SessionLaunchStore keeps
+var sessionLaunchClaims = []string{
+	"iss", "aud", "sub", "iat", "exp", "nonce",
+	"https://purl.imsglobal.org/spec/lti/claim/message_type",
+	"https://purl.imsglobal.org/spec/lti/claim/version",
+	"https://purl.imsglobal.org/spec/lti/claim/deployment_id",
+	"https://purl.imsglobal.org/spec/lti/claim/target_link_uri",
+	"https://purl.imsglobal.org/spec/lti/claim/resource_link",
+	"https://purl.imsglobal.org/spec/lti/claim/roles",
+	"https://purl.imsglobal.org/spec/lti/claim/context",
+	"https://purl.imsglobal.org/spec/lti-dl/claim/deep_linking_settings",
+	"https://purl.imsglobal.org/spec/lti-ags/claim/endpoint",
+	"https://purl.imsglobal.org/spec/lti-nrps/claim/namesroleservice",
+}
+
+// sessionLaunch the serialized form of a StoredLaunch
+type sessionLaunch struct {
+	ID       string                 `json:"id"`
+	Claims   map[string]interface{} `json:"claims"`
+	ClientID string                 `json:"client_id"`
+	Created  int64                  `json:"created"`
+}
+
+// SaveLaunch stores the launch in the session, replacing the launch saved before
+func (s *SessionLaunchStore) SaveLaunch(w http.ResponseWriter, req *http.Request, launch StoredLaunch) error {
+	sess, err := s.store.Get(req, s.name)
+	if err != nil {
+		return errors.Wrapf(err, "Failed loading session %q", s.name)
+	}
+
+	claims, err := messageClaims(launch.Message)
+	if err != nil {
+		return err
+	}
+	kept := make(map[string]interface{}, len(sessionLaunchClaims))
+	for _, name := range sessionLaunchClaims {
+		if value, ok := claims[name]; ok && value != nil {
+			kept[name] = value
+		}
+	}
+	encoded, err := json.Marshal(sessionLaunch{
+		ID:       launch.ID,
+		Claims:   kept,
+		ClientID: launch.ClientID,
+		Created:  launch.Created.Unix(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "Failed to serialize launch")
+	}
+	sess.Values[launchSessionKey] = string(encoded)
+	return sess.Save(req, w)
+}
+
+// FindLaunch returns the launch with the ID from the session, or nil if it is unknown or expired
+func (s *SessionLaunchStore) FindLaunch(req *http.Request, launchID string) (*StoredLaunch, error) {
+	sess, err := s.store.Get(req, s.name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed loading session %q", s.name)
+	}
+	value, ok := sess.Values[launchSessionKey]
+	if !ok {
+		return nil, nil
+	}
+	launch, err := s.decode(value)
+	if err != nil {
+		return nil, err
+	}
+	if launch.ID != launchID || s.now().Sub(launch.Created) > s.ttl {
+		return nil, nil
+	}
+	return launch, nil
+}
+
+func (s *SessionLaunchStore) decode(value interface{}) (*StoredLaunch, error) {
+	encoded, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("Session launch has unexpected type %T", value)
+	}
+	stored := sessionLaunch{}
+	if err := json.Unmarshal([]byte(encoded), &stored); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse session launch")
+	}
+	msg, err := lti.ParseLaunchMessage(jwt.MapClaims(stored.Claims))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse session launch message")
+	}
+	return &StoredLaunch{
+		ID:       stored.ID,
+		Message:  msg,
+		Issuer:   msg.Iss,
+		ClientID: stored.ClientID,
+		Created:  time.Unix(stored.Created, 0),
+	}, nil
+}
+
+// launchSessionKey the session value holding the launch of a SessionLaunchStore
+const launchSessionKey = "lti_launch"
+
+// messageClaims returns the standard claims of a launch message, without its extension claims
+func messageClaims(msg lti.LaunchMessage) (map[string]interface{}, error) {
+	encoded, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to serialize launch message")
+	}
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(encoded, &claims); err != nil {
+		return nil, errors.Wrap(err, "Failed to serialize launch message")
+	}
+	return claims, nil
+}
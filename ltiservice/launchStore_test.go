@@ -0,0 +1,316 @@
+package ltiservice
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MZDevinc/go-lti/lti"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serviceLaunchPayload is a valid launch offering assignment and grade and names and roles services
+func serviceLaunchPayload() []byte {
+	claims := map[string]interface{}{}
+	json.Unmarshal(validLaunchPayload(), &claims)
+	claims["https://purl.imsglobal.org/spec/lti-ags/claim/endpoint"] = map[string]interface{}{
+		"scope":     []string{lti.ScopeLineItem, lti.ScopeScore},
+		"lineitems": "https://platform.example.com/lineitems",
+	}
+	claims["https://purl.imsglobal.org/spec/lti-nrps/claim/namesroleservice"] = map[string]interface{}{
+		"context_memberships_url": "https://platform.example.com/memberships",
+		"service_versions":        []string{"2.0"},
+	}
+	claims["https://vendor.example.com/claim"] = map[string]interface{}{"plan": "pro"}
+	payload, _ := json.Marshal(claims)
+	return payload
+}
+
+func TestGetLaunch(t *testing.T) {
+	keySet := keySetServer(t)
+	defer keySet.Close()
+
+	ltis := NewLTIService(nil, Config{
+		PlatformIssuer: testIssuer,
+		ClientID:       testClientID,
+		KeySetURL:      keySet.URL,
+		AuthTokenURL:   "https://platform.example.com/token",
+	})
+	ltis.SetLaunchStore(NewMemoryLaunchStore(0))
+
+	var launched *Launch
+	handler := ltis.GetLaunchContextHandler(func(launch *Launch) {
+		launched = launch
+	})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, launchRequest(signRawPayload(t, serviceLaunchPayload())))
+	require.NotNil(t, launched, "launch was rejected: %d %s", w.Code, w.Body.String())
+	assert.NotEmpty(t, launched.ID)
+	assert.NotNil(t, launched.AGS)
+	assert.NotNil(t, launched.NRPS)
+
+	launch, err := ltis.GetLaunch(httptest.NewRequest("GET", "/api/scores", nil), launched.ID)
+	require.NoError(t, err)
+	assert.Equal(t, launched.ID, launch.ID)
+	assert.Equal(t, "deployment-1", launch.Message.DeploymentID)
+	if assert.NotNil(t, launch.AGS) {
+		assert.True(t, launch.AGS.HasScope(lti.ScopeScore))
+		assert.Equal(t, "https://platform.example.com/token", launch.AGS.ltis.Config.AuthTokenURL)
+	}
+	if assert.NotNil(t, launch.NRPS) {
+		assert.Equal(t, "https://platform.example.com/memberships", launch.NRPS.MembersURL)
+	}
+
+	_, err = ltis.GetLaunch(nil, "unknown")
+	assert.Equal(t, ErrLaunchNotFound, err)
+}
+
+func TestMemoryLaunchStoreExpiry(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryLaunchStore(time.Hour)
+	store.now = func() time.Time { return now }
+
+	assert.NoError(t, store.SaveLaunch(nil, nil, StoredLaunch{ID: "launch-1", Created: now}))
+	launch, err := store.FindLaunch(nil, "launch-1")
+	assert.NoError(t, err)
+	assert.NotNil(t, launch)
+
+	now = now.Add(2 * time.Hour)
+	launch, err = store.FindLaunch(nil, "launch-1")
+	assert.NoError(t, err)
+	assert.Nil(t, launch)
+}
+
+// realisticLaunchPayload is a launch the size platforms send: user profile, course, presentation, custom parameters
+// and vendor claims besides the services
+func realisticLaunchPayload() []byte {
+	claims := map[string]interface{}{}
+	json.Unmarshal(serviceLaunchPayload(), &claims)
+	for key, value := range map[string]interface{}{
+		"name":        "Jacqueline Montgomery-Fitzgerald",
+		"given_name":  "Jacqueline",
+		"family_name": "Montgomery-Fitzgerald",
+		"email":       "jacqueline.montgomery-fitzgerald@students.university.example.edu",
+		"picture":     "https://canvas.university.example.edu/images/thumbnails/1234567/a8Bc9dEf0gHiJkLmNoPqRsTuVwXyZ",
+		"locale":      "en-GB",
+		"https://purl.imsglobal.org/spec/lti/claim/roles": []string{
+			lti.ContextRoleLearner,
+			"http://purl.imsglobal.org/vocab/lis/v2/institution/person#Student",
+			"http://purl.imsglobal.org/vocab/lis/v2/system/person#User",
+		},
+		"https://purl.imsglobal.org/spec/lti/claim/context": map[string]interface{}{
+			"id":    "4dde05e8ca1973bcca9bffc13e1548820eee93a3",
+			"label": "CHEM-2103-A",
+			"title": "Organic Chemistry II: Reaction Mechanisms and Synthesis (Spring Term)",
+			"type":  []string{"http://purl.imsglobal.org/vocab/lis/v2/course#CourseOffering"},
+		},
+		"https://purl.imsglobal.org/spec/lti/claim/resource_link": map[string]interface{}{
+			"id":          "6b0f7a2c-3e47-4c1b-9b0d-2f6f3c1d8e5a",
+			"title":       "Week 7 Problem Set: Nucleophilic Substitution and Elimination",
+			"description": "Work through the mechanisms, then submit your answers for automatic grading.",
+		},
+		"https://purl.imsglobal.org/spec/lti/claim/tool_platform": map[string]interface{}{
+			"guid":                "Wv8pMvXgcQFPvyQ9kSNwvsidHZs3zjIGCi3g2uLS:canvas-lms",
+			"name":                "University of Example",
+			"version":             "cloud",
+			"product_family_code": "canvas",
+		},
+		"https://purl.imsglobal.org/spec/lti/claim/launch_presentation": map[string]interface{}{
+			"document_target": "iframe",
+			"height":          800,
+			"width":           1000,
+			"return_url":      "https://canvas.university.example.edu/courses/48213/external_content/success/external_tool_redirect",
+			"locale":          "en-GB",
+		},
+		"https://purl.imsglobal.org/spec/lti/claim/lis": map[string]interface{}{
+			"person_sourcedid":          "SIS-2019-004417",
+			"course_offering_sourcedid": "CHEM-2103-A-2024SP",
+		},
+		"https://purl.imsglobal.org/spec/lti/claim/custom": map[string]interface{}{
+			"canvas_course_id":       "48213",
+			"canvas_user_id":         "1234567",
+			"canvas_user_login_id":   "jmontgomeryfitzgerald",
+			"canvas_assignment_id":   "902117",
+			"canvas_module_id":       "330981",
+			"section_ids":            "99120,99121",
+			"course_start_at":        "2024-01-15T08:00:00Z",
+			"course_end_at":          "2024-05-10T23:59:59Z",
+			"person_timezone":        "Europe/London",
+			"problem_set_difficulty": "standard",
+		},
+		"https://canvas.instructure.com/lti/account_name":        "Faculty of Natural Sciences",
+		"https://www.instructure.com/placement":                  "assignment_selection",
+		"https://canvas.instructure.com/lti/asset_processor_url": "https://canvas.university.example.edu/api/lti/asset_processors/48213",
+	} {
+		claims[key] = value
+	}
+	payload, _ := json.Marshal(claims)
+	return payload
+}
+
+func TestSessionLaunchStore(t *testing.T) {
+	claims := jwt.MapClaims{}
+	require.NoError(t, json.Unmarshal(serviceLaunchPayload(), &claims))
+	msg, err := lti.ParseLaunchMessage(claims)
+	require.NoError(t, err)
+
+	store := NewSessionLaunchStore(sessions.NewCookieStore([]byte("test-session-key")), "lti", time.Hour)
+	w := httptest.NewRecorder()
+	require.NoError(t, store.SaveLaunch(w, httptest.NewRequest("POST", "/launch", nil), StoredLaunch{
+		ID:         "launch-1",
+		Message:    msg,
+		Deployment: &Deployment{Issuer: testIssuer, DeploymentID: "deployment-1"},
+		Issuer:     testIssuer,
+		ClientID:   testClientID,
+		Created:    time.Now(),
+	}))
+
+	req := httptest.NewRequest("GET", "/api", nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	launch, err := store.FindLaunch(req, "launch-1")
+	require.NoError(t, err)
+	require.NotNil(t, launch)
+	assert.Equal(t, msg.DeploymentID, launch.Message.DeploymentID)
+	assert.Equal(t, msg.Endpoint, launch.Message.Endpoint)
+	assert.Equal(t, msg.Context, launch.Message.Context)
+	assert.False(t, launch.Message.HasExtension("https://vendor.example.com/claim"), "extension claims are not kept")
+	assert.Equal(t, testIssuer, launch.Issuer)
+	assert.Equal(t, testClientID, launch.ClientID)
+	assert.Nil(t, launch.Deployment, "the deployment is looked up again")
+
+	launch, err = store.FindLaunch(httptest.NewRequest("GET", "/api", nil), "launch-1")
+	assert.NoError(t, err)
+	assert.Nil(t, launch, "launches are found only in the user's own session")
+
+	store.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	launch, err = store.FindLaunch(req, "launch-1")
+	assert.NoError(t, err)
+	assert.Nil(t, launch)
+}
+
+func TestGetLaunchFromSession(t *testing.T) {
+	keySet := keySetServer(t)
+	defer keySet.Close()
+
+	ltis := NewLTIService(nil, Config{PlatformIssuer: testIssuer, ClientID: testClientID, KeySetURL: keySet.URL})
+	ltis.SetRegistrationStore(NewMemoryRegistrationStore(Config{
+		PlatformIssuer: testIssuer,
+		ClientID:       testClientID,
+		KeySetURL:      keySet.URL,
+		AuthTokenURL:   "https://platform.example.com/token",
+	}))
+	ltis.SetDeploymentStore(NewMemoryDeploymentStore(Deployment{
+		Issuer:       testIssuer,
+		ClientID:     testClientID,
+		DeploymentID: "deployment-1",
+		Settings:     map[string]interface{}{"plan": "pro"},
+	}))
+	ltis.SetLaunchStore(NewSessionLaunchStore(sessions.NewCookieStore([]byte("test-session-key")), "lti", 0))
+
+	var launched *Launch
+	w := httptest.NewRecorder()
+	ltis.GetLaunchContextHandler(func(launch *Launch) {
+		launched = launch
+	}).ServeHTTP(w, launchRequest(signRawPayload(t, realisticLaunchPayload())))
+	require.NotNil(t, launched, "launch was rejected: %d %s", w.Code, w.Body.String())
+	require.NotEmpty(t, launched.ID, "the launch fits in the session cookie")
+
+	req := httptest.NewRequest("GET", "/api/scores", nil)
+	for _, header := range w.Result().Header["Set-Cookie"] {
+		assert.True(t, len(header) <= 4096, "cookie of %d bytes exceeds the browser limit", len(header))
+	}
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+
+	launch, err := ltis.GetLaunch(req, launched.ID)
+	require.NoError(t, err)
+	assert.Equal(t, launched.Message.Context, launch.Message.Context)
+	assert.Equal(t, launched.Message.Roles, launch.Message.Roles)
+	assert.Equal(t, "pro", launch.Deployment.Settings["plan"])
+	if assert.NotNil(t, launch.AGS) {
+		assert.Equal(t, "https://platform.example.com/token", launch.AGS.ltis.Config.AuthTokenURL, "the registration is looked up again")
+	}
+}
+
+func TestSessionLaunchStoreKeepsLatestLaunch(t *testing.T) {
+	keySet := keySetServer(t)
+	defer keySet.Close()
+
+	ltis := NewLTIService(nil, Config{PlatformIssuer: testIssuer, ClientID: testClientID, KeySetURL: keySet.URL})
+	ltis.SetLaunchStore(NewSessionLaunchStore(sessions.NewCookieStore([]byte("test-session-key")), "lti", 0))
+
+	var cookies []*http.Cookie
+	launch := func() string {
+		var launched *Launch
+		req := launchRequest(signRawPayload(t, realisticLaunchPayload()))
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		ltis.GetLaunchContextHandler(func(launch *Launch) {
+			launched = launch
+		}).ServeHTTP(w, req)
+		require.NotNil(t, launched, "launch was rejected: %d %s", w.Code, w.Body.String())
+		for _, header := range w.Result().Header["Set-Cookie"] {
+			assert.True(t, len(header) <= 4096, "cookie of %d bytes exceeds the browser limit", len(header))
+		}
+		cookies = w.Result().Cookies()
+		return launched.ID
+	}
+
+	first := launch()
+	require.NotEmpty(t, first)
+	second := launch()
+	require.NotEmpty(t, second, "the second launch of the session is saved too")
+	assert.NotEqual(t, first, second)
+
+	req := httptest.NewRequest("GET", "/api/scores", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	found, err := ltis.GetLaunch(req, second)
+	require.NoError(t, err)
+	assert.Equal(t, second, found.ID)
+	_, err = ltis.GetLaunch(req, first)
+	assert.Equal(t, ErrLaunchNotFound, err, "the second launch replaces the first")
+}
+
+// failingLaunchStore a LaunchStore whose saves fail
+type failingLaunchStore struct{}
+
+func (failingLaunchStore) SaveLaunch(http.ResponseWriter, *http.Request, StoredLaunch) error {
+	return errors.New("securecookie: the value is too long")
+}
+
+func (failingLaunchStore) FindLaunch(*http.Request, string) (*StoredLaunch, error) {
+	return nil, nil
+}
+
+func TestLaunchSaveFailure(t *testing.T) {
+	keySet := keySetServer(t)
+	defer keySet.Close()
+
+	ltis := NewLTIService(nil, Config{PlatformIssuer: testIssuer, ClientID: testClientID, KeySetURL: keySet.URL})
+	ltis.SetLaunchStore(failingLaunchStore{})
+	var launched *Launch
+	w := httptest.NewRecorder()
+	ltis.GetLaunchContextHandler(func(launch *Launch) {
+		launched = launch
+	}).ServeHTTP(w, launchRequest(signRawPayload(t, serviceLaunchPayload())))
+	require.NotNil(t, launched, "launch was rejected: %d %s", w.Code, w.Body.String())
+	assert.Empty(t, launched.ID)
+}
+
+func TestGetLaunchWithoutStore(t *testing.T) {
+	_, err := testService().GetLaunch(&http.Request{}, "launch-1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,41 @@
+//go:build go1.18
+// +build go1.18
+
+package ltiservice
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// FuzzLaunchHandler feeds arbitrary signed payloads through the launch handler, which must never panic
+func FuzzLaunchHandler(f *testing.F) {
+	keySet := keySetServer(f)
+	defer keySet.Close()
+
+	f.Add(validLaunchPayload())
+	f.Add([]byte(`{}`))
+	f.Add([]byte(`null`))
+	f.Add([]byte(`[]`))
+	f.Add([]byte(`not json`))
+	f.Add([]byte(`{"iss":1,"aud":[1,2],"azp":{},"iat":"now","exp":true}`))
+	f.Add([]byte(`{"iss":"https://platform.example.com","aud":"tool-client-id","iat":1e300,"exp":-1e300}`))
+	f.Add([]byte(`{"https://purl.imsglobal.org/spec/lti/claim/deployment_id":5,"https://purl.imsglobal.org/spec/lti/claim/message_type":[]}`))
+	f.Add([]byte(`{"sub":7,"https://purl.imsglobal.org/spec/lti/claim/resource_link":"link","https://purl.imsglobal.org/spec/lti/claim/version":1.3}`))
+
+	ltis := NewLTIService(nil, Config{
+		PlatformIssuer: testIssuer,
+		ClientID:       testClientID,
+		KeySetURL:      keySet.URL,
+	})
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		handler := ltis.GetLaunchContextHandler(func(launch *Launch) {
+			if launch.Message.DeploymentID == "" || launch.Deployment == nil {
+				t.Fatalf("callback reached with incomplete launch: %+v", launch)
+			}
+		})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, launchRequest(signRawPayload(t, payload)))
+	})
+}
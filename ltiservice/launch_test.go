@@ -0,0 +1,191 @@
+package ltiservice
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testIssuer   = "https://platform.example.com"
+	testClientID = "tool-client-id"
+)
+
+var testKey *rsa.PrivateKey
+
+func init() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	testKey = key
+}
+
+func testService() *LTIService {
+	return NewLTIService(nil, Config{
+		PlatformIssuer: testIssuer,
+		ClientID:       testClientID,
+	})
+}
+
+// signedClaims signs the claims with the test key and parses them back, as the launch handler would receive them
+func signedClaims(t *testing.T, claims jwt.MapClaims) jwt.MapClaims {
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(testKey)
+	require.NoError(t, err)
+
+	parser := jwt.Parser{SkipClaimsValidation: true}
+	parsed, err := parser.Parse(signed, func(*jwt.Token) (interface{}, error) {
+		return &testKey.PublicKey, nil
+	})
+	require.NoError(t, err)
+	return parsed.Claims.(jwt.MapClaims)
+}
+
+func baseClaims() jwt.MapClaims {
+	now := time.Now().Unix()
+	return jwt.MapClaims{
+		"iss": testIssuer,
+		"aud": testClientID,
+		"iat": now,
+		"exp": now + 60,
+	}
+}
+
+func TestValidateIDToken(t *testing.T) {
+	now := time.Now().Unix()
+	tests := []struct {
+		name    string
+		modify  func(jwt.MapClaims)
+		code    LaunchErrorCode
+		wantErr bool
+	}{
+		{name: "valid", modify: func(c jwt.MapClaims) {}},
+		{name: "missing issuer", modify: func(c jwt.MapClaims) { delete(c, "iss") }, code: ErrCodeIssuerMismatch, wantErr: true},
+		{name: "wrong issuer", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, code: ErrCodeIssuerMismatch, wantErr: true},
+		{name: "missing audience", modify: func(c jwt.MapClaims) { delete(c, "aud") }, code: ErrCodeClientIDMismatch, wantErr: true},
+		{name: "wrong audience", modify: func(c jwt.MapClaims) { c["aud"] = "other-client" }, code: ErrCodeClientIDMismatch, wantErr: true},
+		{name: "audience list with client", modify: func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID}
+		}},
+		{name: "audience list without client", modify: func(c jwt.MapClaims) {
+			c["aud"] = []string{"other-client", "another-client"}
+			c["azp"] = testClientID
+		}, code: ErrCodeClientIDMismatch, wantErr: true},
+		{name: "multiple audiences with azp", modify: func(c jwt.MapClaims) {
+			c["aud"] = []string{"other-client", testClientID}
+			c["azp"] = testClientID
+		}},
+		{name: "multiple audiences without azp", modify: func(c jwt.MapClaims) {
+			c["aud"] = []string{"other-client", testClientID}
+		}, code: ErrCodeClientIDMismatch, wantErr: true},
+		{name: "multiple audiences with wrong azp", modify: func(c jwt.MapClaims) {
+			c["aud"] = []string{"other-client", testClientID}
+			c["azp"] = "other-client"
+		}, code: ErrCodeClientIDMismatch, wantErr: true},
+		{name: "single audience with wrong azp", modify: func(c jwt.MapClaims) { c["azp"] = "other-client" }, code: ErrCodeClientIDMismatch, wantErr: true},
+		{name: "not valid yet", modify: func(c jwt.MapClaims) { c["nbf"] = now + 30 }, code: ErrCodeInvalidTiming, wantErr: true},
+		{name: "valid after nbf", modify: func(c jwt.MapClaims) { c["nbf"] = now - 30 }},
+		{name: "expired", modify: func(c jwt.MapClaims) {
+			c["iat"] = now - 120
+			c["exp"] = now - 60
+		}, code: ErrCodeExpired, wantErr: true},
+	}
+
+	ltis := testService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := baseClaims()
+			tt.modify(claims)
+
+			err := ltis.validateIDToken(signedClaims(t, claims))
+			if !tt.wantErr {
+				assert.Nil(t, err)
+				return
+			}
+			if assert.NotNil(t, err) {
+				assert.Equal(t, tt.code, err.Code)
+			}
+		})
+	}
+}
+
+func TestValidateIDTokenWithoutPlatformIssuer(t *testing.T) {
+	ltis := testService()
+	ltis.Config.PlatformIssuer = ""
+
+	err := ltis.validateIDToken(signedClaims(t, baseClaims()))
+	if assert.NotNil(t, err, "an empty PlatformIssuer accepts no launches") {
+		assert.Equal(t, ErrCodeIssuerMismatch, err.Code)
+		assert.Contains(t, err.Error(), "Config.PlatformIssuer")
+	}
+}
+
+func TestLaunchHandlerAcceptsValidLaunch(t *testing.T) {
+	keySet := keySetServer(t)
+	defer keySet.Close()
+
+	ltis := NewLTIService(nil, Config{
+		PlatformIssuer: testIssuer,
+		ClientID:       testClientID,
+		KeySetURL:      keySet.URL,
+	})
+	called := false
+	handler := ltis.GetLaunchContextHandler(func(launch *Launch) {
+		called = true
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, launchRequest(signRawPayload(t, validLaunchPayload())))
+	if !called {
+		t.Fatalf("launch was rejected: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestParseIDTokenErrors(t *testing.T) {
+	keySet := keySetServer(t)
+	defer keySet.Close()
+	closed := keySetServer(t)
+	closed.Close()
+
+	valid := signRawPayload(t, validLaunchPayload())
+	parts := strings.Split(valid, ".")
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"https://evil.example.com"}`)) + "." + parts[2]
+
+	tests := []struct {
+		name      string
+		keySetURL string
+		idToken   string
+		code      LaunchErrorCode
+		status    int
+	}{
+		{"valid", keySet.URL, valid, "", 0},
+		{"missing", keySet.URL, "", ErrCodeTokenMissing, http.StatusUnauthorized},
+		{"malformed", keySet.URL, "not-a-jwt", ErrCodeInvalidToken, http.StatusUnauthorized},
+		{"bad signature", keySet.URL, tampered, ErrCodeBadSignature, http.StatusUnauthorized},
+		{"key set unreachable", closed.URL, valid, ErrCodeKeyUnavailable, http.StatusServiceUnavailable},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ltis := NewLTIService(nil, Config{PlatformIssuer: testIssuer, ClientID: testClientID, KeySetURL: test.keySetURL})
+			_, lerr := ltis.parseIDToken(launchRequest(test.idToken))
+			if test.code == "" {
+				assert.Nil(t, lerr)
+				return
+			}
+			if assert.NotNil(t, lerr) {
+				assert.Equal(t, test.code, lerr.Code)
+				assert.Equal(t, test.status, lerr.Status)
+			}
+		})
+	}
+}
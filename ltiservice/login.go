@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/pkg/errors"
@@ -22,28 +23,67 @@ func (ltis *LTIService) login(w http.ResponseWriter, req *http.Request) {
 	//We're still not really sure what the purpose of storing the session is
 	//sess, _ := O.store.Get(req, O.sessionName)
 
-	if ltis.Config.LaunchURL == "" {
-		http.Error(w, "launch url is not configured.", 400)
+	//Read the parameters from the query of a GET or the body of a POST, but not from both
+	params, lerr := loginParams(req)
+	if lerr != nil {
+		writeLoginError(w, lerr)
+		return
+	}
+	req.Form = params
+
+	if lerr := validateLogin(req); lerr != nil {
+		writeLoginError(w, lerr)
 		return
 	}
+	iss := req.FormValue("iss")
 
-	err := validateLogin(req)
+	//Select the platform registration, narrowed down by the client_id and lti_deployment_id hints if the platform
+	//sends them
+	var clientIDs []string
+	if clientID := req.FormValue("client_id"); clientID != "" {
+		clientIDs = append(clientIDs, clientID)
+	}
+	ltis, err := ltis.selectRegistration(iss, req.FormValue("lti_deployment_id"), clientIDs...)
 	if err != nil {
-		http.Error(w, errors.Wrap(err, "Oidc Login validation failure").Error(), 400)
+		param := "iss"
+		if len(clientIDs) > 0 {
+			param = "client_id"
+		}
+		writeLoginError(w, newLoginError(param, iss, "No matching registration: %s", err.Error()))
+		return
+	}
+
+	if ltis.Config.LaunchURL == "" {
+		writeLoginError(w, &LoginError{Status: 500, Code: "server_error", Description: "launch url is not configured.", Issuer: iss})
+		return
+	}
+
+	//Only targets the registration allows may be requested, so the login cannot redirect anywhere else
+	target := req.FormValue("target_link_uri")
+	if target != "" && !ltis.Config.AllowsTargetLinkURI(target) {
+		writeLoginError(w, newLoginError("target_link_uri", iss, "target_link_uri %q is not allowed", target))
 		return
 	}
 
 	state := fmt.Sprintf("state-%s", uuid.NewV4().String())
-	setStateCookie(w, state)
+	if ltis.stateMode() != StateModeStore {
+		setStateCookie(w, state)
+		if target != "" {
+			setTargetCookie(w, state, target)
+		}
+	}
 
 	nonce := fmt.Sprintf("nonce-%s", uuid.NewV4().String())
-	//For now we will ignore checking that the nonce matches and has been used only once
-	//O.cache.PutNonce(req, nonce)
+	//The state store, when there is one, keeps the nonce so that the launch can check it
+	if err := ltis.saveLoginState(w, req, state, nonce); err != nil {
+		writeLoginError(w, &LoginError{Status: 500, Code: "server_error", Description: errors.Wrap(err, "Failed saving login state").Error(), Issuer: iss})
+		return
+	}
 
 	//Construct a query for the redirect
 	redirReq, err := http.NewRequest("GET", ltis.Config.AuthLoginURL, nil)
 	if err != nil {
-		http.Error(w, errors.Wrap(err, "Failed to construct redirect").Error(), 500)
+		writeLoginError(w, &LoginError{Status: 500, Code: "server_error", Description: errors.Wrap(err, "Failed to construct redirect").Error(), Issuer: iss})
 		return
 	}
 	q := redirReq.URL.Query()
@@ -52,32 +92,65 @@ func (ltis *LTIService) login(w http.ResponseWriter, req *http.Request) {
 	q.Add("response_mode", "form_post")
 	q.Add("prompt", "none")
 	q.Add("client_id", ltis.Config.ClientID)
-	q.Add("redirect_uri", ltis.Config.LaunchURL)
+	q.Add("redirect_uri", ltis.loginRedirectURI(target))
 	q.Add("state", state)
 	q.Add("nonce", nonce)
 	q.Add("login_hint", req.FormValue("login_hint"))
 	if mh := req.FormValue("lti_message_hint"); mh != "" {
 		q.Add("lti_message_hint", mh)
 	}
+	if deploymentID := req.FormValue("lti_deployment_id"); deploymentID != "" {
+		q.Add("lti_deployment_id", deploymentID)
+	}
+	storage := ltis.readsClientStorage(req)
+	if storage {
+		q.Add(StorageTargetParam, req.FormValue(StorageTargetParam))
+	}
 	redirReq.URL.RawQuery = q.Encode()
 	redirURL := redirReq.URL.String()
 	log.Printf("OIDC Login Redir: %s", redirURL)
 
+	//When the platform offers postMessage storage, the state and nonce are also kept there, in case the browser
+	//drops the state cookies inside the platform's frame. Launches only read them back with a state store.
+	if storage {
+		ltis.renderStoragePutPage(w, req, state, nonce, target, redirURL)
+		return
+	}
+
 	//We're still not really sure what the purpose of storing the session is
 	//sess.Save(req, w)
 	http.Redirect(w, req, redirURL, 302)
 }
 
-func validateLogin(req *http.Request) error {
+//loginParams returns the parameters of a login initiation request, which platforms may send with GET or POST
+func loginParams(req *http.Request) (url.Values, *LoginError) {
+	switch req.Method {
+	case "GET":
+		return req.URL.Query(), nil
+	case "POST":
+		if err := req.ParseForm(); err != nil {
+			return nil, newLoginError("", "", "Malformed login request body: %s", err.Error())
+		}
+		return req.PostForm, nil
+	default:
+		return nil, &LoginError{
+			Status:      http.StatusMethodNotAllowed,
+			Code:        "invalid_request",
+			Description: fmt.Sprintf("Login initiation must use GET or POST, not %s", req.Method),
+		}
+	}
+}
+
+func validateLogin(req *http.Request) *LoginError {
 	iss := req.FormValue("iss")
 	// log.Printf("iss: %q", iss)
 	if iss == "" {
-		return fmt.Errorf("issuer not found")
+		return newLoginError("iss", "", "issuer not found")
 	}
 	loginHint := req.FormValue("login_hint")
 	// log.Printf("login_hint: %q", loginHint)
 	if loginHint == "" {
-		return fmt.Errorf("login hint not found")
+		return newLoginError("login_hint", iss, "login hint not found")
 	}
 	return nil
 }
@@ -0,0 +1,130 @@
+package ltiservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testLoginService() *LTIService {
+	ltis := NewLTIService(nil, Config{
+		AuthLoginURL: "https://canvas.example.com/auth",
+		LaunchURL:    "https://tool.example.com/launch",
+	})
+	ltis.SetRegistrationStore(NewMemoryRegistrationStore(
+		Config{PlatformIssuer: "https://canvas.example.com", ClientID: "client-a", AuthLoginURL: "https://canvas.example.com/auth", DeploymentIDs: []string{"dep-a"}},
+		Config{PlatformIssuer: "https://canvas.example.com", ClientID: "client-b", AuthLoginURL: "https://canvas.example.com/auth", DeploymentIDs: []string{"dep-b"}},
+	))
+	return ltis
+}
+
+func TestLoginMethods(t *testing.T) {
+	ltis := testLoginService()
+	params := url.Values{}
+	params.Set("iss", "https://canvas.example.com")
+	params.Set("login_hint", "user-1")
+	params.Set("client_id", "client-b")
+
+	w := httptest.NewRecorder()
+	ltis.GetLoginHandler().ServeHTTP(w, httptest.NewRequest("GET", "/login?"+params.Encode(), nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(params.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	ltis.GetLoginHandler().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	// A POST takes its parameters from the body only
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/login?"+params.Encode(), strings.NewReader(""))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	ltis.GetLoginHandler().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	ltis.GetLoginHandler().ServeHTTP(w, httptest.NewRequest("PUT", "/login?"+params.Encode(), nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestLoginRegistrationHints(t *testing.T) {
+	ltis := testLoginService()
+
+	tests := []struct {
+		name         string
+		clientID     string
+		deploymentID string
+		wantClientID string
+		wantParam    string
+	}{
+		{"client ID", "client-a", "", "client-a", ""},
+		{"deployment ID", "", "dep-b", "client-b", ""},
+		{"both", "client-a", "dep-a", "client-a", ""},
+		{"ambiguous", "", "", "", "iss"},
+		{"unknown deployment", "", "dep-x", "", "iss"},
+		{"unknown client ID", "client-x", "", "", "client_id"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query := url.Values{}
+			query.Set("iss", "https://canvas.example.com")
+			query.Set("login_hint", "user-1")
+			if test.clientID != "" {
+				query.Set("client_id", test.clientID)
+			}
+			if test.deploymentID != "" {
+				query.Set("lti_deployment_id", test.deploymentID)
+			}
+			w := httptest.NewRecorder()
+			ltis.GetLoginHandler().ServeHTTP(w, httptest.NewRequest("GET", "/login?"+query.Encode(), nil))
+
+			if test.wantParam != "" {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+				lerr := LoginError{}
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &lerr))
+				assert.Equal(t, test.wantParam, lerr.Parameter)
+				assert.Equal(t, "https://canvas.example.com", lerr.Issuer)
+				return
+			}
+
+			assert.Equal(t, http.StatusFound, w.Code, w.Body.String())
+			location, err := url.Parse(w.Header().Get("Location"))
+			assert.NoError(t, err)
+			assert.Equal(t, test.wantClientID, location.Query().Get("client_id"))
+			assert.Equal(t, test.deploymentID, location.Query().Get("lti_deployment_id"))
+		})
+	}
+}
+
+func TestLoginMissingParameters(t *testing.T) {
+	ltis := testLoginService()
+
+	tests := []struct {
+		query     string
+		param     string
+		issuer    string
+		errorCode string
+	}{
+		{"login_hint=user-1", "iss", "", "invalid_request"},
+		{"iss=https%3A%2F%2Fcanvas.example.com", "login_hint", "https://canvas.example.com", "invalid_request"},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		ltis.GetLoginHandler().ServeHTTP(w, httptest.NewRequest("GET", "/login?"+test.query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		lerr := LoginError{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &lerr))
+		assert.Equal(t, test.param, lerr.Parameter)
+		assert.Equal(t, test.issuer, lerr.Issuer)
+		assert.Equal(t, test.errorCode, lerr.Code)
+	}
+}
@@ -56,8 +56,7 @@ func (nrps *NRPService) GetMembers() (*lti.MemberResponse, error) {
 			return nil, errors.Wrapf(err, "failed to parse json, fetch #%d", count)
 		}
 
-		fmt.Println("RECEIVED MEMBERS")
-		fmt.Println(resp.Members)
+		nrps.ltis.debug("Received %d members", len(resp.Members))
 
 		if count == 1 {
 			ret.Context = resp.Context
@@ -70,6 +69,32 @@ func (nrps *NRPService) GetMembers() (*lti.MemberResponse, error) {
 	return ret, nil
 }
 
+// GetMentees resolves the mentees of the launching user (see lti.LaunchMessage.Mentees) to their member records
+// Mentees that are not members of the context are left out. Returns an empty list if the user is not a mentor.
+func (nrps *NRPService) GetMentees(msg lti.LaunchMessage) ([]lti.Member, error) {
+	mentees := []lti.Member{}
+	ids := msg.Mentees()
+	if len(ids) == 0 {
+		return mentees, nil
+	}
+
+	resp, err := nrps.GetMembers()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to fetch members for mentees")
+	}
+
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	for _, member := range resp.Members {
+		if wanted[member.UserID] {
+			mentees = append(mentees, member)
+		}
+	}
+	return mentees, nil
+}
+
 func (nrps *NRPService) getNextPageURL(res *ServiceResult) string {
 	for k, v := range res.Header {
 		hKey := strings.ToLower(k)
@@ -0,0 +1,126 @@
+package ltiservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MZDevinc/go-lti/lti"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// membershipServer serves an access token endpoint and a context membership split over two pages, counting the
+// membership requests
+func membershipServer(t *testing.T, requests *int) *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "client_credentials", req.FormValue("grant_type"))
+		assert.Equal(t, lti.ScopeContextMembershipReadonly, req.FormValue("scope"))
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "nrps-token", "expires_in": 3600})
+	})
+	mux.HandleFunc("/memberships", func(w http.ResponseWriter, req *http.Request) {
+		*requests++
+		assert.Equal(t, "Bearer nrps-token", req.Header.Get("Authorization"))
+		resp := lti.MemberResponse{ID: server.URL + "/memberships", Context: lti.Context{ID: "context-1"}}
+		if req.URL.Query().Get("page") == "2" {
+			resp.Members = []lti.Member{
+				{UserID: "student-2", Name: "Student Two", Roles: []string{lti.ContextRoleLearner}},
+				{UserID: "teacher-1", Roles: []string{lti.ContextRoleInstructor}},
+			}
+		} else {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/memberships?page=2>; rel="next"`, server.URL))
+			resp.Members = []lti.Member{
+				{UserID: "student-1", Name: "Student One", Roles: []string{lti.ContextRoleLearner}},
+				{UserID: "student-3", Roles: []string{lti.ContextRoleLearner}},
+			}
+		}
+		w.Header().Set("Content-Type", "application/vnd.ims.lti-nrps.v2.membershipcontainer+json")
+		json.NewEncoder(w).Encode(resp)
+	})
+	return server
+}
+
+func membershipService(server *httptest.Server) *NRPService {
+	ltis := NewLTIService(nil, Config{
+		PlatformIssuer: testIssuer,
+		ClientID:       testClientID,
+		AuthTokenURL:   server.URL + "/token",
+		AuthTokenAud:   server.URL + "/token",
+	})
+	ltis.SetSigningKeyFunc(func() (jwa.SignatureAlgorithm, interface{}, error) {
+		return jwa.RS256, testKey, nil
+	})
+	msg := lti.LaunchMessage{NamesRoleService: &lti.NamesRoleService{ContextMembershipsURL: server.URL + "/memberships"}}
+	nrps, _ := ltis.GetNRPService(msg)
+	return nrps
+}
+
+func TestGetMentees(t *testing.T) {
+	requests := 0
+	server := membershipServer(t, &requests)
+	defer server.Close()
+	nrps := membershipService(server)
+
+	mentor := func(roles ...string) lti.LaunchMessage {
+		return lti.LaunchMessage{
+			Roles:           roles,
+			RoleScopeMentor: &[]string{"student-1", "student-2", "not-a-member"},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		msg      lti.LaunchMessage
+		want     []string
+		requests int
+	}{
+		{"mentor", mentor(lti.ContextRoleMentor), []string{"student-1", "student-2"}, 2},
+		{"mentor sub-role", mentor("http://purl.imsglobal.org/vocab/lis/v2/membership/Mentor#Advisor"), []string{"student-1", "student-2"}, 2},
+		{"not a mentor", mentor(lti.ContextRoleLearner), []string{}, 0},
+		{"no mentees", lti.LaunchMessage{Roles: []string{lti.ContextRoleMentor}}, []string{}, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests = 0
+			mentees, err := nrps.GetMentees(test.msg)
+			require.NoError(t, err)
+			ids := []string{}
+			for _, member := range mentees {
+				ids = append(ids, member.UserID)
+			}
+			assert.Equal(t, test.want, ids)
+			assert.Equal(t, test.requests, requests, "membership pages fetched")
+		})
+	}
+
+	mentees, err := nrps.GetMentees(mentor(lti.ContextRoleMentor))
+	require.NoError(t, err)
+	if assert.Len(t, mentees, 2) {
+		assert.Equal(t, "Student Two", mentees[1].Name, "mentees keep their member records")
+	}
+}
+
+func TestGetMenteesServiceError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasSuffix(req.URL.Path, "/token") {
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "nrps-token"})
+			return
+		}
+		w.Write([]byte("not json"))
+	}))
+	defer server.Close()
+
+	_, err := membershipService(server).GetMentees(lti.LaunchMessage{
+		Roles:           []string{lti.ContextRoleMentor},
+		RoleScopeMentor: &[]string{"student-1"},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,231 @@
+package ltiservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/MZDevinc/go-lti/lti"
+	"github.com/MZDevinc/go-lti/lti/custom"
+	"github.com/pkg/errors"
+)
+
+// PlatformConfiguration the OpenID configuration a platform publishes
+// See https://www.imsglobal.org/spec/lti-dr/v1p0#platform-configuration
+type PlatformConfiguration struct {
+	Issuer                                     string   `json:"issuer"`
+	AuthorizationEndpoint                      string   `json:"authorization_endpoint"`
+	TokenEndpoint                              string   `json:"token_endpoint"`
+	TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgValuesSupported []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+	JWKSURI                                    string   `json:"jwks_uri"`
+	RegistrationEndpoint                       string   `json:"registration_endpoint"`
+	ScopesSupported                            []string `json:"scopes_supported"`
+	ResponseTypesSupported                     []string `json:"response_types_supported"`
+	SubjectTypesSupported                      []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported           []string `json:"id_token_signing_alg_values_supported"`
+	ClaimsSupported                            []string `json:"claims_supported"`
+	// AuthorizationServer the audience of access token requests, if it differs from the token endpoint
+	AuthorizationServer string `json:"authorization_server,omitempty"`
+
+	LTIPlatformConfiguration *LTIPlatformConfiguration `json:"https://purl.imsglobal.org/spec/lti-platform-configuration"`
+}
+
+// LTIPlatformConfiguration the LTI specific part of a platform's OpenID configuration
+type LTIPlatformConfiguration struct {
+	ProductFamilyCode string            `json:"product_family_code"`
+	Version           string            `json:"version"`
+	MessagesSupported []PlatformMessage `json:"messages_supported"`
+	Variables         []string          `json:"variables,omitempty"`
+}
+
+// PlatformMessage a message type a platform supports, with the placements it offers for it
+type PlatformMessage struct {
+	Type       string   `json:"type"`
+	Placements []string `json:"placements,omitempty"`
+}
+
+// Validate checks that the configuration has what the tool needs to launch from and call back to the platform
+func (pc *PlatformConfiguration) Validate() error {
+	for name, value := range map[string]string{
+		"issuer":                 pc.Issuer,
+		"authorization_endpoint": pc.AuthorizationEndpoint,
+		"token_endpoint":         pc.TokenEndpoint,
+		"jwks_uri":               pc.JWKSURI,
+	} {
+		if value == "" {
+			return fmt.Errorf("Platform configuration is missing %s", name)
+		}
+		if err := validateAbsoluteURL(value); err != nil {
+			return errors.Wrapf(err, "Platform configuration has invalid %s", name)
+		}
+	}
+	if pc.RegistrationEndpoint != "" {
+		if err := validateAbsoluteURL(pc.RegistrationEndpoint); err != nil {
+			return errors.Wrap(err, "Platform configuration has invalid registration_endpoint")
+		}
+	}
+	if len(pc.IDTokenSigningAlgValuesSupported) > 0 && !containsString(pc.IDTokenSigningAlgValuesSupported, "RS256") {
+		return fmt.Errorf("Platform does not sign id_tokens with RS256")
+	}
+	if pc.LTIPlatformConfiguration == nil {
+		return fmt.Errorf("Platform configuration is missing https://purl.imsglobal.org/spec/lti-platform-configuration")
+	}
+	return pc.LTIPlatformConfiguration.validate()
+}
+
+// validate checks the product family, supported messages and variables of the LTI platform configuration
+func (lpc *LTIPlatformConfiguration) validate() error {
+	if lpc.ProductFamilyCode == "" {
+		return fmt.Errorf("LTI platform configuration is missing product_family_code")
+	}
+	if len(lpc.MessagesSupported) == 0 {
+		return fmt.Errorf("LTI platform configuration is missing messages_supported")
+	}
+	resourceLink := false
+	for i, msg := range lpc.MessagesSupported {
+		if msg.Type == "" {
+			return fmt.Errorf("LTI platform configuration messages_supported[%d] has no type", i)
+		}
+		resourceLink = resourceLink || msg.Type == lti.MessageTypeResourceLink
+	}
+	if !resourceLink {
+		return fmt.Errorf("LTI platform configuration does not support %s messages", lti.MessageTypeResourceLink)
+	}
+	for _, v := range lpc.Variables {
+		if !custom.IsUnsubstituted("$" + v) {
+			return fmt.Errorf("LTI platform configuration has invalid variable %q", v)
+		}
+	}
+	return nil
+}
+
+// SupportsMessage reports whether the platform supports the message type, e.g. lti.MessageTypeDeepLinking
+func (pc *PlatformConfiguration) SupportsMessage(messageType string) bool {
+	if pc.LTIPlatformConfiguration == nil {
+		return false
+	}
+	for _, msg := range pc.LTIPlatformConfiguration.MessagesSupported {
+		if msg.Type == messageType {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsVariable reports whether the platform substitutes the custom parameter variable, e.g. "Context.id"
+// Platforms that do not list their variables are assumed not to support any.
+func (pc *PlatformConfiguration) SupportsVariable(name string) bool {
+	if pc.LTIPlatformConfiguration == nil {
+		return false
+	}
+	return containsString(pc.LTIPlatformConfiguration.Variables, strings.TrimPrefix(name, "$"))
+}
+
+// DiscoverPlatform fetches and validates the OpenID configuration a platform publishes at
+// <issuerURL>/.well-known/openid-configuration
+// The configuration's issuer must be issuerURL. Use PlatformConfiguration.Config to turn the result into a registration
+// once the platform has issued a client ID. Like dynamic registration, discovery only fetches https URLs and refuses
+// to connect to internal addresses, including through redirects.
+func DiscoverPlatform(issuerURL string) (*PlatformConfiguration, error) {
+	return discoverPlatform(newRegistrationClient(), issuerURL)
+}
+
+func discoverPlatform(client *http.Client, issuerURL string) (*PlatformConfiguration, error) {
+	issuerURL = strings.TrimSuffix(issuerURL, "/")
+	configURL := issuerURL + "/.well-known/openid-configuration"
+	if err := validateRegistrationURL(configURL); err != nil {
+		return nil, errors.Wrap(err, "Invalid issuer URL")
+	}
+	pc, err := fetchPlatformConfiguration(client, configURL)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(pc.Issuer, "/") != issuerURL {
+		return nil, fmt.Errorf("Platform configuration issuer %q does not match %q", pc.Issuer, issuerURL)
+	}
+	return pc, nil
+}
+
+// Config returns the registration Config for the platform, given the client ID the platform issued to the tool
+func (pc *PlatformConfiguration) Config(clientID string) Config {
+	aud := pc.AuthorizationServer
+	if aud == "" {
+		aud = pc.TokenEndpoint
+	}
+	return Config{
+		PlatformIssuer: pc.Issuer,
+		ClientID:       clientID,
+		AuthLoginURL:   pc.AuthorizationEndpoint,
+		KeySetURL:      pc.JWKSURI,
+		AuthTokenURL:   pc.TokenEndpoint,
+		AuthTokenAud:   aud,
+	}
+}
+
+// fetchPlatformConfiguration fetches and validates a platform's OpenID configuration
+// The issuer must be on the same origin as the configuration URL, so a configuration cannot claim another
+// platform's issuer.
+func fetchPlatformConfiguration(client *http.Client, configURL string) (*PlatformConfiguration, error) {
+	if err := validateAbsoluteURL(configURL); err != nil {
+		return nil, errors.Wrap(err, "Invalid openid_configuration URL")
+	}
+
+	req, err := http.NewRequest("GET", configURL, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to create platform configuration request for %q", configURL)
+	}
+	req.Header.Add("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to fetch platform configuration from %q", configURL)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxRegistrationResponseSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read platform configuration from %q", configURL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Platform configuration request to %q failed with status %s", configURL, resp.Status)
+	}
+
+	pc := &PlatformConfiguration{}
+	if err := json.Unmarshal(body, pc); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse platform configuration from %q", configURL)
+	}
+	if err := pc.Validate(); err != nil {
+		return nil, err
+	}
+	if !sameOrigin(pc.Issuer, configURL) {
+		return nil, fmt.Errorf("Platform issuer %q does not match the configuration URL %q", pc.Issuer, configURL)
+	}
+	return pc, nil
+}
+
+func validateAbsoluteURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute http(s) URL", value)
+	}
+	return nil
+}
+
+func sameOrigin(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host)
+}
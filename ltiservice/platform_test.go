@@ -0,0 +1,100 @@
+package ltiservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MZDevinc/go-lti/lti"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoverPlatform(t *testing.T) {
+	platform, client := registrationPlatform(t)
+	defer platform.Close()
+
+	pc, err := discoverPlatform(client, "https://lms.example.com/")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, Config{
+		PlatformIssuer: "https://lms.example.com",
+		ClientID:       "client-1",
+		AuthLoginURL:   "https://lms.example.com/auth",
+		KeySetURL:      "https://lms.example.com/jwks",
+		AuthTokenURL:   "https://lms.example.com/token",
+		AuthTokenAud:   "https://lms.example.com/token",
+	}, pc.Config("client-1"))
+	assert.True(t, pc.SupportsMessage(lti.MessageTypeResourceLink))
+	assert.False(t, pc.SupportsMessage(lti.MessageTypeDeepLinking))
+
+	_, err = discoverPlatform(client, "https://lms.example.com/other-tenant")
+	assert.Error(t, err)
+}
+
+func TestDiscoverPlatformRejectsInternalURLs(t *testing.T) {
+	fetched := false
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fetched = true
+	}))
+	defer server.Close()
+
+	for _, issuerURL := range []string{
+		"http://lms.example.com",
+		"https://localhost",
+		"https://169.254.169.254",
+		server.URL,
+		strings.Replace(server.URL, "127.0.0.1", "localhost", 1),
+	} {
+		_, err := DiscoverPlatform(issuerURL)
+		assert.Error(t, err, issuerURL)
+	}
+	assert.False(t, fetched)
+}
+
+func TestPlatformConfigurationValidate(t *testing.T) {
+	valid := func() *PlatformConfiguration {
+		return &PlatformConfiguration{
+			Issuer:                           "https://lms.example.edu",
+			AuthorizationEndpoint:            "https://lms.example.edu/auth",
+			TokenEndpoint:                    "https://lms.example.edu/token",
+			JWKSURI:                          "https://lms.example.edu/jwks",
+			IDTokenSigningAlgValuesSupported: []string{"RS256"},
+			LTIPlatformConfiguration: &LTIPlatformConfiguration{
+				ProductFamilyCode: "canvas",
+				MessagesSupported: []PlatformMessage{{Type: lti.MessageTypeResourceLink}, {Type: lti.MessageTypeDeepLinking}},
+				Variables:         []string{"Context.id", "Canvas.course.id"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(pc *PlatformConfiguration)
+	}{
+		{"missing issuer", func(pc *PlatformConfiguration) { pc.Issuer = "" }},
+		{"relative jwks uri", func(pc *PlatformConfiguration) { pc.JWKSURI = "/jwks" }},
+		{"no RS256", func(pc *PlatformConfiguration) { pc.IDTokenSigningAlgValuesSupported = []string{"HS256"} }},
+		{"no lti section", func(pc *PlatformConfiguration) { pc.LTIPlatformConfiguration = nil }},
+		{"no product family", func(pc *PlatformConfiguration) { pc.LTIPlatformConfiguration.ProductFamilyCode = "" }},
+		{"no messages", func(pc *PlatformConfiguration) { pc.LTIPlatformConfiguration.MessagesSupported = nil }},
+		{"no resource link message", func(pc *PlatformConfiguration) {
+			pc.LTIPlatformConfiguration.MessagesSupported = []PlatformMessage{{Type: lti.MessageTypeDeepLinking}}
+		}},
+		{"invalid variable", func(pc *PlatformConfiguration) { pc.LTIPlatformConfiguration.Variables = []string{"$Context.id"} }},
+	}
+
+	pc := valid()
+	assert.NoError(t, pc.Validate())
+	assert.True(t, pc.SupportsVariable("$Context.id"))
+	assert.False(t, pc.SupportsVariable("User.id"))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc := valid()
+			tt.modify(pc)
+			assert.Error(t, pc.Validate())
+		})
+	}
+}
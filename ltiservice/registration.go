@@ -0,0 +1,169 @@
+package ltiservice
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// RegistrationStore looks up and persists the platform registrations of the tool
+// A registration is a Config holding the platform settings (PlatformIssuer, ClientID, AuthLoginURL, KeySetURL,
+// AuthTokenURL, AuthTokenAud and DeploymentIDs). Tool settings left empty in a registration, such as LaunchURL,
+// RedirectURIs, TargetLinkURIs, Issuer and StateMode, are taken from LTIService.Config.
+type RegistrationStore interface {
+	// FindRegistrations returns every registration with the given platform issuer
+	FindRegistrations(issuer string) ([]Config, error)
+	// SaveRegistration adds or replaces the registration with the same issuer and client ID
+	SaveRegistration(config Config) error
+}
+
+// SetRegistrationStore Define the store used to look up platform registrations during login and launch
+// LTIService.Config remains in use for its own PlatformIssuer, so a single registration can still be configured
+// directly.
+func (ltis *LTIService) SetRegistrationStore(store RegistrationStore) {
+	ltis.Registrations = store
+}
+
+// findRegistration returns the service configured for the registration with the issuer and one of the client IDs
+// With no client IDs the issuer must have a single registration. Without a registration store, the service itself
+// is returned unchecked.
+func (ltis *LTIService) findRegistration(issuer string, clientIDs ...string) (*LTIService, error) {
+	return ltis.selectRegistration(issuer, "", clientIDs...)
+}
+
+// selectRegistration is findRegistration with a deployment ID hint
+// When the issuer and client IDs match several registrations, the one listing the deployment ID in its
+// DeploymentIDs is chosen.
+func (ltis *LTIService) selectRegistration(issuer, deploymentID string, clientIDs ...string) (*LTIService, error) {
+	if ltis.Registrations == nil {
+		return ltis, nil
+	}
+
+	registrations, err := ltis.Registrations.FindRegistrations(issuer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed looking up registrations of issuer %q", issuer)
+	}
+	if ltis.Config.PlatformIssuer != "" && ltis.Config.PlatformIssuer == issuer {
+		stored := false
+		for _, reg := range registrations {
+			stored = stored || reg.ClientID == ltis.Config.ClientID
+		}
+		if !stored {
+			registrations = append(registrations, ltis.Config)
+		}
+	}
+
+	var matches []Config
+	for _, reg := range registrations {
+		if len(clientIDs) == 0 || containsString(clientIDs, reg.ClientID) {
+			matches = append(matches, reg)
+		}
+	}
+
+	if len(matches) > 1 && deploymentID != "" {
+		var deployed []Config
+		for _, reg := range matches {
+			if containsString(reg.DeploymentIDs, deploymentID) {
+				deployed = append(deployed, reg)
+			}
+		}
+		if len(deployed) > 0 {
+			matches = deployed
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		if len(registrations) == 0 {
+			return nil, fmt.Errorf("No registration for issuer %q", issuer)
+		}
+		return nil, fmt.Errorf("No registration for issuer %q and client ID %q", issuer, clientIDs)
+	case 1:
+		return ltis.withRegistration(matches[0]), nil
+	default:
+		return nil, fmt.Errorf("Issuer %q has %d registrations, a client ID or deployment ID is required to choose one", issuer, len(matches))
+	}
+}
+
+// withRegistration returns a copy of the service using the registration as its Config
+func (ltis *LTIService) withRegistration(reg Config) *LTIService {
+	if reg.LaunchURL == "" {
+		reg.LaunchURL = ltis.Config.LaunchURL
+	}
+	if reg.Issuer == "" {
+		reg.Issuer = ltis.Config.Issuer
+	}
+	if len(reg.RedirectURIs) == 0 {
+		reg.RedirectURIs = ltis.Config.RedirectURIs
+	}
+	if len(reg.TargetLinkURIs) == 0 {
+		reg.TargetLinkURIs = ltis.Config.TargetLinkURIs
+	}
+	if reg.StateMode == StateModeInherit {
+		reg.StateMode = ltis.Config.StateMode
+	}
+
+	svc := *ltis
+	svc.Config = reg
+	return &svc
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// MemoryRegistrationStore a RegistrationStore that keeps registrations in memory
+type MemoryRegistrationStore struct {
+	mu            sync.RWMutex
+	registrations map[string]Config
+}
+
+// NewMemoryRegistrationStore Returns a MemoryRegistrationStore holding the given registrations
+func NewMemoryRegistrationStore(registrations ...Config) *MemoryRegistrationStore {
+	store := &MemoryRegistrationStore{registrations: map[string]Config{}}
+	for _, reg := range registrations {
+		store.registrations[registrationKey(reg.PlatformIssuer, reg.ClientID)] = reg
+	}
+	return store
+}
+
+// FindRegistrations returns every registration with the given platform issuer
+func (s *MemoryRegistrationStore) FindRegistrations(issuer string) ([]Config, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var found []Config
+	for _, reg := range s.registrations {
+		if reg.PlatformIssuer == issuer {
+			found = append(found, reg)
+		}
+	}
+	return found, nil
+}
+
+// SaveRegistration adds or replaces the registration with the same issuer and client ID
+func (s *MemoryRegistrationStore) SaveRegistration(config Config) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.registrations[registrationKey(config.PlatformIssuer, config.ClientID)] = config
+	return nil
+}
+
+// RemoveRegistration removes a registration, so that the platform can no longer launch the tool with it
+func (s *MemoryRegistrationStore) RemoveRegistration(issuer, clientID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.registrations, registrationKey(issuer, clientID))
+}
+
+func registrationKey(issuer, clientID string) string {
+	return fmt.Sprintf("%s\x00%s", issuer, clientID)
+}
@@ -0,0 +1,292 @@
+package ltiservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindRegistration(t *testing.T) {
+	ltis := testService()
+	ltis.Config.LaunchURL = "https://tool.example.com/launch"
+
+	// Without a store, the service config is used as it is
+	svc, err := ltis.findRegistration("https://other.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, ltis, svc)
+
+	ltis.SetRegistrationStore(NewMemoryRegistrationStore(
+		Config{PlatformIssuer: "https://lms.example.edu", ClientID: "client-a", KeySetURL: "https://lms.example.edu/jwks"},
+		Config{PlatformIssuer: "https://multi.example.edu", ClientID: "client-b"},
+		Config{PlatformIssuer: "https://multi.example.edu", ClientID: "client-c"},
+	))
+
+	svc, err = ltis.findRegistration("https://lms.example.edu")
+	assert.NoError(t, err)
+	assert.Equal(t, "client-a", svc.Config.ClientID)
+	assert.Equal(t, "https://lms.example.edu/jwks", svc.Config.KeySetURL)
+	assert.Equal(t, ltis.Config.LaunchURL, svc.Config.LaunchURL)
+	assert.Equal(t, testClientID, ltis.Config.ClientID, "the base service must not change")
+
+	svc, err = ltis.findRegistration(testIssuer, testClientID)
+	assert.NoError(t, err)
+	assert.Equal(t, testClientID, svc.Config.ClientID)
+
+	_, err = ltis.findRegistration("https://multi.example.edu")
+	assert.Error(t, err)
+
+	svc, err = ltis.findRegistration("https://multi.example.edu", "client-c")
+	assert.NoError(t, err)
+	assert.Equal(t, "client-c", svc.Config.ClientID)
+
+	_, err = ltis.findRegistration("https://multi.example.edu", "client-x")
+	assert.Error(t, err)
+
+	_, err = ltis.findRegistration("https://unknown.example.edu")
+	assert.Error(t, err)
+}
+
+// registrationPlatform serves the platform over TLS as https://lms.example.com, returning a client that connects
+// to the server whatever the host name resolves to
+func registrationPlatform(t *testing.T) (*httptest.Server, *http.Client) {
+	server := httptest.NewTLSServer(platformHandler(t, func() string { return "https://lms.example.com" }))
+	client := server.Client()
+	client.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+	}
+	return server, client
+}
+
+// platformHandler serves the OpenID configuration and registration endpoint of the platform at base()
+func platformHandler(t *testing.T, base func() string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(PlatformConfiguration{
+			Issuer:                           base(),
+			AuthorizationEndpoint:            base() + "/auth",
+			TokenEndpoint:                    base() + "/token",
+			JWKSURI:                          base() + "/jwks",
+			RegistrationEndpoint:             base() + "/register",
+			IDTokenSigningAlgValuesSupported: []string{"RS256"},
+			LTIPlatformConfiguration: &LTIPlatformConfiguration{
+				ProductFamilyCode: "moodle",
+				Version:           "4.0",
+				MessagesSupported: []PlatformMessage{{Type: "LtiResourceLinkRequest"}},
+			},
+		})
+	})
+	mux.HandleFunc("/register", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer reg-token" {
+			http.Error(w, "invalid registration token for tenant 42", http.StatusUnauthorized)
+			return
+		}
+		reg := ClientRegistration{}
+		if err := json.NewDecoder(req.Body).Decode(&reg); err != nil {
+			t.Errorf("invalid registration: %v", err)
+		}
+		assert.Equal(t, "Example Tool", reg.ClientName)
+		assert.Equal(t, []string{"https://tool.example.com/launch"}, reg.RedirectURIs)
+		assert.Equal(t, "tool.example.com", reg.LTIToolConfiguration.Domain)
+		assert.Equal(t, "private_key_jwt", reg.TokenEndpointAuthMethod)
+
+		reg.ClientID = "registered-client"
+		reg.LTIToolConfiguration.DeploymentID = "deployment-1"
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(reg)
+	})
+	return mux
+}
+
+// registrationService a service registering the example tool through the platform's client
+func registrationService(client *http.Client) (*LTIService, http.Handler) {
+	ltis := NewLTIService(nil, Config{LaunchURL: "https://tool.example.com/launch"})
+	ltis.SetRegistrationStore(NewMemoryRegistrationStore())
+	ltis.registrationClient = client
+	handler := ltis.GetRegistrationHandler(ToolConfiguration{
+		ClientName:       "Example Tool",
+		InitiateLoginURI: "https://tool.example.com/login",
+		JWKSURI:          "https://tool.example.com/jwks",
+		Claims:           []string{"email", "name"},
+	})
+	return ltis, handler
+}
+
+func registerWith(handler http.Handler, configURL, token string) *httptest.ResponseRecorder {
+	query := url.Values{}
+	query.Set("openid_configuration", configURL)
+	query.Set("registration_token", token)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/register?"+query.Encode(), nil))
+	return w
+}
+
+func TestRegistrationHandler(t *testing.T) {
+	platform, client := registrationPlatform(t)
+	defer platform.Close()
+	ltis, handler := registrationService(client)
+	ltis.SetRegistrationApprover(func(req *http.Request, pc *PlatformConfiguration) (bool, error) {
+		return pc.Issuer == "https://lms.example.com", nil
+	})
+	configURL := "https://lms.example.com/.well-known/openid-configuration"
+
+	w := registerWith(handler, configURL, "wrong-token")
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+
+	w = registerWith(handler, configURL, "reg-token")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.True(t, strings.Contains(w.Body.String(), `subject: "org.imsglobal.lti.close"`))
+
+	regs, err := ltis.Registrations.FindRegistrations("https://lms.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, []Config{{
+		PlatformIssuer: "https://lms.example.com",
+		ClientID:       "registered-client",
+		AuthLoginURL:   "https://lms.example.com/auth",
+		KeySetURL:      "https://lms.example.com/jwks",
+		AuthTokenURL:   "https://lms.example.com/token",
+		AuthTokenAud:   "https://lms.example.com/token",
+		DeploymentIDs:  []string{"deployment-1"},
+	}}, regs)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/register", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRegistrationHandlerNotApproved(t *testing.T) {
+	platform, client := registrationPlatform(t)
+	defer platform.Close()
+	configURL := "https://lms.example.com/.well-known/openid-configuration"
+
+	tests := []struct {
+		name     string
+		approver RegistrationApprover
+		status   int
+	}{
+		{"no approver", nil, http.StatusInternalServerError},
+		{"rejected", func(*http.Request, *PlatformConfiguration) (bool, error) { return false, nil }, http.StatusForbidden},
+		{"approver error", func(*http.Request, *PlatformConfiguration) (bool, error) {
+			return true, fmt.Errorf("session lookup failed")
+		}, http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ltis, handler := registrationService(client)
+			ltis.SetRegistrationApprover(test.approver)
+
+			w := registerWith(handler, configURL, "reg-token")
+			assert.Equal(t, test.status, w.Code, w.Body.String())
+			regs, err := ltis.Registrations.FindRegistrations("https://lms.example.com")
+			assert.NoError(t, err)
+			assert.Empty(t, regs, "nothing is stored")
+		})
+	}
+}
+
+// failingRegistrationStore a RegistrationStore whose saves fail
+type failingRegistrationStore struct{}
+
+func (failingRegistrationStore) FindRegistrations(string) ([]Config, error) {
+	return nil, nil
+}
+
+func (failingRegistrationStore) SaveRegistration(Config) error {
+	return fmt.Errorf("database password rejected")
+}
+
+func TestRegistrationHandlerHidesFailureDetails(t *testing.T) {
+	platform, client := registrationPlatform(t)
+	defer platform.Close()
+	configURL := "https://lms.example.com/.well-known/openid-configuration"
+
+	tests := []struct {
+		name      string
+		configURL string
+		token     string
+		store     RegistrationStore
+		status    int
+		hidden    string
+	}{
+		{"configuration not found", "https://lms.example.com/missing", "reg-token", nil, http.StatusBadRequest, "404"},
+		{"registration refused", configURL, "wrong-token", nil, http.StatusBadGateway, "tenant 42"},
+		{"store failure", configURL, "reg-token", failingRegistrationStore{}, http.StatusInternalServerError, "password"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var debugged []string
+			ltis, handler := registrationService(client)
+			ltis.debug = func(format string, a ...interface{}) {
+				debugged = append(debugged, fmt.Sprint(a...))
+			}
+			ltis.SetRegistrationApprover(func(*http.Request, *PlatformConfiguration) (bool, error) { return true, nil })
+			if test.store != nil {
+				ltis.SetRegistrationStore(test.store)
+			}
+
+			w := registerWith(handler, test.configURL, test.token)
+			assert.Equal(t, test.status, w.Code, w.Body.String())
+			assert.NotContains(t, w.Body.String(), test.hidden, "the platform's window does not show the details")
+			assert.Contains(t, strings.Join(debugged, "\n"), test.hidden, "the details are logged")
+		})
+	}
+}
+
+func TestRegistrationHandlerRejectsInternalURLs(t *testing.T) {
+	fetched := false
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fetched = true
+	}))
+	defer server.Close()
+
+	ltis, handler := registrationService(nil)
+	ltis.SetRegistrationApprover(func(*http.Request, *PlatformConfiguration) (bool, error) { return true, nil })
+	for _, configURL := range []string{
+		"http://lms.example.com/.well-known/openid-configuration",
+		"https://localhost/.well-known/openid-configuration",
+		"https://169.254.169.254/latest/meta-data",
+		"https://[::1]/.well-known/openid-configuration",
+		server.URL + "/.well-known/openid-configuration",
+	} {
+		w := registerWith(handler, configURL, "reg-token")
+		assert.Equal(t, http.StatusBadRequest, w.Code, configURL)
+	}
+	assert.False(t, fetched)
+
+	_, err := newRegistrationClient().Get(strings.Replace(server.URL, "127.0.0.1", "localhost", 1))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "internal address", "host names resolving to internal addresses are refused when connecting")
+	}
+	assert.False(t, fetched)
+
+	assert.NoError(t, validateRegistrationURL("https://lms.example.com/.well-known/openid-configuration"))
+	assert.NoError(t, validateRegistrationURL("https://93.184.216.34/register"))
+}
+
+func TestFetchPlatformConfigurationRejectsForeignIssuer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(PlatformConfiguration{
+			Issuer:                "https://other-platform.example.com",
+			AuthorizationEndpoint: "https://other-platform.example.com/auth",
+			TokenEndpoint:         "https://other-platform.example.com/token",
+			JWKSURI:               "https://other-platform.example.com/jwks",
+			LTIPlatformConfiguration: &LTIPlatformConfiguration{
+				ProductFamilyCode: "moodle",
+				MessagesSupported: []PlatformMessage{{Type: "LtiResourceLinkRequest"}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	_, err := fetchPlatformConfiguration(server.Client(), server.URL)
+	assert.Error(t, err)
+}
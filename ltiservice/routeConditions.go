@@ -0,0 +1,61 @@
+package ltiservice
+
+import (
+	"github.com/MZDevinc/go-lti/lti/custom"
+	"github.com/MZDevinc/go-lti/lti/vendor"
+)
+
+// RouteCondition decides whether a route serves a launch whose target path it matches
+type RouteCondition func(launch *Launch) bool
+
+// ForMessageType Returns a condition accepting launches of any of the message types, e.g. lti.MessageTypeDeepLinking
+func ForMessageType(types ...string) RouteCondition {
+	return func(launch *Launch) bool {
+		for _, t := range types {
+			if launch.Message.MessageType == t {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ForRoles Returns a condition accepting launches by users with any of the roles
+// Roles are compared like LaunchMessage.HasAnyImpliedRole, so short names such as "Instructor" can be used.
+func ForRoles(roles ...string) RouteCondition {
+	return func(launch *Launch) bool {
+		return launch.Message.HasAnyImpliedRole(roles)
+	}
+}
+
+// ForCustom Returns a condition accepting launches with the custom parameter set to any of the values
+// Without values, any launch that has the custom parameter is accepted.
+func ForCustom(key string, values ...string) RouteCondition {
+	return func(launch *Launch) bool {
+		params := custom.FromLaunch(launch.Message)
+		if len(values) == 0 {
+			return params.Has(key)
+		}
+		value, err := params.String(key)
+		return err == nil && containsString(values, value)
+	}
+}
+
+// ForClaim Returns a condition accepting launches with the string extension claim set to any of the values
+// Without values, any launch that has the claim is accepted.
+func ForClaim(claim string, values ...string) RouteCondition {
+	return func(launch *Launch) bool {
+		if len(values) == 0 {
+			return launch.Message.HasExtension(claim)
+		}
+		var value string
+		found, err := launch.Message.Extension(claim, &value)
+		return found && err == nil && containsString(values, value)
+	}
+}
+
+// ForPlacement Returns a condition accepting launches from any of the platform placements, e.g. "course_navigation"
+// The placement is read from the Canvas placement claim, the only platform that sends one.
+func ForPlacement(placements ...string) RouteCondition {
+	return ForClaim(vendor.ClaimCanvasPlacement, placements...)
+}
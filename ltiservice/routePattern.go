@@ -0,0 +1,386 @@
+package ltiservice
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// paramTypes the types of typed route parameters (/:id<int>), by the values they accept
+var paramTypes = map[string]func(string) bool{
+	"int": func(s string) bool {
+		_, err := strconv.ParseInt(s, 10, 64)
+		return err == nil
+	},
+	"uuid":  regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`).MatchString,
+	"alpha": regexp.MustCompile(`^[a-zA-Z]+$`).MatchString,
+}
+
+// routeSegment a segment of a route pattern: a literal, a parameter or a catch-all
+type routeSegment struct {
+	literal  string
+	param    string
+	kind     string // the type of a parameter, "" for any value
+	catchAll bool
+	optional bool
+}
+
+// queryConstraint a query parameter a route pattern requires
+// Without a value or a parameter, the query parameter only has to be present.
+type queryConstraint struct {
+	key   string
+	value string
+	param string // captures the value into the route parameter
+	kind  string
+}
+
+// routePattern a parsed route pattern
+type routePattern struct {
+	segments []routeSegment
+	query    []queryConstraint
+}
+
+// parseRoutePattern parses a route pattern such as /quiz/:id<int>/*rest?mode=practice
+// A "?" ending a segment makes the segment optional; the first other "?" starts the query constraints.
+func parseRoutePattern(pattern string) (*routePattern, error) {
+	path, query := pattern, ""
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '?' && i+1 < len(pattern) && pattern[i+1] != '/' && pattern[i+1] != '?' {
+			path, query = pattern[:i], pattern[i+1:]
+			break
+		}
+	}
+
+	p := &routePattern{}
+	names := map[string]bool{}
+	addName := func(name string) error {
+		if name == "" {
+			return fmt.Errorf("Route %q has an unnamed parameter", pattern)
+		}
+		if names[name] {
+			return fmt.Errorf("Route %q uses parameter %q twice", pattern, name)
+		}
+		names[name] = true
+		return nil
+	}
+
+	path = strings.TrimSuffix(strings.TrimPrefix(path, "/"), "/")
+	if path != "" {
+		parts := strings.Split(path, "/")
+		for i, part := range parts {
+			seg := routeSegment{}
+			if strings.HasSuffix(part, "?") {
+				seg.optional = true
+				part = strings.TrimSuffix(part, "?")
+			}
+			if part == "" {
+				return nil, fmt.Errorf("Route %q has an empty segment", pattern)
+			}
+
+			switch part[0] {
+			case '*':
+				if i != len(parts)-1 {
+					return nil, fmt.Errorf("Route %q has a catch-all before its last segment", pattern)
+				}
+				if seg.optional {
+					return nil, fmt.Errorf("Route %q has an optional catch-all, which already matches nothing", pattern)
+				}
+				seg.catchAll = true
+				seg.param = part[1:]
+			case ':':
+				name, kind, err := parseParam(pattern, part[1:])
+				if err != nil {
+					return nil, err
+				}
+				seg.param, seg.kind = name, kind
+			default:
+				seg.literal = part
+			}
+			if seg.literal == "" {
+				if err := addName(seg.param); err != nil {
+					return nil, err
+				}
+			}
+			p.segments = append(p.segments, seg)
+		}
+	}
+
+	if query != "" {
+		for _, part := range strings.Split(query, "&") {
+			key, value := part, ""
+			if i := strings.Index(part, "="); i >= 0 {
+				key, value = part[:i], part[i+1:]
+			}
+			if key == "" {
+				return nil, fmt.Errorf("Route %q has an empty query parameter", pattern)
+			}
+			qc := queryConstraint{key: key, value: value}
+			if strings.HasPrefix(value, ":") {
+				name, kind, err := parseParam(pattern, value[1:])
+				if err != nil {
+					return nil, err
+				}
+				if err := addName(name); err != nil {
+					return nil, err
+				}
+				qc.value, qc.param, qc.kind = "", name, kind
+			}
+			p.query = append(p.query, qc)
+		}
+	}
+	return p, nil
+}
+
+// parseParam parses a parameter such as id<int>, returning its name and type
+func parseParam(pattern, param string) (string, string, error) {
+	i := strings.Index(param, "<")
+	if i < 0 {
+		return param, "", nil
+	}
+	if !strings.HasSuffix(param, ">") {
+		return "", "", fmt.Errorf("Route %q has a malformed parameter type in %q", pattern, param)
+	}
+	kind := param[i+1 : len(param)-1]
+	if _, ok := paramTypes[kind]; !ok {
+		return "", "", fmt.Errorf("Route %q uses unknown parameter type %q", pattern, kind)
+	}
+	return param[:i], kind, nil
+}
+
+// variants returns the patterns without optional segments that together match what the pattern matches
+func (p *routePattern) variants() [][]routeSegment {
+	variants := [][]routeSegment{nil}
+	for _, seg := range p.segments {
+		required := seg
+		required.optional = false
+		count := len(variants)
+		for i := 0; i < count; i++ {
+			with := append(append([]routeSegment{}, variants[i]...), required)
+			if seg.optional {
+				variants = append(variants, with)
+			} else {
+				variants[i] = with
+			}
+		}
+	}
+	return variants
+}
+
+// shapes returns a key for every path shape the pattern matches, ignoring parameter names
+// Patterns sharing a shape match the same launches, so at most one of them can be used without conditions.
+func (p *routePattern) shapes() []string {
+	queryKeys := make([]string, len(p.query))
+	for i, qc := range p.query {
+		if qc.param != "" {
+			queryKeys[i] = qc.key + "=<" + qc.kind + ">"
+		} else {
+			queryKeys[i] = qc.key + "=" + qc.value
+		}
+	}
+	sort.Strings(queryKeys)
+	query := strings.Join(queryKeys, "&")
+
+	var shapes []string
+	for _, variant := range p.variants() {
+		keys := make([]string, len(variant))
+		for i, seg := range variant {
+			switch {
+			case seg.catchAll:
+				keys[i] = "*"
+			case seg.param != "":
+				keys[i] = "<" + seg.kind + ">"
+			default:
+				keys[i] = "=" + seg.literal
+			}
+		}
+		shapes = append(shapes, "/"+strings.Join(keys, "/")+"?"+query)
+	}
+	return shapes
+}
+
+// target returns the definite URL path and query of the pattern, or false if it matches more than one
+func (p *routePattern) target() (string, bool) {
+	literals := make([]string, len(p.segments))
+	for i, seg := range p.segments {
+		if seg.literal == "" || seg.optional {
+			return "", false
+		}
+		literals[i] = seg.literal
+	}
+	target := "/" + strings.Join(literals, "/")
+
+	query := url.Values{}
+	for _, qc := range p.query {
+		if qc.param != "" || qc.value == "" {
+			return "", false
+		}
+		query.Set(qc.key, qc.value)
+	}
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	return target, true
+}
+
+// routeEntry a route at the node of the trie where one of its pattern variants ends
+type routeEntry struct {
+	route *routeDef
+	names []string // the names of the parameters captured along the path, in order
+}
+
+// routeNode a node of the route trie, one path segment deep
+type routeNode struct {
+	literals map[string]*routeNode
+	params   map[string]*routeNode // by parameter type
+	kinds    []string              // the parameter types, typed ones first
+	routes   []routeEntry          // routes ending at the node
+	catchAll []routeEntry          // routes with a catch-all after the node
+}
+
+func newRouteNode() *routeNode {
+	return &routeNode{literals: map[string]*routeNode{}, params: map[string]*routeNode{}}
+}
+
+// insert adds the route for each variant of its pattern
+func (n *routeNode) insert(route *routeDef) {
+	for _, variant := range route.pattern.variants() {
+		node := n
+		names := []string{}
+		for _, seg := range variant {
+			switch {
+			case seg.catchAll:
+				names = append(names, seg.param)
+			case seg.param != "":
+				names = append(names, seg.param)
+				node = node.paramChild(seg.kind)
+			default:
+				child, ok := node.literals[seg.literal]
+				if !ok {
+					child = newRouteNode()
+					node.literals[seg.literal] = child
+				}
+				node = child
+			}
+		}
+
+		entry := routeEntry{route: route, names: names}
+		if len(variant) > 0 && variant[len(variant)-1].catchAll {
+			node.catchAll = insertEntry(node.catchAll, entry)
+		} else {
+			node.routes = insertEntry(node.routes, entry)
+		}
+	}
+}
+
+func (n *routeNode) paramChild(kind string) *routeNode {
+	child, ok := n.params[kind]
+	if !ok {
+		child = newRouteNode()
+		n.params[kind] = child
+		n.kinds = append(n.kinds, kind)
+		sort.Slice(n.kinds, func(i, j int) bool {
+			if (n.kinds[i] == "") != (n.kinds[j] == "") {
+				return n.kinds[j] == ""
+			}
+			return n.kinds[i] < n.kinds[j]
+		})
+	}
+	return child
+}
+
+// insertEntry adds the entry after the entries with at least as many query constraints
+func insertEntry(entries []routeEntry, entry routeEntry) []routeEntry {
+	i := len(entries)
+	for i > 0 && len(entries[i-1].route.pattern.query) < len(entry.route.pattern.query) {
+		i--
+	}
+	entries = append(entries, routeEntry{})
+	copy(entries[i+1:], entries[i:])
+	entries[i] = entry
+	return entries
+}
+
+// routeMatch a route whose path pattern matches, with the values captured along the path
+type routeMatch struct {
+	entry  routeEntry
+	values []string
+}
+
+// collect appends every route matching the segments, most specific first: literals before typed parameters, typed
+// parameters before untyped ones, and those before catch-alls
+// Segments are matched decoded; catch-alls capture the rest of the path as escaped, so that an encoded slash stays
+// apart from the separators.
+func (n *routeNode) collect(segments, escaped []string, values []string, matches []routeMatch) []routeMatch {
+	if len(segments) == 0 {
+		for _, entry := range n.routes {
+			matches = append(matches, routeMatch{entry: entry, values: values})
+		}
+	} else {
+		if child, ok := n.literals[segments[0]]; ok {
+			matches = child.collect(segments[1:], escaped[1:], values, matches)
+		}
+		if segments[0] != "" {
+			for _, kind := range n.kinds {
+				if kind == "" || paramTypes[kind](segments[0]) {
+					captured := append(append([]string{}, values...), segments[0])
+					matches = n.params[kind].collect(segments[1:], escaped[1:], captured, matches)
+				}
+			}
+		}
+	}
+	for _, entry := range n.catchAll {
+		captured := append(append([]string{}, values...), strings.Join(escaped, "/"))
+		matches = append(matches, routeMatch{entry: entry, values: captured})
+	}
+	return matches
+}
+
+// params returns the route parameters of the match, or false if the query does not meet the route's constraints
+func (m routeMatch) params(query url.Values) (map[string]string, bool) {
+	params := make(map[string]string, len(m.values))
+	for i, name := range m.entry.names {
+		params[name] = m.values[i]
+	}
+	for _, qc := range m.entry.route.pattern.query {
+		values, ok := query[qc.key]
+		if !ok {
+			return nil, false
+		}
+		value := ""
+		if len(values) > 0 {
+			value = values[0]
+		}
+		switch {
+		case qc.param != "":
+			if qc.kind != "" && !paramTypes[qc.kind](value) {
+				return nil, false
+			}
+			params[qc.param] = value
+		case qc.value != "" && value != qc.value:
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// splitRoutePath returns the segments of a URL's path, ignoring a trailing slash, both decoded and as escaped
+// The path is split before decoding, so an encoded slash is part of a segment rather than a separator.
+func splitRoutePath(target *url.URL) ([]string, []string, error) {
+	path := strings.TrimSuffix(strings.TrimPrefix(target.EscapedPath(), "/"), "/")
+	if path == "" {
+		return nil, nil, nil
+	}
+	escaped := strings.Split(path, "/")
+	segments := make([]string, len(escaped))
+	for i, seg := range escaped {
+		decoded, err := url.PathUnescape(seg)
+		if err != nil {
+			return nil, nil, err
+		}
+		segments[i] = decoded
+	}
+	return segments, escaped, nil
+}
@@ -0,0 +1,157 @@
+package ltiservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// routeTarget routes a launch targeting the URL, returning the path of the matched route and its parameters
+func routeTarget(ltis *LTIService, target string) (string, map[string]string) {
+	launch := &Launch{}
+	launch.Message.TargetLinkURI = target
+	route, params := ltis.matchRoute(launchTarget(launch), launch)
+	if route == nil {
+		return "", nil
+	}
+	return route.Path, params
+}
+
+func TestRoutePatterns(t *testing.T) {
+	ltis := testService()
+	noop := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	for _, path := range []string{
+		"/",
+		"/foo",
+		"/quiz/new",
+		"/quiz/:id<int>",
+		"/quiz/:slug",
+		"/quiz/:id<int>/attempts/:attempt?",
+		"/files/*path",
+		"/items/:id<uuid>",
+		"/report?format=csv",
+		"/report?format=:format&page=:page<int>",
+		"/report",
+	} {
+		require.NoError(t, ltis.DefineRoute(path, noop), path)
+	}
+
+	tests := []struct {
+		target string
+		route  string
+		params map[string]string
+	}{
+		{"https://tool.example.com/", "/", map[string]string{}},
+		{"https://tool.example.com", "/", map[string]string{}},
+		{"https://tool.example.com/foo", "/foo", map[string]string{}},
+		{"https://tool.example.com/foo/", "/foo", map[string]string{}},
+		{"https://tool.example.com/bar/foo", "", nil},
+		{"https://tool.example.com/foo/bar", "", nil},
+		{"https://tool.example.com/quiz/new", "/quiz/new", map[string]string{}},
+		{"https://tool.example.com/quiz/7", "/quiz/:id<int>", map[string]string{"id": "7"}},
+		{"https://tool.example.com/quiz/seven", "/quiz/:slug", map[string]string{"slug": "seven"}},
+		{"https://tool.example.com/quiz//", "", nil},
+		{"https://tool.example.com/quiz/7/attempts", "/quiz/:id<int>/attempts/:attempt?", map[string]string{"id": "7"}},
+		{"https://tool.example.com/quiz/7/attempts/2", "/quiz/:id<int>/attempts/:attempt?", map[string]string{"id": "7", "attempt": "2"}},
+		{"https://tool.example.com/files", "/files/*path", map[string]string{"path": ""}},
+		{"https://tool.example.com/files/a/b.pdf", "/files/*path", map[string]string{"path": "a/b.pdf"}},
+		{"https://tool.example.com/files/a%2Fb/c%20d.pdf", "/files/*path", map[string]string{"path": "a%2Fb/c%20d.pdf"}},
+		{"https://tool.example.com/quiz/7%2Fattempts", "/quiz/:slug", map[string]string{"slug": "7/attempts"}},
+		{"https://tool.example.com/quiz/caf%C3%A9", "/quiz/:slug", map[string]string{"slug": "café"}},
+		{"https://tool.example.com/quiz%2Fnew", "", nil},
+		{"https://tool.example.com/items/8f14e45f-ceea-467f-a0e6-1e2b6a8d7c41", "/items/:id<uuid>", map[string]string{"id": "8f14e45f-ceea-467f-a0e6-1e2b6a8d7c41"}},
+		{"https://tool.example.com/items/8", "", nil},
+		{"https://tool.example.com/report?format=csv", "/report?format=csv", map[string]string{}},
+		{"https://tool.example.com/report?format=pdf&page=2", "/report?format=:format&page=:page<int>", map[string]string{"format": "pdf", "page": "2"}},
+		{"https://tool.example.com/report?format=pdf&page=two", "/report", map[string]string{}},
+		{"https://tool.example.com/report", "/report", map[string]string{}},
+	}
+
+	for _, test := range tests {
+		route, params := routeTarget(ltis, test.target)
+		assert.Equal(t, test.route, route, test.target)
+		assert.Equal(t, test.params, params, test.target)
+	}
+}
+
+func TestRoutePriorityOverSpecificity(t *testing.T) {
+	ltis := testService()
+	noop := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	require.NoError(t, ltis.DefineRoute("/quiz/new", noop))
+	require.NoError(t, ltis.AddRoute(Route{Path: "/quiz/*rest", Handler: noop, Priority: 1}))
+
+	route, params := routeTarget(ltis, "https://tool.example.com/quiz/new")
+	assert.Equal(t, "/quiz/*rest", route)
+	assert.Equal(t, map[string]string{"rest": "new"}, params)
+}
+
+func TestRouteConflicts(t *testing.T) {
+	noop := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	tests := []struct {
+		first, second string
+		conflict      bool
+	}{
+		{"/quiz/:id", "/quiz/:name", true},
+		{"/quiz/:id<int>", "/quiz/:n<int>", true},
+		{"/quiz/:id?", "/quiz", true},
+		{"/quiz/", "/quiz", true},
+		{"/report?format=csv&preview", "/report?preview&format=csv", true},
+		{"/quiz/:id<int>", "/quiz/:slug", false},
+		{"/quiz/:id", "/quiz/new", false},
+		{"/files/*path", "/files/:name", false},
+		{"/report?format=csv", "/report?format=pdf", false},
+		{"/report?format=csv", "/report", false},
+	}
+
+	for _, test := range tests {
+		ltis := testService()
+		require.NoError(t, ltis.DefineRoute(test.first, noop))
+		err := ltis.DefineRoute(test.second, noop)
+		if test.conflict {
+			assert.Error(t, err, "%s and %s", test.first, test.second)
+		} else {
+			assert.NoError(t, err, "%s and %s", test.first, test.second)
+		}
+	}
+
+	ltis := testService()
+	require.NoError(t, ltis.DefineRoute("/quiz/:id", noop))
+	assert.NoError(t, ltis.DefineRoute("/quiz/:name", noop, ForRoles("Instructor")), "conditions tell the routes apart")
+	assert.NoError(t, ltis.AddRoute(Route{Path: "/quiz/:name", Handler: noop, Priority: 1}), "priorities tell the routes apart")
+	assert.NoError(t, ltis.DefineRoute("/quiz/:id", noop), "defining a path again replaces its handler")
+}
+
+func TestInvalidRoutePatterns(t *testing.T) {
+	noop := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	for _, path := range []string{
+		"/quiz//attempts",
+		"/files/*path/more",
+		"/files/*",
+		"/files/*path?",
+		"/quiz/:",
+		"/quiz/:id/:id",
+		"/quiz/:id<float>",
+		"/quiz/:id<int",
+		"/report?=csv",
+		"/report/:page?page=:page",
+	} {
+		assert.Error(t, testService().DefineRoute(path, noop), path)
+	}
+	assert.Error(t, testService().DefineRoute("/quiz", nil))
+}
+
+func TestRouteLaunchQueryParams(t *testing.T) {
+	ltis := testService()
+	require.NoError(t, ltis.DefineRoute("/quiz/:id<int>?attempt=:attempt", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(RouteParam(req, "id") + " " + RouteParam(req, "attempt")))
+	})))
+
+	launch := &Launch{}
+	launch.Message.TargetLinkURI = "https://tool.example.com/quiz/7?attempt=3"
+	w := httptest.NewRecorder()
+	assert.True(t, ltis.RouteLaunch(w, httptest.NewRequest("POST", "/launch", nil), launch))
+	assert.Equal(t, "7 3", w.Body.String())
+}
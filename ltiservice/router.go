@@ -1,102 +1,245 @@
 package ltiservice
 
 import (
-	"regexp"
-	"strings"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
 
-	"github.com/MZDevinc/go-lti/lti"
 	"github.com/gin-gonic/gin"
 )
 
 type routeDef struct {
-	Path      string
-	MatchExp  *regexp.Regexp
-	HasParams bool
-	Handler   func(*gin.Context, map[string]string)
-}
-
-// DefineRoute Match URL path pattern with a handler function
-// The path can define parameters similarly to gin (/:parameter/), and the handler will receive those parameter in a map
-// when the route is matched
-func (ltis *LTIService) DefineRoute(path string, handler func(c *gin.Context, params map[string]string)) error {
-	found := false
-	for i := range ltis.routes {
-		if ltis.routes[i].Path == path {
-			ltis.routes[i].Handler = handler
-			found = true
-		}
+	Path       string
+	Handler    http.Handler
+	Conditions []RouteCondition
+	Priority   int
+	pattern    *routePattern
+	shapes     []string
+	// Messages the launches platforms should offer for the route, see DescribeRoute
+	Messages []ToolMessage
+}
+
+// Route a launch route, see AddRoute
+type Route struct {
+	// Path the pattern the path of the launch's target link URI must match, see DefineRoute
+	Path    string
+	Handler http.Handler
+	// Conditions must all accept a launch for the route to serve it
+	Conditions []RouteCondition
+	// Priority routes with a higher priority are tried first; routes of equal priority in the order they were added
+	Priority int
+}
+
+// DefineRoute Match URL path pattern with a handler
+// Patterns match the whole path of the launch's target link URI, ignoring a trailing slash. Segments are literals
+// (/quiz), parameters matching any non-empty segment (/:id), typed parameters matching only int, uuid or alpha values
+// (/:id<int>), or a final catch-all matching the rest of the path, if any (/*path). Parameters are decoded, while a
+// catch-all holds the rest of the path as escaped in the target link URI, so an encoded slash (%2F) is never taken
+// for a separator.
+// A segment ending in "?" is optional, as in /quiz/:id?. The pattern may end in query constraints, such as
+// ?mode=practice&preview&attempt=:n<int>, requiring a query parameter with a value, any value or a captured value.
+// When several routes match, literals win over typed parameters, typed parameters over parameters and those over
+// catch-alls.
+// When a launch is routed to the handler, the request context carries the launch and the route parameters, see
+// LaunchFromContext and RouteParams. A route is only used for launches every condition accepts; defining a path
+// again without conditions replaces the handler of its unconditional route, while other unconditional routes
+// matching the same launches are rejected as conflicting.
+func (ltis *LTIService) DefineRoute(path string, handler http.Handler, conditions ...RouteCondition) error {
+	return ltis.AddRoute(Route{Path: path, Handler: handler, Conditions: conditions})
+}
+
+// AddRoute Define a launch route, like DefineRoute, with a priority
+func (ltis *LTIService) AddRoute(route Route) error {
+	if route.Handler == nil {
+		return fmt.Errorf("Route %q has no handler", route.Path)
+	}
+	pattern, err := parseRoutePattern(route.Path)
+	if err != nil {
+		return err
+	}
+	def := &routeDef{
+		Path:       route.Path,
+		Handler:    route.Handler,
+		Conditions: route.Conditions,
+		Priority:   route.Priority,
+		pattern:    pattern,
+		shapes:     pattern.shapes(),
 	}
 
-	if !found {
-		matchExp, hasParams, err := ltis.processRoute(path)
-		if err != nil {
-			return err
+	if len(def.Conditions) == 0 {
+		for _, existing := range ltis.routes {
+			if len(existing.Conditions) > 0 || existing.Priority != def.Priority {
+				continue
+			}
+			if existing.Path == def.Path {
+				existing.Handler = def.Handler
+				return nil
+			}
+			if shape := sharedShape(existing.shapes, def.shapes); shape != "" {
+				return fmt.Errorf("Route %q conflicts with route %q, both match %s", def.Path, existing.Path, shape)
+			}
 		}
-		ltis.routes = append(ltis.routes, routeDef{
-			Path:      path,
-			MatchExp:  matchExp,
-			HasParams: hasParams,
-			Handler:   handler,
-		})
 	}
 
+	if ltis.routeTree == nil {
+		ltis.routeTree = newRouteNode()
+	}
+	ltis.routeTree.insert(def)
+	ltis.routes = append(ltis.routes, def)
 	return nil
 }
 
-// ParseRoute given a definite URL path, tries to match that path with routes that have been defined
-func (ltis *LTIService) ParseRoute(c *gin.Context, path string, msg lti.LaunchMessage) {
-	ltis.debug("Route path", path)
-	for i := range ltis.routes {
-		route := ltis.routes[i]
-		if route.HasParams {
-			match := route.MatchExp.FindStringSubmatch(path)
-			if match != nil {
-				ltis.debug("Matched route", route.Path)
-				paramNames := route.MatchExp.SubexpNames()
-				params := make(map[string]string)
-				for j := range paramNames {
-					params[paramNames[j]] = match[j]
-				}
-
-				route.Handler(c, params)
-				return
-			}
-		} else {
-			match := route.MatchExp.FindStringIndex(path)
-			if match != nil {
-				ltis.debug("Matched route", route.Path)
-				route.Handler(c, nil)
-				return
+func sharedShape(a, b []string) string {
+	for _, shape := range a {
+		if containsString(b, shape) {
+			return shape
+		}
+	}
+	return ""
+}
+
+// SetFallbackRoute Define the handler serving launches that no route accepts, e.g. a landing page
+func (ltis *LTIService) SetFallbackRoute(handler http.Handler) {
+	ltis.fallbackRoute = handler
+}
+
+// SetNotFoundRoute Define the handler responding to launches that no route accepts when there is no fallback route
+// http.NotFound is used by default.
+func (ltis *LTIService) SetNotFoundRoute(handler http.Handler) {
+	ltis.notFoundRoute = handler
+}
+
+// DescribeRoute Advertise a defined route to platforms as the target of the given messages
+// The messages are added to the tool configuration built by BuildToolConfiguration, with the route as their target
+// link URI unless they set their own. Only routes matching a single URL can be described, since platforms need a
+// definite URL: routes without parameters, catch-alls, optional segments or query constraints other than values.
+func (ltis *LTIService) DescribeRoute(path string, messages ...ToolMessage) error {
+	for _, route := range ltis.routes {
+		if route.Path == path {
+			if _, ok := route.pattern.target(); !ok {
+				return fmt.Errorf("Route %q matches more than one URL and cannot be a launch target", path)
 			}
+			route.Messages = append(route.Messages, messages...)
+			return nil
 		}
 	}
+	return fmt.Errorf("Route %q is not defined", path)
+}
+
+// GetRouterHandler Returns a launch handler that routes every validated launch with RouteLaunch
+func (ltis *LTIService) GetRouterHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ltis.launch(w, req, func(launch *Launch) {
+			ltis.RouteLaunch(w, req, launch)
+		})
+	})
+}
+
+// RouteLaunch Serves the launch with the first route, by priority, that matches the path of its target link URI and
+// whose conditions accept it
+// If no route accepts the launch, it is served by the fallback route, or else the not found route, and false is
+// returned.
+func (ltis *LTIService) RouteLaunch(w http.ResponseWriter, req *http.Request, launch *Launch) bool {
+	target := launchTarget(launch)
+	ltis.debug("Route path %q", target.Path)
+	route, params := ltis.matchRoute(target, launch)
+
+	handler := ltis.notFoundRoute
+	if route != nil {
+		ltis.debug("Matched route %q", route.Path)
+		handler = route.Handler
+	} else if ltis.fallbackRoute != nil {
+		ltis.debug("No route matched, using the fallback route")
+		handler = ltis.fallbackRoute
+		params = map[string]string{}
+	} else if handler == nil {
+		handler = http.HandlerFunc(http.NotFound)
+	}
+
+	ctx := context.WithValue(WithLaunch(req.Context(), launch), routeParamsKey{}, params)
+	handler.ServeHTTP(w, req.WithContext(ctx))
+	return route != nil
 }
 
-func (ltis *LTIService) processRoute(path string) (*regexp.Regexp, bool, error) {
-	path = strings.TrimPrefix(path, "/")
-	path = strings.TrimSuffix(path, "/")
-	parts := strings.Split(path, "/")
+// GinRouteLaunch Serves the launch like RouteLaunch from within a gin handler
+// Route handlers built with GinRoute receive the gin context.
+func (ltis *LTIService) GinRouteLaunch(c *gin.Context, launch *Launch) bool {
+	req := c.Request.WithContext(context.WithValue(c.Request.Context(), ginContextKey{}, c))
+	return ltis.RouteLaunch(c.Writer, req, launch)
+}
 
-	hasParams := false
-	pattern := ""
-	for i := 0; i < len(parts); i++ {
-		part := parts[i]
-		if part == "" {
-			continue
+// GinRoute Returns a route handler calling a gin handler with the route parameters
+// The launch must be routed with GinRouteLaunch; the request of the gin context then carries the launch, see
+// LaunchFromContext.
+func GinRoute(handler func(c *gin.Context, params map[string]string)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c, ok := req.Context().Value(ginContextKey{}).(*gin.Context)
+		if !ok {
+			http.Error(w, "gin routes must be served with GinRouteLaunch", http.StatusInternalServerError)
+			return
 		}
+		c.Request = req
+		handler(c, RouteParams(req))
+	})
+}
+
+type routeParamsKey struct{}
+
+type ginContextKey struct{}
+
+// RouteParams Returns the parameters of the route the request was routed to
+func RouteParams(req *http.Request) map[string]string {
+	params, _ := req.Context().Value(routeParamsKey{}).(map[string]string)
+	return params
+}
+
+// RouteParam Returns the named parameter of the route the request was routed to
+func RouteParam(req *http.Request, name string) string {
+	return RouteParams(req)[name]
+}
+
+// launchTarget returns the launch's target link URI
+func launchTarget(launch *Launch) *url.URL {
+	target, err := url.Parse(launch.Message.TargetLinkURI)
+	if err != nil {
+		return &url.URL{}
+	}
+	return target
+}
 
-		if part[0] == ':' {
-			hasParams = true
-			part = strings.TrimPrefix(part, ":")
-			part = regexp.QuoteMeta(part)
-			pattern += `\/(?P<` + part + `>[^\/]+)`
-		} else {
-			part = regexp.QuoteMeta(part)
-			pattern += `\/` + part
+// matchRoute returns the first route, by priority and then specificity, matching the target whose conditions accept
+// the launch, with its parameters
+func (ltis *LTIService) matchRoute(target *url.URL, launch *Launch) (*routeDef, map[string]string) {
+	if ltis.routeTree == nil {
+		return nil, nil
+	}
+	segments, escaped, err := splitRoutePath(target)
+	if err != nil {
+		return nil, nil
+	}
+	matches := ltis.routeTree.collect(segments, escaped, nil, nil)
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].entry.route.Priority > matches[j].entry.route.Priority
+	})
+
+	query := target.Query()
+	for _, match := range matches {
+		params, ok := match.params(query)
+		if ok && match.entry.route.accepts(launch) {
+			return match.entry.route, params
 		}
 	}
-	pattern += `\/?$`
+	return nil, nil
+}
 
-	re, err := regexp.Compile(pattern)
-	return re, hasParams, err
+// accepts reports whether every condition of the route accepts the launch
+func (route *routeDef) accepts(launch *Launch) bool {
+	for _, condition := range route.Conditions {
+		if !condition(launch) {
+			return false
+		}
+	}
+	return true
 }
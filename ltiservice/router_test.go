@@ -0,0 +1,173 @@
+package ltiservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MZDevinc/go-lti/lti"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// targetLaunchPayload is a valid launch targeting the URL
+func targetLaunchPayload(target string) []byte {
+	claims := map[string]interface{}{}
+	json.Unmarshal(validLaunchPayload(), &claims)
+	claims["https://purl.imsglobal.org/spec/lti/claim/target_link_uri"] = target
+	payload, _ := json.Marshal(claims)
+	return payload
+}
+
+func TestGetRouterHandler(t *testing.T) {
+	keySet := keySetServer(t)
+	defer keySet.Close()
+	ltis := NewLTIService(nil, Config{PlatformIssuer: testIssuer, ClientID: testClientID, KeySetURL: keySet.URL})
+
+	routed := ""
+	var params map[string]string
+	var launch *Launch
+	route := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			routed = name
+			params = RouteParams(req)
+			launch, _ = LaunchFromContext(req.Context())
+		})
+	}
+	require.NoError(t, ltis.DefineRoute("/quiz", route("quizzes")))
+	require.NoError(t, ltis.DefineRoute("/quiz/:id", route("quiz")))
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		routed, params, launch = "", nil, nil
+		w := httptest.NewRecorder()
+		ltis.GetRouterHandler().ServeHTTP(w, launchRequest(signRawPayload(t, targetLaunchPayload(target))))
+		return w
+	}
+
+	serve("https://tool.example.com/quiz/7?attempt=2")
+	assert.Equal(t, "quiz", routed)
+	assert.Equal(t, map[string]string{"id": "7"}, params)
+	if assert.NotNil(t, launch, "handlers get the launch") {
+		assert.Equal(t, "deployment-1", launch.Message.DeploymentID)
+	}
+
+	serve("https://tool.example.com/quiz/")
+	assert.Equal(t, "quizzes", routed)
+	assert.Empty(t, params)
+
+	w := serve("https://tool.example.com/grades")
+	assert.Equal(t, "", routed)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRouteConditions(t *testing.T) {
+	ltis := testService()
+	named := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte(name))
+		})
+	}
+	require.NoError(t, ltis.DefineRoute("/quiz", named("picker"), ForMessageType(lti.MessageTypeDeepLinking)))
+	require.NoError(t, ltis.DefineRoute("/quiz", named("review"), ForMessageType(lti.MessageTypeSubmissionReview)))
+	require.NoError(t, ltis.DefineRoute("/quiz", named("editor"), ForRoles("Instructor")))
+	require.NoError(t, ltis.DefineRoute("/quiz", named("practice"), ForCustom("mode", "practice")))
+	require.NoError(t, ltis.DefineRoute("/quiz", named("nav"), ForPlacement("course_navigation")))
+	require.NoError(t, ltis.DefineRoute("/quiz", named("quiz")))
+	require.NoError(t, ltis.AddRoute(Route{
+		Path:       "/quiz",
+		Handler:    named("preview"),
+		Conditions: []RouteCondition{ForCustom("preview")},
+		Priority:   1,
+	}))
+
+	tests := []struct {
+		name   string
+		modify func(*lti.LaunchMessage)
+		want   string
+	}{
+		{"resource link", func(*lti.LaunchMessage) {}, "quiz"},
+		{"deep linking", func(m *lti.LaunchMessage) { m.MessageType = lti.MessageTypeDeepLinking }, "picker"},
+		{"submission review", func(m *lti.LaunchMessage) { m.MessageType = lti.MessageTypeSubmissionReview }, "review"},
+		{"instructor", func(m *lti.LaunchMessage) { m.Roles = []string{lti.ContextRoleInstructor} }, "editor"},
+		{"custom value", func(m *lti.LaunchMessage) { m.Custom = &map[string]interface{}{"mode": "practice"} }, "practice"},
+		{"other custom value", func(m *lti.LaunchMessage) { m.Custom = &map[string]interface{}{"mode": "exam"} }, "quiz"},
+		{"placement", func(m *lti.LaunchMessage) {
+			m.Extensions = map[string]json.RawMessage{"https://www.instructure.com/placement": json.RawMessage(`"course_navigation"`)}
+		}, "nav"},
+		{"priority", func(m *lti.LaunchMessage) {
+			m.MessageType = lti.MessageTypeDeepLinking
+			m.Custom = &map[string]interface{}{"preview": true}
+		}, "preview"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			launch := &Launch{}
+			launch.Message.MessageType = lti.MessageTypeResourceLink
+			launch.Message.TargetLinkURI = "https://tool.example.com/quiz"
+			launch.Message.Roles = []string{lti.ContextRoleLearner}
+			test.modify(&launch.Message)
+
+			w := httptest.NewRecorder()
+			assert.True(t, ltis.RouteLaunch(w, httptest.NewRequest("POST", "/launch", nil), launch))
+			assert.Equal(t, test.want, w.Body.String())
+		})
+	}
+}
+
+func TestRouteFallback(t *testing.T) {
+	ltis := testService()
+	require.NoError(t, ltis.DefineRoute("/quiz", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), ForRoles("Instructor")))
+	launch := &Launch{}
+	launch.Message.TargetLinkURI = "https://tool.example.com/quiz"
+	launch.Message.Roles = []string{lti.ContextRoleLearner}
+
+	w := httptest.NewRecorder()
+	assert.False(t, ltis.RouteLaunch(w, httptest.NewRequest("POST", "/launch", nil), launch))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	ltis.SetNotFoundRoute(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	w = httptest.NewRecorder()
+	assert.False(t, ltis.RouteLaunch(w, httptest.NewRequest("POST", "/launch", nil), launch))
+	assert.Equal(t, http.StatusGone, w.Code)
+
+	var fallbackLaunch *Launch
+	ltis.SetFallbackRoute(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fallbackLaunch, _ = LaunchFromContext(req.Context())
+	}))
+	w = httptest.NewRecorder()
+	assert.False(t, ltis.RouteLaunch(w, httptest.NewRequest("POST", "/launch", nil), launch))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, launch, fallbackLaunch)
+}
+
+func TestGinRouteLaunch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ltis := testService()
+	require.NoError(t, ltis.DefineRoute("/quiz/:id", GinRoute(func(c *gin.Context, params map[string]string) {
+		launch, _ := LaunchFromContext(c.Request.Context())
+		c.String(http.StatusOK, "%s %s", params["id"], launch.Message.DeploymentID)
+	})))
+
+	launch := &Launch{}
+	launch.Message.TargetLinkURI = "https://tool.example.com/quiz/7"
+	launch.Message.DeploymentID = "deployment-1"
+
+	router := gin.New()
+	matched := false
+	router.POST("/launch", func(c *gin.Context) {
+		matched = ltis.GinRouteLaunch(c, launch)
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/launch", nil))
+	assert.True(t, matched)
+	assert.Equal(t, "7 deployment-1", w.Body.String())
+
+	w = httptest.NewRecorder()
+	assert.True(t, ltis.RouteLaunch(w, httptest.NewRequest("POST", "/launch", nil), launch))
+	assert.Equal(t, http.StatusInternalServerError, w.Code, "gin routes need a gin context")
+}
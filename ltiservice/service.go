@@ -19,21 +19,54 @@ import (
 type LTIService struct {
 	Store          sessions.Store
 	Config         Config
-	routes         []routeDef
+	routes         []*routeDef
+	routeTree      *routeNode
+	fallbackRoute  http.Handler
+	notFoundRoute  http.Handler
 	SigningKeyFunc *func() (jwa.SignatureAlgorithm, interface{}, error)
 	OutgoingJWTkid string
-	debug          func(string, ...interface{})
+	ErrorHandler   ErrorHandler  // Writes the response for failed launches; DefaultErrorHandler is used when nil
+	ErrorReporter  ErrorReporter // Notified of every failed launch
+	// Registrations looks up platform registrations by issuer, in addition to Config
+	Registrations RegistrationStore
+	// Deployments looks up the deployments allowed to launch the tool, in addition to Config.DeploymentIDs
+	Deployments DeploymentStore
+	// DeploymentApprover, when set, is asked whether unknown deployments may be registered on their first launch
+	DeploymentApprover DeploymentApprover
+	// RegistrationApprover decides which dynamic registration requests GetRegistrationHandler completes
+	RegistrationApprover RegistrationApprover
+	// States binds the OIDC state of logins server-side, see Config.StateMode
+	States StateStore
+	// Launches keeps validated launches for GetLaunch
+	Launches LaunchStore
+	// SessionTokenTTL when positive, every launch gets a tool session token valid this long, see Launch.SessionToken
+	SessionTokenTTL time.Duration
+	// Clock controls how token timestamps are checked
+	Clock ClockPolicy
+	// registrationClient fetches the URLs of dynamic registration requests; newRegistrationClient() when nil
+	registrationClient *http.Client
+	debug              func(string, ...interface{})
 }
 
 // Config configuration for the Platform/Tool interface
 type Config struct {
-	AuthLoginURL string // URL on the Platform that handles the Login redirect
-	LaunchURL    string // URL on the Tool that handles the Launch request
-	ClientID     string // The Platform's Client ID
-	KeySetURL    string // URL on the Platform that provides its public keys via JWKS
-	AuthTokenURL string // URL to obtain an auth token
-	AuthTokenAud string // Aud field for auth token request
-	Issuer       string // Issuer URL, for creating initial JWT
+	// PlatformIssuer Issuer (iss) the Platform uses in its id_tokens
+	// It is required: launches are validated against it and rejected with ErrCodeIssuerMismatch while it is empty.
+	// Earlier versions did not check the issuer, so configurations that left it empty must set it when upgrading.
+	PlatformIssuer string
+	AuthLoginURL   string // URL on the Platform that handles the Login redirect
+	LaunchURL      string // URL on the Tool that handles the Launch request
+	ClientID       string // The Platform's Client ID
+	KeySetURL      string // URL on the Platform that provides its public keys via JWKS
+	AuthTokenURL   string // URL to obtain an auth token
+	AuthTokenAud   string // Aud field for auth token request
+	Issuer         string // Issuer URL, for creating initial JWT
+
+	DeploymentIDs []string  // Deployment IDs allowed to launch the tool, see also LTIService.Deployments
+	StateMode     StateMode // How launches are matched with their login, see also LTIService.States
+
+	RedirectURIs   []string // Other Tool URLs that handle Launch requests, used directly when a login targets them
+	TargetLinkURIs []string // URLs launches may target, a trailing slash allows everything below; defaults to the redirect URI origins
 }
 
 // NewLTIService Returns an LTIService initialized with given configuration and stores
@@ -42,23 +75,23 @@ func NewLTIService(store sessions.Store, config Config) *LTIService {
 		// Production mode, no-op
 	}
 
-	return &LTIService{Store: store, Config: config, debug: debug}
+	return &LTIService{Store: store, Config: config, Clock: DefaultClockPolicy(), debug: debug}
 }
 
 // NewLTIServiceWithDebug Returns an LTIService initialized with given configuration and stores,
 // which will output debug messages using log.Printf
 func NewLTIServiceWithDebug(store sessions.Store, config Config) *LTIService {
 	debug := func(format string, a ...interface{}) {
-		log.Printf(format, a)
+		log.Printf(format, a...)
 	}
 
-	return &LTIService{Store: store, Config: config, debug: debug}
+	return &LTIService{Store: store, Config: config, Clock: DefaultClockPolicy(), debug: debug}
 }
 
 // NewLTIServiceWithCustomDebug Returns an LTIService initialized with given configuration and stores,
 // which will output debug messages using the given debug handler
 func NewLTIServiceWithCustomDebug(store sessions.Store, config Config, debug func(string, ...interface{})) *LTIService {
-	return &LTIService{Store: store, Config: config, debug: debug}
+	return &LTIService{Store: store, Config: config, Clock: DefaultClockPolicy(), debug: debug}
 }
 
 // SetSigningKeyFunc Define a function that can be used to get a signing key for JWTs
@@ -81,11 +114,10 @@ func (ltis *LTIService) getValidationKey(token *jwt.Token) (interface{}, error)
 	//TO-DO
 	//Now that we have the keyset, save it in cache if we implement a cache
 
-	kid, ok := token.Header["kid"]
+	kidStr, ok := token.Header["kid"].(string)
 	if !ok {
-		return nil, errors.Wrapf(err, "Failed fetching keyset from endpoint: %q", "no kid")
+		return nil, fmt.Errorf("Token header has no kid")
 	}
-	kidStr := kid.(string)
 	ltis.debug("Looking for token kid: %q", kidStr)
 
 	keys := keyset.LookupKeyID(kidStr)
@@ -149,7 +181,7 @@ func (ltis *LTIService) DoServiceRequest(scopes []string, url, pMethod, body, pC
 	}
 	// log.Printf("access token fetched: %s", accessToken)
 	client := &http.Client{Timeout: time.Second * 30}
-	if method == "POST" || method == "PUT"{
+	if method == "POST" || method == "PUT" {
 		req, err = http.NewRequest(method, url, strings.NewReader(body))
 		if err != nil {
 			return nil, errors.Wrapf(err, "DoServiceReq: Error Creating new request for POST to %q", url)
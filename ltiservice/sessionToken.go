@@ -0,0 +1,214 @@
+package ltiservice
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MZDevinc/go-lti/lti"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/pkg/errors"
+)
+
+// sessionTokenUse the token_use claim of tool session tokens, which keeps them apart from other JWTs signed with
+// the tool key, such as deep linking responses
+const sessionTokenUse = "lti_tool_session"
+
+// SessionClaims the claims of a tool session token
+// Issuer, ClientID and Subject are those of the launch, so the token names the same user of the same platform.
+type SessionClaims struct {
+	Issuer       string       `json:"iss"`
+	ClientID     string       `json:"aud"`
+	Subject      string       `json:"sub,omitempty"`
+	DeploymentID string       `json:"https://purl.imsglobal.org/spec/lti/claim/deployment_id"`
+	Context      *lti.Context `json:"https://purl.imsglobal.org/spec/lti/claim/context,omitempty"`
+	Roles        []string     `json:"https://purl.imsglobal.org/spec/lti/claim/roles,omitempty"`
+	LaunchID     string       `json:"launch_id,omitempty"`
+	TokenUse     string       `json:"token_use"`
+	IssuedAt     int64        `json:"iat"`
+	ExpiresAt    int64        `json:"exp"`
+}
+
+// SetSessionTokenTTL Make every launch mint a tool session token valid for the TTL, see Launch.SessionToken
+// Session tokens are signed with the key from SigningKeyFunc; a zero TTL stops minting them.
+func (ltis *LTIService) SetSessionTokenTTL(ttl time.Duration) {
+	ltis.SessionTokenTTL = ttl
+}
+
+// mintSessionToken sets a signed tool session token on the launch, if the service is configured to mint them
+func (ltis *LTIService) mintSessionToken(launch *Launch) error {
+	if ltis.SessionTokenTTL <= 0 {
+		return nil
+	}
+
+	msg := launch.Message
+	now := ltis.Clock.now()
+	claims := SessionClaims{
+		Issuer:       msg.Iss,
+		ClientID:     msg.Aud,
+		DeploymentID: msg.DeploymentID,
+		Context:      msg.Context,
+		Roles:        msg.Roles,
+		LaunchID:     launch.ID,
+		TokenUse:     sessionTokenUse,
+		IssuedAt:     now.Unix(),
+		ExpiresAt:    now.Add(ltis.SessionTokenTTL).Unix(),
+	}
+	if msg.Sub != nil {
+		claims.Subject = *msg.Sub
+	}
+
+	token, err := ltis.createJWT(claims)
+	if err != nil {
+		return err
+	}
+	launch.SessionToken = string(token)
+	return nil
+}
+
+// ParseSessionToken Returns the claims of a tool session token, once its signature, expiry and use are validated
+func (ltis *LTIService) ParseSessionToken(token string) (*SessionClaims, error) {
+	if strings.Count(token, ".") != 2 {
+		return nil, fmt.Errorf("Session token is not a compact JWT")
+	}
+	method, key, err := ltis.getSigningKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed getting the tool key")
+	}
+	if signer, ok := key.(crypto.Signer); ok {
+		key = signer.Public()
+	}
+
+	payload, err := jws.Verify([]byte(token), method, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "Session token signature is invalid")
+	}
+
+	raw := jwt.MapClaims{}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse session token")
+	}
+	// MaxAge limits how old platform id_tokens may be; session tokens live for SessionTokenTTL, so only exp counts
+	clock := ltis.Clock
+	clock.MaxAge = 0
+	if err := clock.validate(raw); err != nil {
+		return nil, err
+	}
+	claims := &SessionClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, errors.Wrap(err, "Failed to parse session token")
+	}
+	if claims.TokenUse != sessionTokenUse {
+		return nil, fmt.Errorf("Token is not a tool session token")
+	}
+	return claims, nil
+}
+
+// SessionLaunch Returns the launch a tool session token was minted for
+// With a launch store, the stored launch and its services are returned; otherwise, or once the stored launch is
+// gone, the launch is rebuilt from the token's claims and offers no services.
+func (ltis *LTIService) SessionLaunch(req *http.Request, token string) (*Launch, error) {
+	claims, err := ltis.ParseSessionToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.LaunchID != "" && ltis.Launches != nil {
+		launch, err := ltis.GetLaunch(req, claims.LaunchID)
+		if err == nil {
+			return launch, nil
+		}
+		if err != ErrLaunchNotFound {
+			return nil, err
+		}
+	}
+
+	msg := lti.LaunchMessage{}
+	msg.Iss = claims.Issuer
+	msg.Aud = claims.ClientID
+	msg.DeploymentID = claims.DeploymentID
+	msg.Context = claims.Context
+	msg.Roles = claims.Roles
+	if claims.Subject != "" {
+		subject := claims.Subject
+		msg.Sub = &subject
+	}
+	return &Launch{
+		ID:         claims.LaunchID,
+		Message:    msg,
+		Deployment: &Deployment{Issuer: claims.Issuer, ClientID: claims.ClientID, DeploymentID: claims.DeploymentID},
+	}, nil
+}
+
+type launchContextKey struct{}
+
+// WithLaunch Returns a copy of the context carrying the launch
+func WithLaunch(ctx context.Context, launch *Launch) context.Context {
+	return context.WithValue(ctx, launchContextKey{}, launch)
+}
+
+// LaunchFromContext Returns the launch put in the context by the session token middleware
+func LaunchFromContext(ctx context.Context) (*Launch, bool) {
+	launch, ok := ctx.Value(launchContextKey{}).(*Launch)
+	return launch, ok && launch != nil
+}
+
+// bearerToken returns the token of a bearer Authorization header
+func bearerToken(req *http.Request) string {
+	header := req.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
+
+// sessionLaunch returns the launch of the request's bearer tool session token
+func (ltis *LTIService) sessionLaunch(req *http.Request) (*Launch, error) {
+	token := bearerToken(req)
+	if token == "" {
+		return nil, fmt.Errorf("Request has no bearer token")
+	}
+	launch, err := ltis.SessionLaunch(req, token)
+	if err != nil {
+		ltis.debug("Rejected session token: %s", err)
+	}
+	return launch, err
+}
+
+func writeSessionTokenError(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// SessionTokenHandler Returns middleware that admits requests with a valid tool session token as bearer token
+// The launch of the token is put in the request context, see LaunchFromContext. Other requests get a 401.
+func (ltis *LTIService) SessionTokenHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		launch, err := ltis.sessionLaunch(req)
+		if err != nil {
+			writeSessionTokenError(w)
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(WithLaunch(req.Context(), launch)))
+	})
+}
+
+// GinSessionTokenHandler Returns gin middleware that works like SessionTokenHandler
+func (ltis *LTIService) GinSessionTokenHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		launch, err := ltis.sessionLaunch(c.Request)
+		if err != nil {
+			writeSessionTokenError(c.Writer)
+			c.Abort()
+			return
+		}
+		c.Request = c.Request.WithContext(WithLaunch(c.Request.Context(), launch))
+		c.Next()
+	}
+}
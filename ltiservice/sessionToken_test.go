@@ -0,0 +1,168 @@
+package ltiservice
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sessionTokenService(t *testing.T, keySetURL string) *LTIService {
+	ltis := NewLTIService(nil, Config{
+		PlatformIssuer: testIssuer,
+		ClientID:       testClientID,
+		KeySetURL:      keySetURL,
+	})
+	ltis.SetSigningKeyFunc(func() (jwa.SignatureAlgorithm, interface{}, error) {
+		return jwa.RS256, testKey, nil
+	})
+	ltis.SetSessionTokenTTL(15 * time.Minute)
+	return ltis
+}
+
+// sessionTokenLaunch launches the service and returns the launch the callback received
+func sessionTokenLaunch(t *testing.T, ltis *LTIService) *Launch {
+	var launched *Launch
+	w := httptest.NewRecorder()
+	ltis.GetLaunchContextHandler(func(launch *Launch) {
+		launched = launch
+	}).ServeHTTP(w, launchRequest(signRawPayload(t, serviceLaunchPayload())))
+	require.NotNil(t, launched, "launch was rejected: %d %s", w.Code, w.Body.String())
+	require.NotEmpty(t, launched.SessionToken)
+	return launched
+}
+
+func TestSessionTokenClaims(t *testing.T) {
+	keySet := keySetServer(t)
+	defer keySet.Close()
+	ltis := sessionTokenService(t, keySet.URL)
+	ltis.SetLaunchStore(NewMemoryLaunchStore(0))
+	launched := sessionTokenLaunch(t, ltis)
+
+	claims, err := ltis.ParseSessionToken(launched.SessionToken)
+	require.NoError(t, err)
+	assert.Equal(t, testIssuer, claims.Issuer)
+	assert.Equal(t, testClientID, claims.ClientID)
+	assert.Equal(t, *launched.Message.Sub, claims.Subject)
+	assert.Equal(t, "deployment-1", claims.DeploymentID)
+	assert.Equal(t, launched.Message.Roles, claims.Roles)
+	assert.Equal(t, launched.ID, claims.LaunchID)
+	assert.Equal(t, int64(15*60), claims.ExpiresAt-claims.IssuedAt)
+}
+
+func TestSessionTokenHandler(t *testing.T) {
+	keySet := keySetServer(t)
+	defer keySet.Close()
+	ltis := sessionTokenService(t, keySet.URL)
+	ltis.SetLaunchStore(NewMemoryLaunchStore(0))
+	launched := sessionTokenLaunch(t, ltis)
+
+	var seen *Launch
+	handler := ltis.SessionTokenHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		seen, _ = LaunchFromContext(req.Context())
+	}))
+	call := func(authorization string) int {
+		seen = nil
+		req := httptest.NewRequest("GET", "/api/scores", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, call("Bearer "+launched.SessionToken))
+	if assert.NotNil(t, seen) {
+		assert.Equal(t, launched.ID, seen.ID)
+		assert.Equal(t, "deployment-1", seen.Message.DeploymentID)
+		assert.NotNil(t, seen.AGS, "the stored launch keeps its services")
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, call(""))
+	assert.Equal(t, http.StatusUnauthorized, call("Bearer not-a-token"))
+	assert.Equal(t, http.StatusUnauthorized, call("Bearer "+launched.SessionToken+"x"))
+	assert.Nil(t, seen)
+
+	deepLink, err := ltis.createJWT(map[string]interface{}{
+		"iss": testClientID,
+		"aud": testIssuer,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, call("Bearer "+string(deepLink)), "other tool JWTs are not session tokens")
+
+	ltis.Clock.Now = func() time.Time { return time.Now().Add(time.Hour) }
+	assert.Equal(t, http.StatusUnauthorized, call("Bearer "+launched.SessionToken), "expired tokens are rejected")
+}
+
+func TestSessionTokenOtherKey(t *testing.T) {
+	keySet := keySetServer(t)
+	defer keySet.Close()
+	launched := sessionTokenLaunch(t, sessionTokenService(t, keySet.URL))
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	other := sessionTokenService(t, keySet.URL)
+	other.SetSigningKeyFunc(func() (jwa.SignatureAlgorithm, interface{}, error) {
+		return jwa.RS256, otherKey, nil
+	})
+	_, err = other.ParseSessionToken(launched.SessionToken)
+	assert.Error(t, err)
+}
+
+func TestGinSessionTokenHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keySet := keySetServer(t)
+	defer keySet.Close()
+	ltis := sessionTokenService(t, keySet.URL)
+	launched := sessionTokenLaunch(t, ltis)
+	assert.Empty(t, launched.ID, "no launch store is configured")
+
+	router := gin.New()
+	router.Use(ltis.GinSessionTokenHandler())
+	var seen *Launch
+	router.GET("/api/me", func(c *gin.Context) {
+		seen, _ = LaunchFromContext(c.Request.Context())
+	})
+
+	req := httptest.NewRequest("GET", "/api/me", nil)
+	req.Header.Set("Authorization", "Bearer "+launched.SessionToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	if assert.NotNil(t, seen, "without a launch store the launch is rebuilt from the token") {
+		assert.Equal(t, *launched.Message.Sub, *seen.Message.Sub)
+		assert.Equal(t, launched.Message.Context, seen.Message.Context)
+		assert.Equal(t, "deployment-1", seen.Deployment.DeploymentID)
+		assert.Nil(t, seen.AGS)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/me", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestSessionTokenOutlivesMaxAge(t *testing.T) {
+	keySet := keySetServer(t)
+	defer keySet.Close()
+	ltis := sessionTokenService(t, keySet.URL)
+	ltis.SetClockPolicy(ClockPolicy{Leeway: DefaultClockLeeway, MaxAge: time.Minute})
+	launched := sessionTokenLaunch(t, ltis)
+
+	ltis.Clock.Now = func() time.Time { return time.Now().Add(10 * time.Minute) }
+	_, err := ltis.ParseSessionToken(launched.SessionToken)
+	assert.NoError(t, err, "MaxAge applies to id_tokens, not to session tokens")
+
+	ltis.Clock.Now = func() time.Time { return time.Now().Add(16 * time.Minute) }
+	_, err = ltis.ParseSessionToken(launched.SessionToken)
+	assert.Error(t, err, "session tokens expire after SessionTokenTTL")
+}
@@ -0,0 +1,276 @@
+package ltiservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/sessions"
+	"github.com/pkg/errors"
+)
+
+// DefaultStateTTL how long a login's state stays valid in a state store when no other TTL is given
+const DefaultStateTTL = 10 * time.Minute
+
+// StateMode how the launch step checks that the OIDC state comes from a login of this tool
+type StateMode int
+
+// State modes, see Config.StateMode
+const (
+	// StateModeInherit the zero mode: a registration uses the mode of LTIService.Config, which uses StateModeCookie
+	StateModeInherit StateMode = iota
+	// StateModeCookie checks the state cookies; when cookies are blocked and there is a state store, the platform's
+	// postMessage storage is used together with it, or the error page offers to post the launch again in a new window
+	StateModeCookie
+	// StateModeCookieAndStore requires both the state cookies and the state store to match
+	StateModeCookieAndStore
+	// StateModeCookieOrStore accepts a match in the state store, falling back to the state cookies only when the store
+	// has no record of the state
+	StateModeCookieOrStore
+	// StateModeStore checks only the state store; no state cookies are set
+	StateModeStore
+)
+
+// StateRecord what the login step stores about an OIDC state, for the launch step to check
+type StateRecord struct {
+	State         string    `json:"state"`
+	Nonce         string    `json:"nonce"`
+	Issuer        string    `json:"iss"`
+	ClientID      string    `json:"client_id"`
+	DeploymentID  string    `json:"deployment_id,omitempty"`
+	TargetLinkURI string    `json:"target_link_uri,omitempty"`
+	Created       time.Time `json:"created"`
+}
+
+// StateStore keeps the state of logins server-side until their launch arrives
+// Records are single use: TakeState removes the record it returns.
+type StateStore interface {
+	// SaveState stores the record under its state
+	SaveState(w http.ResponseWriter, req *http.Request, record StateRecord) error
+	// TakeState removes and returns the record of the state, or nil (with no error) if it is unknown or expired
+	TakeState(w http.ResponseWriter, req *http.Request, state string) (*StateRecord, error)
+}
+
+// SetStateStore Define the store used to bind the OIDC state server-side, see Config.StateMode
+// Once a store is set, every login saves its state there, whatever the mode of the registration.
+func (ltis *LTIService) SetStateStore(store StateStore) {
+	ltis.States = store
+}
+
+// stateMode returns the state mode of the service's registration, StateModeCookie unless one is configured
+func (ltis *LTIService) stateMode() StateMode {
+	if ltis.Config.StateMode == StateModeInherit {
+		return StateModeCookie
+	}
+	return ltis.Config.StateMode
+}
+
+// saveLoginState stores the state of a login in the state store, if there is one
+func (ltis *LTIService) saveLoginState(w http.ResponseWriter, req *http.Request, state, nonce string) error {
+	if ltis.States == nil {
+		if ltis.stateMode() != StateModeCookie {
+			return fmt.Errorf("State mode requires a state store, but none is configured")
+		}
+		return nil
+	}
+	return ltis.States.SaveState(w, req, StateRecord{
+		State:         state,
+		Nonce:         nonce,
+		Issuer:        req.FormValue("iss"),
+		ClientID:      ltis.Config.ClientID,
+		DeploymentID:  req.FormValue("lti_deployment_id"),
+		TargetLinkURI: req.FormValue("target_link_uri"),
+		Created:       time.Now(),
+	})
+}
+
+// validateStoredState takes the state of the launch from the state store and checks it against the token claims
+func (ltis *LTIService) validateStoredState(w http.ResponseWriter, req *http.Request, claims jwt.MapClaims) error {
+	record, err := ltis.takeStoredState(w, req)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return fmt.Errorf("State %q is unknown, expired or already used", req.FormValue("state"))
+	}
+	return validateStateRecord(record, claims)
+}
+
+// takeStoredState takes the state of the launch from the state store, returning nil if the store has no record of it
+func (ltis *LTIService) takeStoredState(w http.ResponseWriter, req *http.Request) (*StateRecord, error) {
+	if ltis.States == nil {
+		return nil, newLaunchError(ErrCodeInternal, fmt.Errorf("State mode requires a state store, but none is configured"))
+	}
+	state := req.FormValue("state")
+	if state == "" {
+		return nil, fmt.Errorf("Required state not found")
+	}
+
+	record, err := ltis.States.TakeState(w, req, state)
+	if err != nil {
+		return nil, newLaunchError(ErrCodeInternal, errors.Wrapf(err, "Failed looking up state %q", state))
+	}
+	return record, nil
+}
+
+// validateStateRecord checks the state store's record of a login against the token claims of its launch
+func validateStateRecord(record *StateRecord, claims jwt.MapClaims) error {
+	state := record.State
+	if iss, _ := claims["iss"].(string); iss != record.Issuer {
+		return fmt.Errorf("State %q was issued for issuer %q, not %q", state, record.Issuer, iss)
+	}
+	aud, err := audiences(claims)
+	if err != nil {
+		return err
+	}
+	if !containsString(aud, record.ClientID) {
+		return fmt.Errorf("State %q was issued for client ID %q", state, record.ClientID)
+	}
+	if deploymentID, _ := claims["https://purl.imsglobal.org/spec/lti/claim/deployment_id"].(string); record.DeploymentID != "" && deploymentID != record.DeploymentID {
+		return fmt.Errorf("State %q was issued for deployment %q, not %q", state, record.DeploymentID, deploymentID)
+	}
+	if nonce, _ := claims["nonce"].(string); nonce != record.Nonce {
+		return fmt.Errorf("Nonce does not match the login of state %q", state)
+	}
+	if record.TargetLinkURI != "" {
+		if err := matchTargetLinkURI(claims, record.TargetLinkURI); err != nil {
+			return newLaunchError(ErrCodeTargetMismatch, err)
+		}
+	}
+	return nil
+}
+
+func stateTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return DefaultStateTTL
+	}
+	return ttl
+}
+
+// MemoryStateStore a StateStore that keeps login states in memory
+// It only works when logins and launches reach the same process.
+type MemoryStateStore struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	now    func() time.Time
+	states map[string]StateRecord
+}
+
+// NewMemoryStateStore Returns a MemoryStateStore whose states expire after the TTL, or DefaultStateTTL if zero
+func NewMemoryStateStore(ttl time.Duration) *MemoryStateStore {
+	return &MemoryStateStore{ttl: stateTTL(ttl), now: time.Now, states: map[string]StateRecord{}}
+}
+
+// SaveState stores the record under its state, dropping expired records
+func (s *MemoryStateStore) SaveState(w http.ResponseWriter, req *http.Request, record StateRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for state, existing := range s.states {
+		if now.Sub(existing.Created) > s.ttl {
+			delete(s.states, state)
+		}
+	}
+	s.states[record.State] = record
+	return nil
+}
+
+// TakeState removes and returns the record of the state, or nil if it is unknown or expired
+func (s *MemoryStateStore) TakeState(w http.ResponseWriter, req *http.Request, state string) (*StateRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.states[state]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.states, state)
+	if s.now().Sub(record.Created) > s.ttl {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+// SessionStateStore a StateStore that keeps login states in a gorilla session, such as LTIService.Store
+// The session must be shared by the login and launch requests, so a cookie based session store carries the same
+// third-party cookie limitations as the state cookies.
+type SessionStateStore struct {
+	store sessions.Store
+	name  string
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+// NewSessionStateStore Returns a SessionStateStore using the named session of the store, whose states expire after
+// the TTL, or DefaultStateTTL if zero
+func NewSessionStateStore(store sessions.Store, sessionName string, ttl time.Duration) *SessionStateStore {
+	return &SessionStateStore{store: store, name: sessionName, ttl: stateTTL(ttl), now: time.Now}
+}
+
+// SaveState stores the record in the session, dropping expired records
+func (s *SessionStateStore) SaveState(w http.ResponseWriter, req *http.Request, record StateRecord) error {
+	sess, err := s.store.Get(req, s.name)
+	if err != nil {
+		return errors.Wrapf(err, "Failed loading session %q", s.name)
+	}
+
+	now := s.now()
+	for key, value := range sess.Values {
+		if name, ok := key.(string); !ok || !strings.HasPrefix(name, stateSessionPrefix) {
+			continue
+		}
+		if existing, ok := s.decode(value); ok && now.Sub(existing.Created) > s.ttl {
+			delete(sess.Values, key)
+		}
+	}
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "Failed to serialize state record")
+	}
+	sess.Values[stateSessionKey(record.State)] = string(encoded)
+	return sess.Save(req, w)
+}
+
+// TakeState removes and returns the record of the state from the session, or nil if it is unknown or expired
+func (s *SessionStateStore) TakeState(w http.ResponseWriter, req *http.Request, state string) (*StateRecord, error) {
+	sess, err := s.store.Get(req, s.name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed loading session %q", s.name)
+	}
+
+	key := stateSessionKey(state)
+	value, ok := sess.Values[key]
+	if !ok {
+		return nil, nil
+	}
+	delete(sess.Values, key)
+	if err := sess.Save(req, w); err != nil {
+		return nil, errors.Wrapf(err, "Failed saving session %q", s.name)
+	}
+
+	record, ok := s.decode(value)
+	if !ok || record.State != state || s.now().Sub(record.Created) > s.ttl {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+func (s *SessionStateStore) decode(value interface{}) (StateRecord, bool) {
+	record := StateRecord{}
+	encoded, ok := value.(string)
+	if !ok {
+		return record, false
+	}
+	return record, json.Unmarshal([]byte(encoded), &record) == nil
+}
+
+const stateSessionPrefix = "lti_state_"
+
+func stateSessionKey(state string) string {
+	return stateSessionPrefix + state
+}
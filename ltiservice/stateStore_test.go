@@ -0,0 +1,240 @@
+package ltiservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testStateRecord(created time.Time) StateRecord {
+	return StateRecord{
+		State:         "state-fuzz",
+		Nonce:         "nonce-fuzz",
+		Issuer:        testIssuer,
+		ClientID:      testClientID,
+		TargetLinkURI: "https://tool.example.com/launch",
+		Created:       created,
+	}
+}
+
+func TestMemoryStateStore(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStateStore(time.Minute)
+	store.now = func() time.Time { return now }
+
+	assert.NoError(t, store.SaveState(nil, nil, testStateRecord(now)))
+	record, err := store.TakeState(nil, nil, "state-fuzz")
+	assert.NoError(t, err)
+	if assert.NotNil(t, record) {
+		assert.Equal(t, "nonce-fuzz", record.Nonce)
+	}
+
+	record, err = store.TakeState(nil, nil, "state-fuzz")
+	assert.NoError(t, err)
+	assert.Nil(t, record, "states are single use")
+
+	assert.NoError(t, store.SaveState(nil, nil, testStateRecord(now.Add(-2*time.Minute))))
+	record, err = store.TakeState(nil, nil, "state-fuzz")
+	assert.NoError(t, err)
+	assert.Nil(t, record, "expired states are not returned")
+}
+
+func TestSessionStateStore(t *testing.T) {
+	store := NewSessionStateStore(sessions.NewCookieStore([]byte("test-session-key")), "lti", time.Minute)
+
+	w := httptest.NewRecorder()
+	assert.NoError(t, store.SaveState(w, httptest.NewRequest("GET", "/login", nil), testStateRecord(time.Now())))
+
+	take := func(cookies []*http.Cookie) (*StateRecord, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest("POST", "/launch", nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		record, err := store.TakeState(w, req, "state-fuzz")
+		assert.NoError(t, err)
+		return record, w
+	}
+
+	record, w := take(w.Result().Cookies())
+	if assert.NotNil(t, record) {
+		assert.Equal(t, testIssuer, record.Issuer)
+	}
+	record, _ = take(w.Result().Cookies())
+	assert.Nil(t, record, "states are single use")
+}
+
+func TestLaunchStateModes(t *testing.T) {
+	keySet := keySetServer(t)
+	defer keySet.Close()
+	idToken := signRawPayload(t, validLaunchPayload())
+
+	tests := []struct {
+		name     string
+		mode     StateMode
+		cookie   bool
+		stored   bool
+		accepted bool
+	}{
+		{"default with cookie", StateModeInherit, true, false, true},
+		{"default with store", StateModeInherit, false, true, false},
+		{"cookie with cookie", StateModeCookie, true, false, true},
+		{"cookie with store", StateModeCookie, false, true, false},
+		{"both with both", StateModeCookieAndStore, true, true, true},
+		{"both with cookie", StateModeCookieAndStore, true, false, false},
+		{"both with store", StateModeCookieAndStore, false, true, false},
+		{"either with cookie", StateModeCookieOrStore, true, false, true},
+		{"either with store", StateModeCookieOrStore, false, true, true},
+		{"either with neither", StateModeCookieOrStore, false, false, false},
+		{"store with store", StateModeStore, false, true, true},
+		{"store with cookie", StateModeStore, true, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ltis := NewLTIService(nil, Config{
+				PlatformIssuer: testIssuer,
+				ClientID:       testClientID,
+				KeySetURL:      keySet.URL,
+				StateMode:      test.mode,
+			})
+			store := NewMemoryStateStore(0)
+			ltis.SetStateStore(store)
+			if test.stored {
+				assert.NoError(t, store.SaveState(nil, nil, testStateRecord(time.Now())))
+			}
+
+			form := url.Values{}
+			form.Set("id_token", idToken)
+			form.Set("state", "state-fuzz")
+			req := httptest.NewRequest("POST", "/launch", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if test.cookie {
+				req.AddCookie(&http.Cookie{Name: "mzdevinc_lti_go_state-fuzz", Value: "state-fuzz"})
+			}
+
+			called := false
+			w := httptest.NewRecorder()
+			ltis.GetLaunchContextHandler(func(*Launch) { called = true }).ServeHTTP(w, req)
+			assert.Equal(t, test.accepted, called, "%d %s", w.Code, w.Body.String())
+		})
+	}
+}
+
+func TestCookieOrStoreRejectsMismatchedRecord(t *testing.T) {
+	keySet := keySetServer(t)
+	defer keySet.Close()
+	ltis := NewLTIService(nil, Config{
+		PlatformIssuer: testIssuer,
+		ClientID:       testClientID,
+		KeySetURL:      keySet.URL,
+		StateMode:      StateModeCookieOrStore,
+	})
+	ltis.SetStateStore(NewMemoryStateStore(0))
+	record := testStateRecord(time.Now())
+	record.Nonce = "nonce-of-another-login"
+	require.NoError(t, ltis.States.SaveState(nil, nil, record))
+
+	var reported *LaunchError
+	ltis.SetErrorReporter(func(_ *http.Request, err *LaunchError) {
+		reported = err
+	})
+	called := false
+	w := httptest.NewRecorder()
+	ltis.GetLaunchContextHandler(func(*Launch) { called = true }).ServeHTTP(w, launchRequest(signRawPayload(t, validLaunchPayload())))
+	assert.False(t, called, "valid state cookies do not override a stored record that does not match")
+	if assert.NotNil(t, reported) {
+		assert.Equal(t, ErrCodeStateMismatch, reported.Code)
+	}
+}
+
+func TestRegistrationStateMode(t *testing.T) {
+	keySet := keySetServer(t)
+	defer keySet.Close()
+	ltis := NewLTIService(nil, Config{StateMode: StateModeStore})
+	ltis.SetStateStore(NewMemoryStateStore(0))
+	ltis.SetRegistrationStore(NewMemoryRegistrationStore(
+		Config{PlatformIssuer: testIssuer, ClientID: testClientID, KeySetURL: keySet.URL, StateMode: StateModeCookie},
+		Config{PlatformIssuer: "https://other.example.com", ClientID: "client-b"},
+	))
+
+	svc, err := ltis.findRegistration("https://other.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, StateModeStore, svc.stateMode(), "registrations without a mode inherit the service's")
+	svc, err = ltis.findRegistration(testIssuer)
+	require.NoError(t, err)
+	assert.Equal(t, StateModeCookie, svc.stateMode(), "registrations can choose cookie mode")
+
+	called := false
+	w := httptest.NewRecorder()
+	ltis.GetLaunchContextHandler(func(*Launch) { called = true }).ServeHTTP(w, launchRequest(signRawPayload(t, validLaunchPayload())))
+	assert.True(t, called, "the state cookie is enough for a cookie mode registration: %d %s", w.Code, w.Body.String())
+}
+
+func TestStoredStateMustMatchToken(t *testing.T) {
+	ltis := testService()
+	ltis.SetStateStore(NewMemoryStateStore(0))
+	claims := baseClaims()
+	claims["nonce"] = "nonce-fuzz"
+	claims["https://purl.imsglobal.org/spec/lti/claim/target_link_uri"] = "https://tool.example.com/launch"
+
+	check := func(modify func(*StateRecord)) error {
+		record := testStateRecord(time.Now())
+		modify(&record)
+		assert.NoError(t, ltis.States.SaveState(nil, nil, record))
+		req := httptest.NewRequest("POST", "/launch", strings.NewReader("state=state-fuzz"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return ltis.validateStoredState(httptest.NewRecorder(), req, claims)
+	}
+
+	assert.NoError(t, check(func(*StateRecord) {}))
+	assert.Error(t, check(func(r *StateRecord) { r.Nonce = "other" }))
+	assert.Error(t, check(func(r *StateRecord) { r.Issuer = "https://other.example.com" }))
+	assert.Error(t, check(func(r *StateRecord) { r.ClientID = "other-client" }))
+	assert.Error(t, check(func(r *StateRecord) { r.TargetLinkURI = "https://tool.example.com/other" }))
+	assert.Error(t, check(func(r *StateRecord) { r.DeploymentID = "other-deployment" }))
+}
+
+func TestLoginSavesState(t *testing.T) {
+	ltis := NewLTIService(nil, Config{
+		PlatformIssuer: testIssuer,
+		ClientID:       testClientID,
+		AuthLoginURL:   "https://platform.example.com/auth",
+		LaunchURL:      "https://tool.example.com/launch",
+		StateMode:      StateModeStore,
+	})
+	store := NewMemoryStateStore(0)
+	ltis.SetStateStore(store)
+
+	query := url.Values{}
+	query.Set("iss", testIssuer)
+	query.Set("login_hint", "user-1")
+	query.Set("target_link_uri", "https://tool.example.com/quiz")
+	w := httptest.NewRecorder()
+	ltis.GetLoginHandler().ServeHTTP(w, httptest.NewRequest("GET", "/login?"+query.Encode(), nil))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Empty(t, w.Result().Cookies(), "no state cookies are set in store mode")
+	redirect, err := url.Parse(w.Header().Get("Location"))
+	assert.NoError(t, err)
+	record, err := store.TakeState(nil, nil, redirect.Query().Get("state"))
+	assert.NoError(t, err)
+	if assert.NotNil(t, record) {
+		assert.Equal(t, redirect.Query().Get("nonce"), record.Nonce)
+		assert.Equal(t, testIssuer, record.Issuer)
+		assert.Equal(t, testClientID, record.ClientID)
+		assert.Equal(t, "https://tool.example.com/quiz", record.TargetLinkURI)
+	}
+
+	ltis.SetStateStore(nil)
+	w = httptest.NewRecorder()
+	ltis.GetLoginHandler().ServeHTTP(w, httptest.NewRequest("GET", "/login?"+query.Encode(), nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code, "store mode requires a store")
+}
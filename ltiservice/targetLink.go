@@ -0,0 +1,118 @@
+package ltiservice
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/MZDevinc/go-lti/lti"
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// redirectURIs returns the launch URLs registered for the configuration, LaunchURL first
+func (c Config) redirectURIs() []string {
+	var uris []string
+	for _, uri := range append([]string{c.LaunchURL}, c.RedirectURIs...) {
+		if uri != "" && !containsString(uris, uri) {
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
+
+// AllowsTargetLinkURI reports whether launches may target the URL
+// The URL must start with one of Config.TargetLinkURIs or, when that list is empty, be on the origin of one of the
+// redirect URIs. Anything else could turn the login into an open redirect. A configuration without any launch URL
+// allows every http(s) URL.
+func (c Config) AllowsTargetLinkURI(target string) bool {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil {
+		return false
+	}
+
+	if len(c.TargetLinkURIs) == 0 {
+		uris := c.redirectURIs()
+		if len(uris) == 0 {
+			// Nothing to compare with; the login step refuses to run without a LaunchURL anyway
+			return true
+		}
+		for _, uri := range uris {
+			if sameOrigin(uri, target) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, allowed := range c.TargetLinkURIs {
+		if target == allowed || (sameOrigin(allowed, target) && strings.HasSuffix(allowed, "/") && strings.HasPrefix(path.Clean("/"+u.Path)+"/", pathOf(allowed))) {
+			return true
+		}
+	}
+	return false
+}
+
+func pathOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
+
+// loginRedirectURI returns the redirect_uri for a login to the target link URI
+// A target that is itself a registered redirect URI receives the launch directly; other targets are launched through
+// LaunchURL.
+func (ltis *LTIService) loginRedirectURI(target string) string {
+	uris := ltis.Config.redirectURIs()
+	if target != "" && containsString(uris, target) {
+		return target
+	}
+	return uris[0]
+}
+
+// setTargetCookie remembers the target link URI requested by the login of the state, for the launch to check
+func setTargetCookie(w http.ResponseWriter, state, target string) {
+	secs := 3600
+	http.SetCookie(w, &http.Cookie{
+		Name:     fmt.Sprintf("mzdevinc_lti_go_target_%s", state),
+		Value:    url.QueryEscape(target),
+		Expires:  time.Now().Add(time.Second * time.Duration(secs)),
+		MaxAge:   secs,
+		SameSite: http.SameSiteNoneMode,
+		Secure:   true,
+	})
+}
+
+// validateTargetCookie checks the target_link_uri claim against the target the login of the state asked for, if the
+// login set a target cookie
+func validateTargetCookie(req *http.Request, claims jwt.MapClaims) error {
+	cookie, err := req.Cookie(fmt.Sprintf("mzdevinc_lti_go_target_%s", req.FormValue("state")))
+	if err != nil {
+		return nil
+	}
+	expected, err := url.QueryUnescape(cookie.Value)
+	if err != nil {
+		return fmt.Errorf("Malformed target link URI cookie")
+	}
+	return matchTargetLinkURI(claims, expected)
+}
+
+// matchTargetLinkURI checks that the target_link_uri claim is the target the login asked for
+func matchTargetLinkURI(claims jwt.MapClaims, expected string) error {
+	target, _ := claims["https://purl.imsglobal.org/spec/lti/claim/target_link_uri"].(string)
+	if target != expected {
+		return fmt.Errorf("Target link URI %q does not match %q from the login", target, expected)
+	}
+	return nil
+}
+
+// validateTargetLinkURI checks that the launch targets a URL the registration allows
+func (ltis *LTIService) validateTargetLinkURI(msg lti.LaunchMessage) error {
+	if msg.TargetLinkURI != "" && !ltis.Config.AllowsTargetLinkURI(msg.TargetLinkURI) {
+		return fmt.Errorf("Target link URI %q is not allowed", msg.TargetLinkURI)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package ltiservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowsTargetLinkURI(t *testing.T) {
+	byOrigin := Config{
+		LaunchURL:    "https://tool.example.com/launch",
+		RedirectURIs: []string{"https://other.example.com/launch"},
+	}
+	byList := Config{
+		LaunchURL:      "https://tool.example.com/launch",
+		TargetLinkURIs: []string{"https://tool.example.com/courses/", "https://tool.example.com/home"},
+	}
+
+	tests := []struct {
+		config  Config
+		target  string
+		allowed bool
+	}{
+		{byOrigin, "https://tool.example.com/quiz/1", true},
+		{byOrigin, "https://other.example.com/", true},
+		{byOrigin, "https://evil.example.com/quiz/1", false},
+		{byOrigin, "http://tool.example.com/quiz/1", false},
+		{byOrigin, "https://user@tool.example.com/", false},
+		{byOrigin, "javascript:alert(1)", false},
+		{byOrigin, "/quiz/1", false},
+		{byList, "https://tool.example.com/courses/7", true},
+		{byList, "https://tool.example.com/courses/", true},
+		{byList, "https://tool.example.com/home", true},
+		{byList, "https://tool.example.com/home/more", false},
+		{byList, "https://tool.example.com/courses/../admin", false},
+		{byList, "https://tool.example.com/admin", false},
+		{Config{}, "https://anywhere.example.com/", true},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.allowed, test.config.AllowsTargetLinkURI(test.target), test.target)
+	}
+}
+
+func TestLoginTargetLinkURI(t *testing.T) {
+	ltis := NewLTIService(nil, Config{
+		PlatformIssuer: testIssuer,
+		ClientID:       testClientID,
+		AuthLoginURL:   "https://platform.example.com/auth",
+		LaunchURL:      "https://tool.example.com/launch",
+		RedirectURIs:   []string{"https://tool.example.com/deep-link"},
+	})
+
+	login := func(target string) *httptest.ResponseRecorder {
+		query := url.Values{}
+		query.Set("iss", testIssuer)
+		query.Set("login_hint", "user-1")
+		query.Set("target_link_uri", target)
+		w := httptest.NewRecorder()
+		ltis.GetLoginHandler().ServeHTTP(w, httptest.NewRequest("GET", "/login?"+query.Encode(), nil))
+		return w
+	}
+	redirectURI := func(w *httptest.ResponseRecorder) string {
+		location, err := url.Parse(w.Header().Get("Location"))
+		assert.NoError(t, err)
+		return location.Query().Get("redirect_uri")
+	}
+
+	w := login("https://tool.example.com/quiz/1")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://tool.example.com/launch", redirectURI(w))
+	var targetCookie *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if strings.HasPrefix(cookie.Name, "mzdevinc_lti_go_target_") {
+			targetCookie = cookie
+		}
+	}
+	if assert.NotNil(t, targetCookie, "the requested target is kept with the state") {
+		assert.Equal(t, url.QueryEscape("https://tool.example.com/quiz/1"), targetCookie.Value)
+	}
+
+	w = login("https://tool.example.com/deep-link")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://tool.example.com/deep-link", redirectURI(w))
+
+	w = login("https://evil.example.com/phish")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "target_link_uri")
+}
+
+func TestLaunchTargetLinkURI(t *testing.T) {
+	keySet := keySetServer(t)
+	defer keySet.Close()
+	idToken := signRawPayload(t, validLaunchPayload())
+
+	launch := func(config Config, target string) (bool, *httptest.ResponseRecorder) {
+		ltis := NewLTIService(nil, config)
+		req := launchRequest(idToken)
+		if target != "" {
+			req.AddCookie(&http.Cookie{Name: "mzdevinc_lti_go_target_state-fuzz", Value: url.QueryEscape(target)})
+		}
+		called := false
+		w := httptest.NewRecorder()
+		ltis.GetLaunchContextHandler(func(*Launch) { called = true }).ServeHTTP(w, req)
+		return called, w
+	}
+	config := Config{
+		PlatformIssuer: testIssuer,
+		ClientID:       testClientID,
+		KeySetURL:      keySet.URL,
+		LaunchURL:      "https://tool.example.com/launch",
+	}
+
+	called, w := launch(config, "https://tool.example.com/launch")
+	assert.True(t, called, "%d %s", w.Code, w.Body.String())
+
+	called, w = launch(config, "https://tool.example.com/other")
+	assert.False(t, called)
+	assert.Contains(t, w.Body.String(), string(ErrCodeTargetMismatch))
+
+	config.LaunchURL = "https://elsewhere.example.com/launch"
+	called, w = launch(config, "")
+	assert.False(t, called, "the target must be allowed by the registration")
+	assert.Contains(t, w.Body.String(), string(ErrCodeTargetMismatch))
+}
@@ -0,0 +1,312 @@
+package ltiservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/MZDevinc/go-lti/lti"
+)
+
+// Tool configuration formats served by GetToolConfigurationHandler
+const (
+	ToolConfigurationIMS        = "ims"
+	ToolConfigurationCanvas     = "canvas"
+	ToolConfigurationMoodle     = "moodle"
+	ToolConfigurationBlackboard = "blackboard"
+)
+
+// ConfigField a setting, as labelled in a platform's tool registration form
+type ConfigField struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// BuildToolConfiguration returns the tool configuration completed from the service
+// Settings the tool configuration leaves empty are taken from Config, and every route described with DescribeRoute
+// adds its messages, targeting the route on the host of the default target link URI.
+func (ltis *LTIService) BuildToolConfiguration(tool ToolConfiguration) ToolConfiguration {
+	tool = tool.withDefaults(ltis.Config)
+
+	messages := append([]ToolMessage{}, tool.Messages...)
+	for _, route := range ltis.routes {
+		for _, msg := range route.Messages {
+			if msg.TargetLinkURI == "" {
+				target, _ := route.pattern.target()
+				msg.TargetLinkURI = routeURL(tool.TargetLinkURI, target)
+			}
+			messages = append(messages, msg)
+		}
+	}
+	if len(messages) > 0 {
+		tool.Messages = messages
+	}
+	return tool
+}
+
+// routeURL returns the URL of the route target, a path with an optional query, on the origin of base
+func routeURL(base, target string) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return target
+	}
+	path, query := target, ""
+	if i := strings.Index(target, "?"); i >= 0 {
+		path, query = target[:i], target[i+1:]
+	}
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/" + strings.TrimPrefix(path, "/"), RawQuery: query}).String()
+}
+
+// CanvasDeveloperKey the JSON configuration of a Canvas LTI developer key
+// See https://canvas.instructure.com/doc/api/file.lti_dev_key_config.html
+type CanvasDeveloperKey struct {
+	Title             string            `json:"title"`
+	Description       string            `json:"description"`
+	OIDCInitiationURL string            `json:"oidc_initiation_url"`
+	TargetLinkURI     string            `json:"target_link_uri"`
+	PublicJWKURL      string            `json:"public_jwk_url"`
+	Scopes            []string          `json:"scopes"`
+	Extensions        []CanvasExtension `json:"extensions"`
+	CustomFields      map[string]string `json:"custom_fields,omitempty"`
+}
+
+// CanvasExtension the Canvas specific settings of a developer key
+type CanvasExtension struct {
+	Domain       string         `json:"domain"`
+	Platform     string         `json:"platform"`
+	PrivacyLevel string         `json:"privacy_level"`
+	Settings     CanvasSettings `json:"settings"`
+}
+
+// CanvasSettings the placements of a developer key
+type CanvasSettings struct {
+	Text       string            `json:"text"`
+	IconURL    string            `json:"icon_url,omitempty"`
+	Placements []CanvasPlacement `json:"placements"`
+}
+
+// CanvasPlacement where Canvas offers a launch of the tool
+type CanvasPlacement struct {
+	Placement     string            `json:"placement"`
+	MessageType   string            `json:"message_type"`
+	TargetLinkURI string            `json:"target_link_uri,omitempty"`
+	Text          string            `json:"text,omitempty"`
+	IconURL       string            `json:"icon_url,omitempty"`
+	CustomFields  map[string]string `json:"custom_fields,omitempty"`
+}
+
+// CanvasDeveloperKey returns the configuration to paste into a Canvas developer key
+// Each placement of each message becomes a Canvas placement, so placements must use Canvas names such as
+// "course_navigation" or "assignment_selection".
+func (tc ToolConfiguration) CanvasDeveloperKey() CanvasDeveloperKey {
+	placements := []CanvasPlacement{}
+	for _, msg := range tc.Messages {
+		for _, placement := range msg.Placements {
+			placements = append(placements, CanvasPlacement{
+				Placement:     placement,
+				MessageType:   msg.Type,
+				TargetLinkURI: msg.TargetLinkURI,
+				Text:          msg.Label,
+				IconURL:       msg.IconURI,
+				CustomFields:  msg.CustomParameters,
+			})
+		}
+	}
+	scopes := tc.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	return CanvasDeveloperKey{
+		Title:             tc.ClientName,
+		Description:       tc.Description,
+		OIDCInitiationURL: tc.InitiateLoginURI,
+		TargetLinkURI:     tc.TargetLinkURI,
+		PublicJWKURL:      tc.JWKSURI,
+		Scopes:            scopes,
+		Extensions: []CanvasExtension{{
+			Domain:       tc.Domain,
+			Platform:     "canvas.instructure.com",
+			PrivacyLevel: tc.canvasPrivacyLevel(),
+			Settings: CanvasSettings{
+				Text:       tc.ClientName,
+				IconURL:    tc.LogoURI,
+				Placements: placements,
+			},
+		}},
+		CustomFields: tc.CustomParameters,
+	}
+}
+
+func (tc ToolConfiguration) canvasPrivacyLevel() string {
+	name, email := tc.wantsClaim("name"), tc.wantsClaim("email")
+	switch {
+	case name && email:
+		return "public"
+	case name:
+		return "name_only"
+	case email:
+		return "email_only"
+	default:
+		return "anonymous"
+	}
+}
+
+// MoodleFields returns the settings to enter when manually configuring the tool in Moodle
+func (tc ToolConfiguration) MoodleFields() []ConfigField {
+	deepLinking := tc.message(lti.MessageTypeDeepLinking)
+
+	ags := "Do not use this service"
+	if tc.wantsScope(lti.ScopeLineItem) {
+		ags = "Use this service for grade sync and column management"
+	} else if tc.wantsScope(lti.ScopeScore) {
+		ags = "Use this service for grade sync only"
+	}
+	nrps := "Do not use this service"
+	if tc.wantsScope(lti.ScopeContextMembershipReadonly) {
+		nrps = "Use this service to retrieve members' information as per privacy settings"
+	}
+
+	fields := []ConfigField{
+		{"Tool name", tc.ClientName},
+		{"Tool URL", tc.TargetLinkURI},
+		{"Tool description", tc.Description},
+		{"LTI version", "LTI 1.3"},
+		{"Public key type", "Keyset URL"},
+		{"Public keyset", tc.JWKSURI},
+		{"Initiate login URL", tc.InitiateLoginURI},
+		{"Redirection URI(s)", strings.Join(tc.RedirectURIs, "\n")},
+		{"Custom parameters", customParameterLines(tc.CustomParameters)},
+		{"Icon URL", tc.LogoURI},
+		{"Supports Deep Linking (Content-Item Message)", yesNo(deepLinking != nil)},
+	}
+	if deepLinking != nil {
+		fields = append(fields, ConfigField{"Content Selection URL", deepLinking.TargetLinkURI})
+	}
+	return append(fields,
+		ConfigField{"IMS LTI Assignment and Grade Services", ags},
+		ConfigField{"IMS LTI Names and Role Provisioning", nrps},
+		ConfigField{"Share launcher's name with tool", alwaysNever(tc.wantsClaim("name"))},
+		ConfigField{"Share launcher's email with tool", alwaysNever(tc.wantsClaim("email"))},
+	)
+}
+
+// BlackboardFields returns the settings to enter when registering the tool in the Blackboard developer portal and
+// configuring its placements in Blackboard Learn
+func (tc ToolConfiguration) BlackboardFields() []ConfigField {
+	domains := []string{tc.Domain}
+	for _, msg := range tc.Messages {
+		if u, err := url.Parse(msg.TargetLinkURI); err == nil && u.Host != "" && !containsString(domains, u.Host) {
+			domains = append(domains, u.Host)
+		}
+	}
+
+	fields := []ConfigField{
+		{"Application Name", tc.ClientName},
+		{"Description", tc.Description},
+		{"Domain(s)", strings.Join(domains, ",")},
+		{"Login Initiation URL", tc.InitiateLoginURI},
+		{"Tool Redirect URL(s)", strings.Join(tc.RedirectURIs, ",")},
+		{"Tool JWKS URL", tc.JWKSURI},
+		{"Signing Algorithm", "RS256"},
+		{"Custom Parameters", customParameterLines(tc.CustomParameters)},
+		{"Allow grade service access", yesNo(tc.wantsScope(lti.ScopeLineItem) || tc.wantsScope(lti.ScopeScore))},
+		{"Allow Membership Service access", yesNo(tc.wantsScope(lti.ScopeContextMembershipReadonly))},
+		{"Send user name", yesNo(tc.wantsClaim("name"))},
+		{"Send user email address", yesNo(tc.wantsClaim("email"))},
+	}
+	for _, msg := range tc.Messages {
+		placementType := "Course content tool"
+		if msg.Type == lti.MessageTypeDeepLinking {
+			placementType = "Deep Linking content tool"
+		}
+		fields = append(fields,
+			ConfigField{"Placement Label", msg.Label},
+			ConfigField{"Placement Type", placementType},
+			ConfigField{"Placement Target Link URI", msg.TargetLinkURI},
+		)
+	}
+	return fields
+}
+
+func (tc ToolConfiguration) wantsClaim(claim string) bool {
+	return containsString(tc.Claims, claim)
+}
+
+func (tc ToolConfiguration) wantsScope(scope string) bool {
+	return containsString(tc.Scopes, scope)
+}
+
+// message returns the first message of the given type, or nil
+func (tc ToolConfiguration) message(messageType string) *ToolMessage {
+	for i := range tc.Messages {
+		if tc.Messages[i].Type == messageType {
+			return &tc.Messages[i]
+		}
+	}
+	return nil
+}
+
+// customParameterLines formats custom parameters as sorted key=value lines
+func customParameterLines(params map[string]string) string {
+	lines := make([]string, 0, len(params))
+	for key, value := range params {
+		lines = append(lines, key+"="+value)
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "Yes"
+	}
+	return "No"
+}
+
+func alwaysNever(b bool) string {
+	if b {
+		return "Always"
+	}
+	return "Never"
+}
+
+// GetToolConfigurationHandler Returns a handler serving the tool configuration for platform admins
+// The format query parameter chooses the rendering: "ims" (the default) for the IMS client registration JSON,
+// "canvas" for a Canvas developer key, or "moodle" and "blackboard" for the fields of their registration forms.
+// The configuration is built with BuildToolConfiguration on every request, so it follows the defined routes.
+func (ltis *LTIService) GetToolConfigurationHandler(tool ToolConfiguration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		config := ltis.BuildToolConfiguration(tool)
+		if err := config.Validate(); err != nil {
+			ltis.debug("Tool configuration: %v", err)
+			http.Error(w, "The tool configuration is incomplete.", http.StatusInternalServerError)
+			return
+		}
+
+		var body interface{}
+		switch format := req.FormValue("format"); format {
+		case "", ToolConfigurationIMS:
+			body = config.ClientRegistration()
+		case ToolConfigurationCanvas:
+			body = config.CanvasDeveloperKey()
+		case ToolConfigurationMoodle:
+			body = config.MoodleFields()
+		case ToolConfigurationBlackboard:
+			body = config.BlackboardFields()
+		default:
+			http.Error(w, fmt.Sprintf("Unknown tool configuration format %q.", format), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(body); err != nil {
+			ltis.debug("Failed writing tool configuration: %v", err)
+		}
+	})
+}
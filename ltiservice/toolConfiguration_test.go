@@ -0,0 +1,160 @@
+package ltiservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MZDevinc/go-lti/lti"
+	"github.com/stretchr/testify/assert"
+)
+
+func testToolConfigurationService(t *testing.T) *LTIService {
+	ltis := NewLTIService(nil, Config{LaunchURL: "https://tool.example.com/launch"})
+	noop := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	assert.NoError(t, ltis.DefineRoute("/quiz", noop))
+	assert.NoError(t, ltis.DefineRoute("/quiz/:id", noop))
+	assert.NoError(t, ltis.DefineRoute("/picker", noop))
+	assert.NoError(t, ltis.DescribeRoute("/quiz", ToolMessage{
+		Type:       lti.MessageTypeResourceLink,
+		Label:      "Quizzes",
+		Placements: []string{"course_navigation"},
+	}))
+	assert.NoError(t, ltis.DescribeRoute("/picker", ToolMessage{
+		Type:       lti.MessageTypeDeepLinking,
+		Label:      "Add a quiz",
+		Placements: []string{"assignment_selection", "link_selection"},
+	}))
+	return ltis
+}
+
+var testToolConfiguration = ToolConfiguration{
+	ClientName:       "Example Tool",
+	InitiateLoginURI: "https://tool.example.com/login",
+	JWKSURI:          "https://tool.example.com/jwks",
+	Scopes:           []string{lti.ScopeLineItem, lti.ScopeScore},
+	Claims:           []string{"name"},
+	CustomParameters: map[string]string{"section": "$CourseSection.sourcedId", "mode": "student"},
+}
+
+func TestDescribeRoute(t *testing.T) {
+	ltis := testToolConfigurationService(t)
+
+	assert.Error(t, ltis.DescribeRoute("/missing", ToolMessage{Type: lti.MessageTypeResourceLink}))
+	assert.Error(t, ltis.DescribeRoute("/quiz/:id", ToolMessage{Type: lti.MessageTypeResourceLink}))
+
+	noop := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	assert.NoError(t, ltis.DefineRoute("/files/*path", noop))
+	assert.NoError(t, ltis.DefineRoute("/report/csv?", noop))
+	assert.NoError(t, ltis.DefineRoute("/report?format=:format", noop))
+	assert.NoError(t, ltis.DefineRoute("/report?format=csv", noop))
+	assert.Error(t, ltis.DescribeRoute("/files/*path", ToolMessage{Type: lti.MessageTypeResourceLink}))
+	assert.Error(t, ltis.DescribeRoute("/report/csv?", ToolMessage{Type: lti.MessageTypeResourceLink}))
+	assert.Error(t, ltis.DescribeRoute("/report?format=:format", ToolMessage{Type: lti.MessageTypeResourceLink}))
+	assert.NoError(t, ltis.DescribeRoute("/report?format=csv", ToolMessage{Type: lti.MessageTypeResourceLink}))
+
+	tool := ltis.BuildToolConfiguration(testToolConfiguration)
+	if assert.Len(t, tool.Messages, 3) {
+		assert.Equal(t, "https://tool.example.com/report?format=csv", tool.Messages[2].TargetLinkURI)
+	}
+}
+
+func TestBuildToolConfiguration(t *testing.T) {
+	ltis := testToolConfigurationService(t)
+
+	tool := ltis.BuildToolConfiguration(testToolConfiguration)
+	assert.Equal(t, []string{"https://tool.example.com/launch"}, tool.RedirectURIs)
+	assert.Equal(t, "https://tool.example.com/launch", tool.TargetLinkURI)
+	assert.Equal(t, "tool.example.com", tool.Domain)
+	if assert.Len(t, tool.Messages, 2) {
+		assert.Equal(t, "https://tool.example.com/quiz", tool.Messages[0].TargetLinkURI)
+		assert.Equal(t, "https://tool.example.com/picker", tool.Messages[1].TargetLinkURI)
+	}
+	assert.Nil(t, testToolConfiguration.Messages, "the given configuration must not change")
+	assert.NoError(t, tool.Validate())
+}
+
+func TestCanvasDeveloperKey(t *testing.T) {
+	key := testToolConfigurationService(t).BuildToolConfiguration(testToolConfiguration).CanvasDeveloperKey()
+
+	assert.Equal(t, "Example Tool", key.Title)
+	assert.Equal(t, "https://tool.example.com/login", key.OIDCInitiationURL)
+	assert.Equal(t, "https://tool.example.com/jwks", key.PublicJWKURL)
+	assert.Equal(t, []string{lti.ScopeLineItem, lti.ScopeScore}, key.Scopes)
+	if assert.Len(t, key.Extensions, 1) {
+		ext := key.Extensions[0]
+		assert.Equal(t, "name_only", ext.PrivacyLevel)
+		assert.Equal(t, "tool.example.com", ext.Domain)
+		assert.Equal(t, []CanvasPlacement{
+			{Placement: "course_navigation", MessageType: lti.MessageTypeResourceLink, TargetLinkURI: "https://tool.example.com/quiz", Text: "Quizzes"},
+			{Placement: "assignment_selection", MessageType: lti.MessageTypeDeepLinking, TargetLinkURI: "https://tool.example.com/picker", Text: "Add a quiz"},
+			{Placement: "link_selection", MessageType: lti.MessageTypeDeepLinking, TargetLinkURI: "https://tool.example.com/picker", Text: "Add a quiz"},
+		}, ext.Settings.Placements)
+	}
+}
+
+func TestPlatformFields(t *testing.T) {
+	tool := testToolConfigurationService(t).BuildToolConfiguration(testToolConfiguration)
+
+	fieldMap := func(fields []ConfigField) map[string]string {
+		m := map[string]string{}
+		for _, f := range fields {
+			m[f.Label] = f.Value
+		}
+		return m
+	}
+
+	moodle := fieldMap(tool.MoodleFields())
+	assert.Equal(t, "https://tool.example.com/login", moodle["Initiate login URL"])
+	assert.Equal(t, "https://tool.example.com/launch", moodle["Redirection URI(s)"])
+	assert.Equal(t, "mode=student\nsection=$CourseSection.sourcedId", moodle["Custom parameters"])
+	assert.Equal(t, "Yes", moodle["Supports Deep Linking (Content-Item Message)"])
+	assert.Equal(t, "https://tool.example.com/picker", moodle["Content Selection URL"])
+	assert.Equal(t, "Use this service for grade sync and column management", moodle["IMS LTI Assignment and Grade Services"])
+	assert.Equal(t, "Do not use this service", moodle["IMS LTI Names and Role Provisioning"])
+	assert.Equal(t, "Always", moodle["Share launcher's name with tool"])
+	assert.Equal(t, "Never", moodle["Share launcher's email with tool"])
+
+	blackboard := fieldMap(tool.BlackboardFields())
+	assert.Equal(t, "tool.example.com", blackboard["Domain(s)"])
+	assert.Equal(t, "https://tool.example.com/jwks", blackboard["Tool JWKS URL"])
+	assert.Equal(t, "Yes", blackboard["Allow grade service access"])
+	assert.Equal(t, "No", blackboard["Allow Membership Service access"])
+}
+
+func TestToolConfigurationHandler(t *testing.T) {
+	handler := testToolConfigurationService(t).GetToolConfigurationHandler(testToolConfiguration)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/tool-configuration"+query, nil))
+		return w
+	}
+
+	w := get("")
+	assert.Equal(t, 200, w.Code)
+	registration := ClientRegistration{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &registration))
+	assert.Equal(t, "https://tool.example.com/login", registration.InitiateLoginURI)
+	assert.Len(t, registration.LTIToolConfiguration.Messages, 2)
+
+	w = get("?format=canvas")
+	assert.Equal(t, 200, w.Code)
+	key := CanvasDeveloperKey{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &key))
+	assert.Equal(t, "Example Tool", key.Title)
+
+	w = get("?format=moodle")
+	assert.Equal(t, 200, w.Code)
+	var fields []ConfigField
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &fields))
+	assert.Equal(t, ConfigField{"Tool name", "Example Tool"}, fields[0])
+
+	assert.Equal(t, 400, get("?format=sakai").Code)
+
+	incomplete := NewLTIService(nil, Config{}).GetToolConfigurationHandler(ToolConfiguration{ClientName: "Example Tool"})
+	w = httptest.NewRecorder()
+	incomplete.ServeHTTP(w, httptest.NewRequest("GET", "/tool-configuration", nil))
+	assert.Equal(t, 500, w.Code)
+}